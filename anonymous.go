@@ -0,0 +1,136 @@
+package pollparty
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	secrand "crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// an anonymous poll has a fresh origin key, only known to its creator, which
+// signs the poll and the later controls. The poll is also ring signed over the
+// valid keys, so that its creator is known to be one of them. The tag of this
+// ring is the same for all the polls of a creator, it bounds how many of them
+// it can start.
+const (
+	AnonymousPollLimit  = 3
+	AnonymousPollWindow = 24 * time.Hour
+)
+
+func NewAnonymousPollKey(poll Poll) (PollKey, ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(Curve(), secrand.Reader)
+	if err != nil {
+		return PollKey{}, ecdsa.PrivateKey{}, err
+	}
+
+	return PollKey{
+		ID:     pollID(key.PublicKey, poll),
+		Origin: key.PublicKey,
+	}, *key, nil
+}
+
+// the key is kept by the creator, to control the poll after a restart
+func AnonymousKeyFileName(id PollKey) string {
+	return PrivateKeyFileName(id.String())
+}
+
+type AnonymousCreators struct {
+	sync.Mutex
+	m map[LinkTagMap]map[PollKeyMap]time.Time // start of the polls of each creator
+}
+
+// records the poll, false if its creator already started too many polls
+// around the same time
+func (c *AnonymousCreators) Allow(tag [2]*big.Int, id PollKey, start time.Time) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	polls, ok := c.m[LinkTagMapFrom(tag)]
+	if !ok {
+		polls = make(map[PollKeyMap]time.Time)
+		c.m[LinkTagMapFrom(tag)] = polls
+	}
+
+	if _, ok := polls[id.Pack()]; ok {
+		return true
+	}
+
+	count := 0
+	for _, other := range polls {
+		if other.Sub(start) < AnonymousPollWindow && start.Sub(other) < AnonymousPollWindow {
+			count++
+		}
+	}
+
+	if count >= AnonymousPollLimit {
+		return false
+	}
+
+	polls[id.Pack()] = start
+	return true
+}
+
+func (g *Gossiper) storeOriginKey(id PollKey, key ecdsa.PrivateKey) {
+	g.Polls.Lock()
+	defer g.Polls.Unlock()
+
+	info := g.Polls.m[id.Pack()]
+	info.OriginKey = &key
+	g.Polls.m[id.Pack()] = info
+}
+
+// the key signing as the origin of the poll, false if it isn't ours
+func (g *Gossiper) originKey(id PollKey) (ecdsa.PrivateKey, bool) {
+	if id.Origin.X.Cmp(g.KeyPair.X) == 0 && id.Origin.Y.Cmp(g.KeyPair.Y) == 0 {
+		return g.KeyPair, true
+	}
+
+	if key := g.Polls.Get(id).OriginKey; key != nil {
+		return *key, true
+	}
+
+	key, err := PrivateKeyLoad(AnonymousKeyFileName(id))
+	if err != nil || key.X.Cmp(id.Origin.X) != 0 || key.Y.Cmp(id.Origin.Y) != 0 {
+		return ecdsa.PrivateKey{}, false
+	}
+	g.storeOriginKey(id, key)
+
+	return key, true
+}
+
+func (g *Gossiper) anonymousSignature(pkg PollPacket) (*LinkableRingSignature, error) {
+	position, ok := containsKey(g.ValidKeys, g.KeyPair.PublicKey)
+	if !ok {
+		return nil, errors.New("our key isn't a valid key, can't sign anonymously")
+	}
+
+	input, err := json.Marshal(pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	sig := linkableRingSignature(input, g.ValidKeys, &g.KeyPair, position)
+	return &sig, nil
+}
+
+// an anonymous poll is also ring signed over the valid keys, other packets
+// have a single signature
+func (g *Gossiper) anonymousSignatureValid(pkg GossipPacket) bool {
+	anonymous := pkg.Poll.Poll != nil && pkg.Poll.Poll.Anonymous
+	if !anonymous {
+		return pkg.Signature.Linkable == nil || pkg.Signature.Elliptic == nil
+	}
+
+	input, err := json.Marshal(pkg.Poll)
+	if err != nil {
+		return false
+	}
+
+	sig := pkg.Signature.Linkable
+	return sig != nil && bytes.Equal(sig.Message, input) &&
+		verifyRingSignature(Signature{Linkable: sig}, LinkableRing, g.ValidKeys)
+}
@@ -0,0 +1,138 @@
+package pollparty
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+// gossipers sharing the same valid keys
+func DummyValidGossipers(n int) []*Gossiper {
+	ret := make([]*Gossiper, n)
+	var keys [][2]big.Int
+	for i := range ret {
+		ret[i] = DummyGossiper()
+		keys = append(keys, [2]big.Int{*ret[i].KeyPair.X, *ret[i].KeyPair.Y})
+	}
+
+	for _, g := range ret {
+		g.ValidKeys = keys
+	}
+
+	return ret
+}
+
+func anonymousPoll(t *testing.T, creator *Gossiper, question string) GossipPacket {
+	poll := DummyPoll()
+	poll.Question = question
+	poll.Anonymous = true
+
+	id, key, err := NewAnonymousPollKey(*poll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creator.storeOriginKey(id, key)
+
+	pkg := PollPacket{ID: id, Poll: poll}
+	sig, err := ecSignatureBy(key, pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig.Linkable, err = creator.anonymousSignature(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return GossipPacket{Poll: &pkg, Signature: &sig}
+}
+
+func TestAnonymousPollSignature(t *testing.T) {
+	gossipers := DummyValidGossipers(3)
+	creator, receiver := gossipers[0], gossipers[1]
+
+	msg := wireRoundTrip(t, anonymousPoll(t, creator, "Is the boss right?"))
+	if !receiver.SignatureValid(msg) {
+		t.Fatalf("Anonymous poll rejected")
+	}
+
+	if msg.Poll.ID.Origin.X.Cmp(creator.KeyPair.X) == 0 {
+		t.Errorf("Anonymous poll shows its creator")
+	}
+
+	linkable := msg.Signature.Linkable
+	msg.Signature.Linkable = nil
+	if receiver.SignatureValid(msg) {
+		t.Errorf("Accepted an anonymous poll without ring signature")
+	}
+
+	msg.Signature.Linkable = linkable
+	msg.Poll.Poll.Anonymous = false
+	if receiver.SignatureValid(msg) {
+		t.Errorf("Accepted a poll with two signatures")
+	}
+	msg.Poll.Poll.Anonymous = true
+
+	outsider := DummyGossiper()
+	outsider.ValidKeys = creator.ValidKeys
+	if _, err := outsider.anonymousSignature(*msg.Poll); err == nil {
+		t.Errorf("Key outside of the valid keys signed anonymously")
+	}
+
+	// only the creator can control the poll
+	key, ok := creator.originKey(msg.Poll.ID)
+	if _, other := receiver.originKey(msg.Poll.ID); !ok || other {
+		t.Fatalf("Wrong holder of the origin key")
+	}
+
+	control := NewPollControl(ControlCancel, 0)
+	pkg := PollPacket{ID: msg.Poll.ID, Control: &control}
+	sig, err := ecSignatureBy(key, pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !receiver.SignatureValid(wireRoundTrip(t, GossipPacket{Poll: &pkg, Signature: &sig})) {
+		t.Errorf("Control of the anonymous creator rejected")
+	}
+}
+
+func TestAnonymousCreatorLimit(t *testing.T) {
+	gossipers := DummyValidGossipers(3)
+	creator, other, receiver := gossipers[0], gossipers[1], gossipers[2]
+	dispatch := DispatcherPeersterMessage(receiver)
+	peer := *parseAddr("127.0.0.1:5001")
+
+	var ids []PollKey
+	for i := 0; i <= AnonymousPollLimit; i++ {
+		msg := anonymousPoll(t, creator, "Question "+string(rune('A'+i)))
+		receiver.RunningPolls.Add(msg.Poll.ID, drainHandler)
+		dispatch(peer, wireRoundTrip(t, msg))
+		ids = append(ids, msg.Poll.ID)
+	}
+
+	for _, id := range ids[:AnonymousPollLimit] {
+		if receiver.Polls.Get(id).Tags == nil {
+			t.Errorf("Anonymous poll under the limit dropped")
+		}
+	}
+
+	if receiver.Polls.Has(ids[AnonymousPollLimit]) {
+		t.Errorf("Anonymous poll over the limit stored")
+	}
+
+	msg := anonymousPoll(t, other, "Another creator")
+	receiver.RunningPolls.Add(msg.Poll.ID, drainHandler)
+	dispatch(peer, wireRoundTrip(t, msg))
+	if receiver.Polls.Get(msg.Poll.ID).Tags == nil {
+		t.Errorf("Poll of another anonymous creator dropped")
+	}
+
+	tag := ringTag(creator.ValidKeys, &creator.KeyPair)
+	later := time.Now().Add(2 * AnonymousPollWindow)
+	if !receiver.AnonymousCreators.Allow(tag, PollKey{creator.KeyPair.PublicKey, 1}, later) {
+		t.Errorf("Limit applies outside of the window")
+	}
+
+	if receiver.Reputations.Opinions[peer.String()] != 0 {
+		t.Errorf("Peer forwarding anonymous polls suspected")
+	}
+}
@@ -1,45 +1,399 @@
 package pollparty
 
 import (
+	"crypto/ecdsa"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 )
 
+// the poll described by the body and the query of a request, starting now
+func pollFromRequest(g *Gossiper, r *http.Request, buf []byte) (Poll, error) {
+	size, _ := r.Body.Read(buf)
+	pollInfo := string(buf[:size])
+	questionAndOpts := strings.Split(pollInfo, "\n")
+
+	question := questionAndOpts[0]
+	options := questionAndOpts[1:]
+
+	scheme, err := RingSchemeFromString(r.URL.Query().Get("scheme"))
+	if err != nil {
+		return Poll{}, err
+	}
+
+	tally, err := TallyModeFromString(r.URL.Query().Get("tally"))
+	if err != nil {
+		return Poll{}, err
+	}
+
+	poll := Poll{
+		Question:  question,
+		Options:   options,
+		StartTime: canonicalTime(time.Now()),
+		Duration:  time.Duration(3 * time.Second),
+		Scheme:    scheme,
+		Tally:     tally,
+		Revoting:  r.URL.Query().Get("revoting") == "true",
+		Anonymous: r.URL.Query().Get("anonymous") == "true",
+	}
+
+	if poll.Revoting && poll.Tally == TallyHomomorphic {
+		return Poll{}, errors.New("re-voting needs revealed votes")
+	}
+
+	if r.URL.Query().Get("weighted") == "true" {
+		registry, err := RegistryLoad()
+		if err != nil {
+			return Poll{}, err
+		}
+		poll.Registry = &registry
+
+		if !poll.weightsValid(g.ValidKeys) {
+			return Poll{}, errors.New("invalid weight registry, or weighted homomorphic tally")
+		}
+	}
+
+	err = pollQuorum(&poll, r.URL.Query().Get("quorum"), r.URL.Query().Get("turnout"), r.URL.Query().Get("rule"))
+	if err != nil {
+		return Poll{}, err
+	}
+
+	if trustees := r.URL.Query().Get("trustees"); trustees != "" {
+		err = nominateTrustees(g, &poll, trustees, r.URL.Query().Get("threshold"))
+		if err != nil {
+			return Poll{}, err
+		}
+	}
+
+	// the ballots are encrypted to the key of the trustees
+	if poll.Tally == TallyHomomorphic && !poll.dkgValid() {
+		return Poll{}, errors.New("homomorphic tally needs trustees")
+	}
+
+	return poll, nil
+}
+
+// the metadata, if any, is optional and given by the query, a creator name is
+// taken from the registry
+func metadataFromRequest(g *Gossiper, r *http.Request, poll Poll) (*PollMetadata, error) {
+	query := r.URL.Query()
+	if query.Get("description") == "" && query.Get("tags") == "" && query.Get("links") == "" && query.Get("creator") != "true" {
+		return nil, nil
+	}
+
+	metadata := PollMetadata{
+		Description: query.Get("description"),
+		Tags:        splitList(query.Get("tags")),
+		Links:       splitList(query.Get("links")),
+	}
+
+	if query.Get("creator") == "true" {
+		if poll.Anonymous {
+			return nil, errors.New("an anonymous poll can't name its creator")
+		}
+
+		registry := poll.Registry
+		if registry == nil {
+			loaded, err := RegistryLoad()
+			if err != nil {
+				return nil, err
+			}
+			registry = &loaded
+			metadata.Registry = registry
+		}
+
+		metadata.Creator = registry.NameOf(g.KeyPair.PublicKey)
+		if metadata.Creator == "" || !registry.Valid(g.ValidKeys) {
+			return nil, errors.New("no name for our key in a valid registry")
+		}
+	}
+
+	return &metadata, metadata.check()
+}
+
+func splitList(str string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(str, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+func startPoll(g *Gossiper, poll Poll, metadata *PollMetadata) (PollKey, error) {
+	id := NewPollKey(g, poll)
+	if poll.Anonymous {
+		var err error
+		id, err = anonymousPollKey(g, poll)
+		if err != nil {
+			return id, err
+		}
+	}
+
+	pkg := PollPacket{
+		ID:   id,
+		Poll: &poll,
+	}
+
+	if metadata != nil {
+		key, ok := g.originKey(id)
+		if !ok {
+			return id, errors.New("no key for the origin of the poll")
+		}
+
+		signed := *metadata
+		err := signed.sign(id, key)
+		if err != nil {
+			return id, err
+		}
+		pkg.Metadata = &signed
+	}
+
+	g.Polls.Store(pkg)
+	g.RunningPolls.Add(id, MasterHandler(g))
+	g.RunningPolls.Send(pkg, nil)
+
+	return id, nil
+}
+
 func apiStartPoll(g *Gossiper) func(http.ResponseWriter, *http.Request) {
 	buf := make([]byte, 1024)
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		size, _ := r.Body.Read(buf)
-		pollInfo := string(buf[:size])
-		questionAndOpts := strings.Split(pollInfo, "\n")
-
-		question := questionAndOpts[0]
-		options := questionAndOpts[1:]
+		poll, err := pollFromRequest(g, r, buf)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
 
-		id := NewPollKey(g)
-		pkg := PollPacket{
-			ID: id,
-			Poll: &Poll{
-				Question:  question,
-				Options:   options,
-				StartTime: time.Now(),
-				Duration:  time.Duration(3 * time.Second),
-			},
+		metadata, err := metadataFromRequest(g, r, poll)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
 		}
 
-		g.Polls.Store(pkg)
-		g.RunningPolls.Add(id, MasterHandler(g))
-		g.RunningPolls.Send(pkg, nil)
+		id, err := startPoll(g, poll, metadata)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
 
 		w.Write([]byte(id.String()))
 	}
 }
 
+// the origin key is saved, it proves the authorship of the poll to control it
+func anonymousPollKey(g *Gossiper, poll Poll) (PollKey, error) {
+	id, key, err := NewAnonymousPollKey(poll)
+	if err != nil {
+		return id, err
+	}
+
+	tag := ringTag(g.ValidKeys, &g.KeyPair)
+	if _, ok := containsKey(g.ValidKeys, g.KeyPair.PublicKey); !ok || !g.AnonymousCreators.Allow(tag, id, poll.StartTime) {
+		return id, errors.New("not a valid key, or too many anonymous polls")
+	}
+
+	err = PrivateKeySave(AnonymousKeyFileName(id), key)
+	if err != nil {
+		return id, err
+	}
+	g.storeOriginKey(id, key)
+
+	return id, nil
+}
+
+// trustees are given by their index in the keys file, the threshold defaults
+// to a majority of them
+func nominateTrustees(g *Gossiper, poll *Poll, trustees string, threshold string) error {
+	for _, str := range strings.Split(trustees, ",") {
+		i, err := strconv.Atoi(str)
+		if err != nil {
+			return err
+		}
+
+		if i < 0 || i >= len(g.ValidKeys) {
+			return errors.New("no valid key at index " + str)
+		}
+
+		poll.Trustees = append(poll.Trustees, PublicKeyWireFromEcdsa(ecdsa.PublicKey{
+			Curve: Curve(),
+			X:     &g.ValidKeys[i][0],
+			Y:     &g.ValidKeys[i][1],
+		}))
+	}
+
+	poll.Threshold = len(poll.Trustees)/2 + 1
+	if threshold != "" {
+		t, err := strconv.Atoi(threshold)
+		if err != nil {
+			return err
+		}
+		poll.Threshold = t
+	}
+
+	if !poll.dkgValid() {
+		return errors.New("invalid trustees or threshold")
+	}
+
+	return nil
+}
+
+// the quorum is a number of participants, the turnout a percentage of them
+func pollQuorum(poll *Poll, quorum string, turnout string, rule string) error {
+	var err error
+
+	if quorum != "" {
+		poll.MinParticipants, err = strconv.Atoi(quorum)
+		if err != nil {
+			return err
+		}
+	}
+
+	if turnout != "" {
+		poll.MinTurnout, err = strconv.Atoi(turnout)
+		if err != nil {
+			return err
+		}
+	}
+
+	if poll.MinParticipants < 0 || poll.MinTurnout < 0 || poll.MinTurnout > 100 {
+		return errors.New("invalid quorum or turnout")
+	}
+
+	poll.Rule, err = DecisionRuleFromString(rule)
+	return err
+}
+
+// only the origin of a poll can cancel, close or extend it, extending adds
+// the query duration to the current deadline
+func apiControlPoll(g *Gossiper) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := PollKeyFromString(mux.Vars(r)["id"])
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		action, err := ControlActionFromString(mux.Vars(r)["action"])
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if _, origin := g.originKey(id); !g.Polls.Has(id) || !origin {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		info := g.Polls.Get(id)
+		var duration time.Duration
+		if action == ControlExtend {
+			extra, err := time.ParseDuration(r.URL.Query().Get("duration"))
+			if err != nil || extra <= 0 {
+				log.Println("invalid extension duration")
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			duration = info.Deadline().Sub(info.Poll.StartTime) + extra
+		}
+
+		control := NewPollControl(action, duration)
+		g.SendPollControl(id, control)
+
+		if g.RunningPolls.Has(id) {
+			g.RunningPolls.Send(PollPacket{ID: id, Control: &control}, nil)
+		}
+	}
+}
+
+// the poll starts at start, or now, and again after every duration if given
+func apiSchedulePoll(g *Gossiper) func(http.ResponseWriter, *http.Request) {
+	buf := make([]byte, 1024)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		poll, err := pollFromRequest(g, r, buf)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		next := time.Now()
+		if start := r.URL.Query().Get("start"); start != "" {
+			next, err = time.Parse(time.RFC3339, start)
+			if err != nil {
+				log.Println(err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		var every time.Duration
+		if str := r.URL.Query().Get("every"); str != "" {
+			every, err = time.ParseDuration(str)
+			if err != nil || every < poll.Duration {
+				log.Println("invalid schedule period, shorter than a poll")
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		metadata, err := metadataFromRequest(g, r, poll)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		schedule := g.Schedules.Add(poll, metadata, next, every)
+		w.Write([]byte(strconv.FormatUint(schedule.ID, 10)))
+	}
+}
+
+func apiGetSchedules(g *Gossiper) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bytes, err := json.Marshal(g.Schedules.List())
+		if err != nil {
+			log.Printf("unable to encode as json")
+			return
+		}
+
+		_, err = w.Write(bytes)
+		if err != nil {
+			log.Printf("unable to send answer")
+		}
+	}
+}
+
+func apiCancelSchedule(g *Gossiper) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if !g.Schedules.Cancel(id) {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
 func apiGetPollOptions(g *Gossiper) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id, err := PollKeyFromString(mux.Vars(r)["id"])
@@ -87,10 +441,9 @@ func apiVoteForPoll(g *Gossiper) func(http.ResponseWriter, *http.Request) {
 			return
 		}
 
-		// might block so go!
-		go func() {
-			g.RunningPolls.Get(id).LocalVote <- option
-		}()
+		if !g.RunningPolls.SendLocalVote(id, option) {
+			w.WriteHeader(http.StatusConflict)
+		}
 	}
 }
 
@@ -121,17 +474,96 @@ func apiGetPollResults(g *Gossiper) func(http.ResponseWriter, *http.Request) {
 	}
 }
 
+func apiGetPollResult(g *Gossiper) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := PollKeyFromString(mux.Vars(r)["id"])
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if !g.Polls.Has(id) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		bytes, err := json.Marshal(g.Polls.Get(id).Result())
+		if err != nil {
+			log.Printf("unable to encode as json")
+			return
+		}
+
+		_, err = w.Write(bytes)
+		if err != nil {
+			log.Printf("unable to send answer")
+		}
+	}
+}
+
+func apiGetPollMetadata(g *Gossiper) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := PollKeyFromString(mux.Vars(r)["id"])
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		metadata := g.Polls.Get(id).Metadata
+		if metadata == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		bytes, err := json.Marshal(metadata)
+		if err != nil {
+			log.Printf("unable to encode as json")
+			return
+		}
+
+		_, err = w.Write(bytes)
+		if err != nil {
+			log.Printf("unable to send answer")
+		}
+	}
+}
+
+type pollList struct {
+	Polls []PollSummary
+	Next  string // cursor of the next page, empty on the last one
+}
+
 func apiGetPolls(g *Gossiper) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		g.Polls.RLock()
-		defer g.Polls.RUnlock()
+		query := r.URL.Query()
+		filter := PollFilter{
+			Phase:  query.Get("status"),
+			Origin: query.Get("origin"),
+			Search: query.Get("q"),
+			Tag:    query.Get("tag"),
+			Sort:   query.Get("sort"),
+			Cursor: query.Get("cursor"),
+		}
 
-		infos := make([]string, 0)
-		for id := range g.Polls.m {
-			infos = append(infos, id.Unpack().String())
+		if limit := query.Get("limit"); limit != "" {
+			var err error
+			filter.Limit, err = strconv.Atoi(limit)
+			if err != nil {
+				log.Println(err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
 		}
 
-		bytes, err := json.Marshal(infos)
+		polls, next, err := g.ListPolls(filter)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		bytes, err := json.Marshal(pollList{polls, next})
 		if err != nil {
 			log.Printf("unable to encode as json")
 			return
@@ -144,6 +576,70 @@ func apiGetPolls(g *Gossiper) func(http.ResponseWriter, *http.Request) {
 	}
 }
 
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("unable to encode as json")
+		return
+	}
+
+	_, err = w.Write(bytes)
+	if err != nil {
+		log.Printf("unable to send answer")
+	}
+}
+
+func apiGetReputations(g *Gossiper) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, g.Reputations.Peers(time.Now()))
+	}
+}
+
+func apiGetOpinions(g *Gossiper) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, g.Reputations.PollOpinions())
+	}
+}
+
+// expired bans too, with all=true
+func apiGetBlacklist(g *Gossiper) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		all := r.URL.Query().Get("all") == "true"
+		writeJSON(w, g.Reputations.Bans(all, time.Now()))
+	}
+}
+
+// trust, suspect or pin the peer, clear its override or unban it
+func apiOverrideReputation(g *Gossiper) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		peer := mux.Vars(r)["peer"]
+
+		switch action := mux.Vars(r)["action"]; action {
+		case "unban":
+			if !g.Reputations.Unban(peer) {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case "clear":
+			g.Reputations.SetOverride(peer, OverrideNone)
+		default:
+			override, err := OverrideFromString(action)
+			if err != nil {
+				log.Println(err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			g.Reputations.SetOverride(peer, override)
+		}
+	}
+}
+
+// dropped and dispatched packets, to see if the gossiper is overloaded
+func apiGetReceiveStats(g *Gossiper) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, g.Receiver.Snapshot())
+	}
+}
+
 func createFakePollResults(options []string) map[string]int {
 	results := make(map[string]int)
 
@@ -160,10 +656,25 @@ func ApiStart(g *Gossiper, uiPort string) {
 	r.HandleFunc("/poll", apiStartPoll(g)).Methods("POST")
 	r.HandleFunc("/poll", apiGetPolls(g)).Methods("GET")
 	r.HandleFunc("/poll/{id}", apiGetPollOptions(g)).Methods("GET")
+	r.HandleFunc("/poll/{id}/metadata", apiGetPollMetadata(g)).Methods("GET")
+	r.HandleFunc("/poll/{id}/{action}", apiControlPoll(g)).Methods("POST")
 
 	r.HandleFunc("/vote/{id}", apiGetPollResults(g)).Methods("GET")
 	r.HandleFunc("/vote/{id}", apiVoteForPoll(g)).Methods("POST")
 
+	r.HandleFunc("/result/{id}", apiGetPollResult(g)).Methods("GET")
+
+	r.HandleFunc("/schedule", apiSchedulePoll(g)).Methods("POST")
+	r.HandleFunc("/schedule", apiGetSchedules(g)).Methods("GET")
+	r.HandleFunc("/schedule/{id}", apiCancelSchedule(g)).Methods("DELETE")
+
+	r.HandleFunc("/reputation", apiGetReputations(g)).Methods("GET")
+	r.HandleFunc("/reputation/opinions", apiGetOpinions(g)).Methods("GET")
+	r.HandleFunc("/reputation/blacklist", apiGetBlacklist(g)).Methods("GET")
+	r.HandleFunc("/reputation/{peer}/{action}", apiOverrideReputation(g)).Methods("POST")
+
+	r.HandleFunc("/stats", apiGetReceiveStats(g)).Methods("GET")
+
 	r.Handle("/", http.FileServer(http.Dir(".")))
 	http.Handle("/", r)
 
@@ -52,6 +52,10 @@ func main() {
 		key(s, tail)
 	case "vote":
 		vote(s, tail)
+	case "schedule":
+		schedule(s, tail)
+	case "rep":
+		rep(s, tail)
 	default:
 		panic("unkown action: " + action)
 	}
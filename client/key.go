@@ -3,9 +3,11 @@ package main
 import (
 	"crypto/ecdsa"
 	"crypto/rand"
+	"fmt"
 	pkg "github.com/ValerianRousset/Peerster"
 	"log"
 	"math/big"
+	"strings"
 )
 
 func key_new(s Settings, args []string) {
@@ -36,12 +38,61 @@ func key_new(s Settings, args []string) {
 	}
 }
 
+// the issuer signs the weights of the keys, given as index=weight or
+// index=weight:name with the index in the keys file
+func key_registry(s Settings, args []string) {
+	issuer, err := pkg.PrivateKeyLoad(pkg.PrivateKeyFileName(args[0]))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	keys, err := pkg.KeyFileLoad()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var weights []pkg.IdentityWeight
+	for _, arg := range args[1:] {
+		var index, weight int
+		name := ""
+		if i := strings.Index(arg, ":"); i >= 0 {
+			arg, name = arg[:i], arg[i+1:]
+		}
+		_, err := fmt.Sscanf(arg, "%d=%d", &index, &weight)
+		if err != nil || index < 0 || index >= len(keys) || weight <= 0 {
+			log.Fatalf("invalid weight \"%s\"", arg)
+		}
+
+		weights = append(weights, pkg.IdentityWeight{
+			Key: pkg.PublicKeyWireFromEcdsa(ecdsa.PublicKey{
+				Curve: pkg.Curve(),
+				X:     &keys[index][0],
+				Y:     &keys[index][1],
+			}),
+			Weight: weight,
+			Name:   name,
+		})
+	}
+
+	registry, err := pkg.NewWeightRegistry(weights, issuer)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = pkg.RegistrySave(registry)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
 func key(s Settings, args []string) {
 	action := args[0]
 
 	switch action {
 	case "new":
 		key_new(s, args[1:])
+	case "registry":
+		key_registry(s, args[1:])
 	default:
 		panic("unkown key action: " + action)
 	}
@@ -3,14 +3,80 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 )
 
-func poll_new(s Settings, args []string) {
-	url := s.getUrl("poll")
+// flags describing a poll, the returned function gives the query once they
+// are parsed
+func poll_flags(flags *flag.FlagSet) func() string {
+	scheme := flags.String("scheme", "linkable", "ring signature used by voters (linkable or compact)")
+	tally := flags.String("tally", "reveal", "how votes are counted (reveal or homomorphic)")
+	trustees := flags.String("trustees", "", "comma separated indexes in the keys file of the DKG trustees")
+	threshold := flags.String("threshold", "", "trustees needed to use the DKG key (default majority)")
+	revoting := flags.Bool("revoting", false, "allow voters to change their vote until the commit deadline")
+	weighted := flags.Bool("weighted", false, "weight the votes with the registry of the server")
+	anonymous := flags.Bool("anonymous", false, "hide the creator among the valid keys")
+	quorum := flags.Int("quorum", 0, "minimum number of participants")
+	turnout := flags.Int("turnout", 0, "minimum percent of the participants sending a ballot")
+	rule := flags.String("rule", "plurality", "how the winner is chosen (plurality, majority or supermajority)")
+	description := flags.String("description", "", "longer description of the poll, in markdown")
+	descriptionFile := flags.String("description-file", "", "read the description from this file")
+	tags := flags.String("tags", "", "comma separated topics of the poll")
+	links := flags.String("links", "", "comma separated http(s) links about the poll")
+	creator := flags.Bool("creator", false, "show our name in the registry of the server as the creator")
+
+	return func() string {
+		query := "scheme=" + *scheme + "&tally=" + *tally + "&rule=" + *rule
+		query += fmt.Sprintf("&quorum=%d&turnout=%d", *quorum, *turnout)
+		if *revoting {
+			query += "&revoting=true"
+		}
+		if *weighted {
+			query += "&weighted=true"
+		}
+		if *anonymous {
+			query += "&anonymous=true"
+		}
+		if *trustees != "" {
+			query += "&trustees=" + *trustees + "&threshold=" + *threshold
+		}
+		if *descriptionFile != "" {
+			content, err := ioutil.ReadFile(*descriptionFile)
+			check(err)
+			*description = string(content)
+		}
+		metadata := url.Values{}
+		if *description != "" {
+			metadata.Set("description", *description)
+		}
+		if *tags != "" {
+			metadata.Set("tags", *tags)
+		}
+		if *links != "" {
+			metadata.Set("links", *links)
+		}
+		if *creator {
+			metadata.Set("creator", "true")
+		}
+		if len(metadata) > 0 {
+			query += "&" + metadata.Encode()
+		}
+		return query
+	}
+}
+
+// the question followed by the options
+func poll_body(args []string) *bytes.Buffer {
 	question := args[0]
 	options := args[1:]
 
@@ -19,9 +85,18 @@ func poll_new(s Settings, args []string) {
 	msg += "\n"
 	msg += strings.Join(options, "\n")
 
-	toSend := bytes.NewBufferString(msg)
+	return bytes.NewBufferString(msg)
+}
+
+func poll_new(s Settings, args []string) {
+	flags := flag.NewFlagSet("poll new", flag.ExitOnError)
+	query := poll_flags(flags)
+	flags.Parse(args)
+	args = flags.Args()
 
-	resp, err := http.Post(url, "text/plain", toSend)
+	url := s.getUrl("poll") + "?" + query()
+
+	resp, err := http.Post(url, "text/plain", poll_body(args))
 	check(err)
 	defer resp.Body.Close()
 
@@ -33,25 +108,184 @@ func poll_new(s Settings, args []string) {
 	fmt.Println(string(content))
 }
 
-func poll_list(s Settings, args []string) {
-	url := s.getUrl("poll")
+type pollSummary struct {
+	ID           string
+	Question     string
+	Origin       string
+	Anonymous    bool
+	Mine         bool
+	Created      time.Time
+	Phase        string
+	Participants int
+	Voted        bool
+	Tags         []string
+	Creator      string
+}
+
+type pollMetadata struct {
+	Description string
+	Tags        []string
+	Links       []string
+	Creator     string
+}
+
+type pollList struct {
+	Polls []pollSummary
+	Next  string
+}
 
-	resp, err := http.Get(url)
+func get_poll_page(s Settings, query url.Values) pollList {
+	resp, err := http.Get(s.getUrl("poll") + "?" + query.Encode())
 	check(err)
 	defer resp.Body.Close()
 
 	checkResp(resp)
 
-	content, err := ioutil.ReadAll(resp.Body)
-	check(err)
+	var list pollList
+	check(json.NewDecoder(resp.Body).Decode(&list))
+
+	return list
+}
+
+// every page of the listing
+func get_polls(s Settings, query url.Values) []pollSummary {
+	var ret []pollSummary
+
+	for {
+		list := get_poll_page(s, query)
+		ret = append(ret, list.Polls...)
+
+		if list.Next == "" {
+			return ret
+		}
+		query.Set("cursor", list.Next)
+	}
+}
+
+// any unique prefix of a poll ID can be used instead of it
+func resolve_poll(s Settings, prefix string) string {
+	var matches []string
+	for _, p := range get_polls(s, url.Values{"limit": {"1000"}}) {
+		if strings.HasPrefix(p.ID, strings.ToLower(prefix)) {
+			matches = append(matches, p.ID)
+		}
+	}
+
+	if len(matches) == 0 {
+		log.Fatalf("no poll starting with \"%s\"", prefix)
+	} else if len(matches) > 1 {
+		log.Fatalf("%d polls starting with \"%s\", give a longer prefix", len(matches), prefix)
+	}
+
+	return matches[0]
+}
 
-	var list []string
-	err = json.Unmarshal(content, &list)
+func poll_list(s Settings, args []string) {
+	flags := flag.NewFlagSet("poll list", flag.ExitOnError)
+	status := flags.String("status", "", "only the polls in this phase (registration, voting, revealing, closed, cancelled or equivocated)")
+	origin := flags.String("origin", "", "only the polls of this origin, given by a prefix, or \"me\"")
+	search := flags.String("search", "", "only the polls with this text in their question")
+	tag := flags.String("tag", "", "only the polls with this tag")
+	sorting := flags.String("sort", "-created", "created, question or participants, a leading \"-\" for descending order")
+	limit := flags.Int("limit", 20, "polls per page")
+	cursor := flags.String("cursor", "", "start after this poll, as given at the end of the previous page")
+	flags.Parse(args)
+
+	query := url.Values{}
+	query.Set("status", *status)
+	query.Set("origin", *origin)
+	query.Set("q", *search)
+	query.Set("tag", *tag)
+	query.Set("sort", *sorting)
+	query.Set("limit", strconv.Itoa(*limit))
+	query.Set("cursor", *cursor)
+
+	list := get_poll_page(s, query)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tQUESTION\tORIGIN\tCREATED\tPHASE\tPARTICIPANTS\tVOTED")
+	for _, p := range list.Polls {
+		origin := p.Origin[:12]
+		if p.Mine {
+			origin = "me"
+		} else if p.Creator != "" {
+			origin = p.Creator
+		}
+		if p.Anonymous {
+			origin += " (anonymous)"
+		}
+
+		voted := ""
+		if p.Voted {
+			voted = "yes"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", p.ID[:12], p.Question, origin,
+			p.Created.Local().Format("2006-01-02 15:04"), p.Phase, p.Participants, voted)
+	}
+	w.Flush()
+
+	if list.Next != "" {
+		fmt.Printf("more with -cursor %s\n", list.Next)
+	}
+}
+
+// the summary of the poll, with its description and links if it has some
+func poll_show(s Settings, args []string) {
+	id := resolve_poll(s, args[0])
+
+	var summary pollSummary
+	for _, p := range get_polls(s, url.Values{"limit": {"1000"}}) {
+		if p.ID == id {
+			summary = p
+		}
+	}
+
+	resp, err := http.Get(s.getUrl("poll", id, "metadata"))
 	check(err)
+	defer resp.Body.Close()
 
-	for _, id := range list {
-		fmt.Println(id)
+	var metadata pollMetadata
+	if resp.StatusCode != http.StatusNotFound {
+		checkResp(resp)
+		check(json.NewDecoder(resp.Body).Decode(&metadata))
 	}
+
+	fmt.Println(summary.Question)
+	fmt.Printf("id:      %s\n", summary.ID)
+	if metadata.Creator != "" {
+		fmt.Printf("creator: %s (%s)\n", metadata.Creator, summary.Origin[:12])
+	} else {
+		fmt.Printf("origin:  %s\n", summary.Origin[:12])
+	}
+	fmt.Printf("phase:   %s, %d participants\n", summary.Phase, summary.Participants)
+	if len(metadata.Tags) > 0 {
+		fmt.Printf("tags:    %s\n", strings.Join(metadata.Tags, ", "))
+	}
+	for _, link := range metadata.Links {
+		fmt.Printf("link:    %s\n", link)
+	}
+	if metadata.Description != "" {
+		fmt.Printf("\n%s\n", metadata.Description)
+	}
+}
+
+func poll_control(s Settings, action string, args []string) {
+	flags := flag.NewFlagSet("poll "+action, flag.ExitOnError)
+	duration := flags.String("duration", "", "time added to the deadline, when extending")
+	flags.Parse(args)
+	args = flags.Args()
+
+	url := s.getUrl("poll", resolve_poll(s, args[0]), action)
+	if *duration != "" {
+		url += "?duration=" + *duration
+	}
+
+	resp, err := http.Post(url, "text/plain", nil)
+	check(err)
+	defer resp.Body.Close()
+
+	checkResp(resp)
 }
 
 func poll(s Settings, args []string) {
@@ -63,6 +297,10 @@ func poll(s Settings, args []string) {
 		poll_new(s, tail)
 	case "list":
 		poll_list(s, tail)
+	case "show":
+		poll_show(s, tail)
+	case "cancel", "close", "extend":
+		poll_control(s, action, tail)
 	default:
 		panic("unkown poll action: " + action)
 	}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+type offenceRecord struct {
+	Offence string
+	Poll    string
+	Time    time.Time
+}
+
+type peerReputation struct {
+	Peer     string
+	Score    float64
+	Response string
+	Offences int
+	Reasons  []offenceRecord
+	Opinion  int
+	Override string
+}
+
+type banEntry struct {
+	Until   time.Time
+	Reasons []offenceRecord
+	Polls   []string
+}
+
+func getJSON(s Settings, value interface{}, elems ...string) {
+	resp, err := http.Get(s.getUrl(elems...))
+	check(err)
+	defer resp.Body.Close()
+
+	checkResp(resp)
+
+	check(json.NewDecoder(resp.Body).Decode(value))
+}
+
+func reasons(records []offenceRecord) string {
+	names := make([]string, 0, len(records))
+	for _, record := range records {
+		names = append(names, record.Offence)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func rep_list(s Settings, args []string) {
+	flags := flag.NewFlagSet("rep list", flag.ExitOnError)
+	verbose := flags.Bool("v", false, "show every offence with its poll")
+	flags.Parse(args)
+
+	var peers []peerReputation
+	getJSON(s, &peers, "reputation")
+
+	for _, peer := range peers {
+		opinion := map[int]string{-1: "suspect", 0: "-", 1: "trust"}[peer.Opinion]
+		override := peer.Override
+		if override == "" {
+			override = "-"
+		}
+		fmt.Printf("%s\t%.1f\t%s\t%s\t%s\t%d offences\n", peer.Peer, peer.Score, peer.Response, opinion, override, peer.Offences)
+
+		if *verbose {
+			for _, record := range peer.Reasons {
+				fmt.Printf("\t%s\t%s\t%s\n", record.Time.Local().Format(time.RFC3339), record.Offence, record.Poll)
+			}
+		}
+	}
+}
+
+func rep_opinions(s Settings, args []string) {
+	var opinions map[string]map[string]map[string]int
+	getJSON(s, &opinions, "reputation", "opinions")
+
+	for poll, signers := range opinions {
+		fmt.Println(poll)
+		for signer, peers := range signers {
+			var trusted, suspected []string
+			for peer, opinion := range peers {
+				if opinion == 1 {
+					trusted = append(trusted, peer)
+				} else {
+					suspected = append(suspected, peer)
+				}
+			}
+			sort.Strings(trusted)
+			sort.Strings(suspected)
+			fmt.Printf("\t%s\ttrusts %s\tsuspects %s\n", signer, strings.Join(trusted, " "), strings.Join(suspected, " "))
+		}
+	}
+}
+
+func rep_blacklist(s Settings, args []string) {
+	flags := flag.NewFlagSet("rep blacklist", flag.ExitOnError)
+	all := flags.Bool("all", false, "show expired bans too")
+	flags.Parse(args)
+
+	elem := "blacklist"
+	if *all {
+		elem += "?all=true"
+	}
+
+	var bans map[string]banEntry
+	getJSON(s, &bans, "reputation", elem)
+
+	for peer, ban := range bans {
+		until := "forever"
+		if !ban.Until.IsZero() {
+			until = ban.Until.Local().Format(time.RFC3339)
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\n", peer, until, reasons(ban.Reasons), strings.Join(ban.Polls, " "))
+	}
+}
+
+// trust, suspect, pin, clear or unban
+func rep_override(s Settings, action string, args []string) {
+	resp, err := http.Post(s.getUrl("reputation", args[0], action), "text/plain", nil)
+	check(err)
+	defer resp.Body.Close()
+
+	checkResp(resp)
+}
+
+func rep(s Settings, args []string) {
+	action := args[0]
+	tail := args[1:]
+
+	switch action {
+	case "list":
+		rep_list(s, tail)
+	case "opinions":
+		rep_opinions(s, tail)
+	case "blacklist":
+		rep_blacklist(s, tail)
+	case "trust", "suspect", "pin", "clear", "unban":
+		rep_override(s, action, tail)
+	default:
+		panic("unkown rep action: " + action)
+	}
+}
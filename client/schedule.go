@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+func schedule_new(s Settings, args []string) {
+	flags := flag.NewFlagSet("schedule new", flag.ExitOnError)
+	query := poll_flags(flags)
+	start := flags.String("start", "", "first start of the poll, as RFC3339 (default now)")
+	in := flags.Duration("in", 0, "first start of the poll, from now")
+	every := flags.Duration("every", 0, "period of the poll, if it recurs (168h for weekly)")
+	flags.Parse(args)
+	args = flags.Args()
+
+	u := s.getUrl("schedule") + "?" + query()
+	if *in > 0 {
+		*start = time.Now().Add(*in).Format(time.RFC3339)
+	}
+	if *start != "" {
+		u += "&start=" + url.QueryEscape(*start)
+	}
+	if *every > 0 {
+		u += "&every=" + every.String()
+	}
+
+	resp, err := http.Post(u, "text/plain", poll_body(args))
+	check(err)
+	defer resp.Body.Close()
+
+	checkResp(resp)
+
+	content, err := ioutil.ReadAll(resp.Body)
+	check(err)
+
+	fmt.Println(string(content))
+}
+
+type scheduled struct {
+	ID   uint64
+	Poll struct {
+		Question string
+	}
+	Next  time.Time
+	Every time.Duration
+}
+
+func schedule_list(s Settings, args []string) {
+	resp, err := http.Get(s.getUrl("schedule"))
+	check(err)
+	defer resp.Body.Close()
+
+	checkResp(resp)
+
+	var list []scheduled
+	check(json.NewDecoder(resp.Body).Decode(&list))
+
+	for _, sched := range list {
+		every := "once"
+		if sched.Every > 0 {
+			every = "every " + sched.Every.String()
+		}
+		fmt.Printf("%d\t%s\t%s\t%s\n", sched.ID, sched.Next.Local().Format(time.RFC3339), every, sched.Poll.Question)
+	}
+}
+
+func schedule_cancel(s Settings, args []string) {
+	req, err := http.NewRequest(http.MethodDelete, s.getUrl("schedule", args[0]), nil)
+	check(err)
+
+	resp, err := http.DefaultClient.Do(req)
+	check(err)
+	defer resp.Body.Close()
+
+	checkResp(resp)
+}
+
+func schedule(s Settings, args []string) {
+	action := args[0]
+	tail := args[1:]
+
+	switch action {
+	case "new":
+		schedule_new(s, tail)
+	case "list":
+		schedule_list(s, tail)
+	case "cancel":
+		schedule_cancel(s, tail)
+	default:
+		panic("unkown schedule action: " + action)
+	}
+}
@@ -2,13 +2,15 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 )
 
 func vote_put(s Settings, args []string) {
-	id := args[0]
+	id := resolve_poll(s, args[0])
 	url := s.getUrl("vote", id)
 	option := args[1]
 
@@ -22,7 +24,7 @@ func vote_put(s Settings, args []string) {
 }
 
 func vote_show(s Settings, args []string) {
-	id := args[0]
+	id := resolve_poll(s, args[0])
 	url := s.getUrl("vote", id)
 
 	resp, err := http.Get(url)
@@ -37,6 +39,61 @@ func vote_show(s Settings, args []string) {
 	fmt.Println(string(content))
 }
 
+type pollResult struct {
+	Counts       map[string]int
+	Participants int
+	Committed    int
+	Counted      int
+	QuorumMet    bool
+	Winner       string
+	Tied         []string
+	TieBreak     string
+	Final        bool
+}
+
+func vote_result(s Settings, args []string) {
+	id := resolve_poll(s, args[0])
+	url := s.getUrl("result", id)
+
+	resp, err := http.Get(url)
+	check(err)
+	defer resp.Body.Close()
+
+	checkResp(resp)
+
+	var result pollResult
+	check(json.NewDecoder(resp.Body).Decode(&result))
+
+	fmt.Printf("participants %d, ballots %d, counted %d\n", result.Participants, result.Committed, result.Counted)
+	for option, count := range result.Counts {
+		fmt.Printf("%s: %d\n", option, count)
+	}
+
+	winner := "winner"
+	if !result.Final {
+		fmt.Println("not final, the poll is still running")
+		winner = "leading"
+	}
+
+	var others []string
+	for _, option := range result.Tied {
+		if option != result.Winner {
+			others = append(others, option)
+		}
+	}
+
+	switch {
+	case !result.QuorumMet:
+		fmt.Println("quorum not met")
+	case result.Winner == "":
+		fmt.Println("no option won")
+	case result.TieBreak != "":
+		fmt.Printf("%s %s, tied with %s, broken by %s\n", winner, result.Winner, strings.Join(others, ", "), result.TieBreak)
+	default:
+		fmt.Println(winner + " " + result.Winner)
+	}
+}
+
 func vote(s Settings, args []string) {
 	action := args[0]
 	tail := args[1:]
@@ -46,6 +103,8 @@ func vote(s Settings, args []string) {
 		vote_put(s, tail)
 	case "show":
 		vote_show(s, tail)
+	case "result":
+		vote_result(s, tail)
 	default:
 		panic("unkown vote action: " + action)
 	}
@@ -0,0 +1,333 @@
+package pollparty
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+)
+
+// Linkable one-out-of-many proof (Groth-Kohlweiss) over the ring, its size
+// grows with log2(len(L)) instead of len(L) like LinkableRingSignature.
+//
+// Ring members are seen as commitments to zero, P_i = x_i*G = Com(0; x_i)
+// with Com(a; r) = a*U + r*G. The signer proves that it knows the opening of
+// one of them and that Tag = x_l*H uses the same secret, with H the same ring
+// dependent point as for LinkableRingSignature, so that tags of both schemes
+// can be compared.
+type CompactRingSignature struct {
+	Message []byte
+	CL      [][2]*big.Int // commitments to the bits of the signer position
+	CA      [][2]*big.Int
+	CB      [][2]*big.Int
+	CD      [][2]*big.Int
+	Q       [][2]*big.Int // CD randomness, but on H, to link the Tag
+	F       []*big.Int
+	ZA      []*big.Int
+	ZB      []*big.Int
+	ZD      *big.Int
+	Tag     [2]*big.Int
+}
+
+const compactCommitmentBase = "PeersterPoll compact ring signature"
+
+func compactU() (x, y *big.Int) {
+	return mapToPoint([]byte(compactCommitmentBase))
+}
+
+func pointAdd(a, b [2]*big.Int) [2]*big.Int {
+	x, y := Curve().Add(a[0], a[1], b[0], b[1])
+	return [2]*big.Int{x, y}
+}
+
+func pointMul(p [2]*big.Int, k *big.Int) [2]*big.Int {
+	n := Curve().Params().N
+	x, y := Curve().ScalarMult(p[0], p[1], new(big.Int).Mod(k, n).Bytes())
+	return [2]*big.Int{x, y}
+}
+
+func pointBaseMul(k *big.Int) [2]*big.Int {
+	n := Curve().Params().N
+	x, y := Curve().ScalarBaseMult(new(big.Int).Mod(k, n).Bytes())
+	return [2]*big.Int{x, y}
+}
+
+func pointNeg(p [2]*big.Int) [2]*big.Int {
+	if p[1].Sign() == 0 {
+		return p
+	}
+	return [2]*big.Int{p[0], new(big.Int).Sub(Curve().Params().P, p[1])}
+}
+
+func pointEqual(a, b [2]*big.Int) bool {
+	return a[0].Cmp(b[0]) == 0 && a[1].Cmp(b[1]) == 0
+}
+
+func pointInfinity() [2]*big.Int {
+	return [2]*big.Int{new(big.Int), new(big.Int)}
+}
+
+// Com(a; r) = a*U + r*G
+func pedersenCommit(a, r *big.Int) [2]*big.Int {
+	Ux, Uy := compactU()
+	return pointAdd(pointMul([2]*big.Int{Ux, Uy}, a), pointBaseMul(r))
+}
+
+func randomScalar() (*big.Int, error) {
+	return rand.Int(rand.Reader, Curve().Params().N)
+}
+
+// for the proofs and signatures which can't fail otherwise
+func mustRandomScalar() *big.Int {
+	k, err := randomScalar()
+	if err != nil {
+		panic(err)
+	}
+	return k
+}
+
+// number of bits needed to index the ring, at least one
+func compactRingBits(size int) int {
+	m := 1
+	for 1<<uint(m) < size {
+		m++
+	}
+	return m
+}
+
+// ring padded to a power of two by repeating the last member, it doesn't give
+// away more information as the padding members are already in the ring
+func compactPaddedRing(L [][2]big.Int, m int) [][2]*big.Int {
+	ret := make([][2]*big.Int, 1<<uint(m))
+	for i := range ret {
+		k := i
+		if k >= len(L) {
+			k = len(L) - 1
+		}
+		ret[i] = [2]*big.Int{&L[k][0], &L[k][1]}
+	}
+	return ret
+}
+
+// polynomial product, coefficients in increasing degree
+func polyMul(a, b []*big.Int) []*big.Int {
+	n := Curve().Params().N
+
+	ret := make([]*big.Int, len(a)+len(b)-1)
+	for i := range ret {
+		ret[i] = new(big.Int)
+	}
+
+	for i, x := range a {
+		for j, y := range b {
+			ret[i+j].Add(ret[i+j], new(big.Int).Mul(x, y))
+			ret[i+j].Mod(ret[i+j], n)
+		}
+	}
+
+	return ret
+}
+
+func compactChallenge(pubKeys []byte, sig CompactRingSignature) *big.Int {
+	hash := sha256.New()
+	hash.Write(pubKeys)
+	hash.Write(sig.Tag[0].Bytes())
+	hash.Write(sig.Tag[1].Bytes())
+	hash.Write(sig.Message)
+
+	for _, points := range [][][2]*big.Int{sig.CL, sig.CA, sig.CB, sig.CD, sig.Q} {
+		for _, p := range points {
+			hash.Write(p[0].Bytes())
+			hash.Write(p[1].Bytes())
+		}
+	}
+
+	return new(big.Int).Mod(new(big.Int).SetBytes(hash.Sum(nil)), Curve().Params().N)
+}
+
+func compactRingSignature(msg []byte, L [][2]big.Int, tmpKey *ecdsa.PrivateKey, pos int) CompactRingSignature {
+	if pos >= len(L) || L[pos][0].Cmp(tmpKey.X) != 0 || L[pos][1].Cmp(tmpKey.Y) != 0 {
+		fmt.Println("Compact ring signature generation failed: public key not in L")
+		return CompactRingSignature{}
+	}
+
+	n := Curve().Params().N
+	m := compactRingBits(len(L))
+	ring := compactPaddedRing(L, m)
+
+	var pubKeys []byte
+	for _, keyPair := range L {
+		pubKeys = append(pubKeys, keyPair[0].Bytes()...)
+		pubKeys = append(pubKeys, keyPair[1].Bytes()...)
+	}
+
+	Hx, Hy := mapToPoint(pubKeys)
+	H := [2]*big.Int{Hx, Hy}
+
+	sig := CompactRingSignature{
+		Message: msg,
+		Tag:     pointMul(H, tmpKey.D),
+	}
+
+	bits := make([]*big.Int, m)
+	r := make([]*big.Int, m)
+	a := make([]*big.Int, m)
+	s := make([]*big.Int, m)
+	t := make([]*big.Int, m)
+
+	for j := 0; j < m; j++ {
+		bits[j] = big.NewInt(int64((pos >> uint(j)) & 1))
+		r[j], a[j], s[j], t[j] = mustRandomScalar(), mustRandomScalar(), mustRandomScalar(), mustRandomScalar()
+
+		sig.CL = append(sig.CL, pedersenCommit(bits[j], r[j]))
+		sig.CA = append(sig.CA, pedersenCommit(a[j], s[j]))
+		sig.CB = append(sig.CB, pedersenCommit(new(big.Int).Mul(bits[j], a[j]), t[j]))
+	}
+
+	// f[j][1](X) = bit_j*X + a_j, f[j][0](X) = (1-bit_j)*X - a_j
+	f := make([][2][]*big.Int, m)
+	for j := 0; j < m; j++ {
+		notBit := new(big.Int).Sub(big.NewInt(1), bits[j])
+		f[j][0] = []*big.Int{new(big.Int).Mod(new(big.Int).Neg(a[j]), n), notBit}
+		f[j][1] = []*big.Int{a[j], bits[j]}
+	}
+
+	// p_i(X) = prod_j f[j][i_j](X)
+	p := make([][]*big.Int, len(ring))
+	for i := range ring {
+		p[i] = []*big.Int{big.NewInt(1)}
+		for j := 0; j < m; j++ {
+			p[i] = polyMul(p[i], f[j][(i>>uint(j))&1])
+		}
+	}
+
+	rho := make([]*big.Int, m)
+	for k := 0; k < m; k++ {
+		rho[k] = mustRandomScalar()
+
+		cd := pointBaseMul(rho[k])
+		for i, member := range ring {
+			cd = pointAdd(cd, pointMul(member, p[i][k]))
+		}
+
+		sig.CD = append(sig.CD, cd)
+		sig.Q = append(sig.Q, pointMul(H, rho[k]))
+	}
+
+	x := compactChallenge(pubKeys, sig)
+
+	for j := 0; j < m; j++ {
+		fj := new(big.Int).Mul(bits[j], x)
+		fj.Add(fj, a[j]).Mod(fj, n)
+
+		za := new(big.Int).Mul(r[j], x)
+		za.Add(za, s[j]).Mod(za, n)
+
+		zb := new(big.Int).Sub(x, fj)
+		zb.Mul(zb, r[j]).Add(zb, t[j]).Mod(zb, n)
+
+		sig.F = append(sig.F, fj)
+		sig.ZA = append(sig.ZA, za)
+		sig.ZB = append(sig.ZB, zb)
+	}
+
+	// zd = privKey * x^m - sum_k rho_k * x^k
+	xk := big.NewInt(1)
+	zd := new(big.Int)
+	for k := 0; k < m; k++ {
+		zd.Sub(zd, new(big.Int).Mul(rho[k], xk))
+		xk = new(big.Int).Mod(new(big.Int).Mul(xk, x), n)
+	}
+	zd.Add(zd, new(big.Int).Mul(tmpKey.D, xk))
+	sig.ZD = zd.Mod(zd, n)
+
+	return sig
+}
+
+func verifyCompactSig(sig CompactRingSignature, L [][2]big.Int) bool {
+	n := Curve().Params().N
+	m := compactRingBits(len(L))
+
+	if len(L) == 0 || sig.ZD == nil || sig.Tag[0] == nil || sig.Tag[1] == nil ||
+		!Curve().IsOnCurve(sig.Tag[0], sig.Tag[1]) {
+		return false
+	}
+
+	for _, points := range [][][2]*big.Int{sig.CL, sig.CA, sig.CB, sig.CD, sig.Q} {
+		if len(points) != m {
+			return false
+		}
+		for _, p := range points {
+			if p[0] == nil || p[1] == nil || !Curve().IsOnCurve(p[0], p[1]) {
+				return false
+			}
+		}
+	}
+
+	for _, scalars := range [][]*big.Int{sig.F, sig.ZA, sig.ZB} {
+		if len(scalars) != m {
+			return false
+		}
+		for _, v := range scalars {
+			if v == nil || v.Cmp(n) >= 0 {
+				return false
+			}
+		}
+	}
+
+	var pubKeys []byte
+	for _, keyPair := range L {
+		pubKeys = append(pubKeys, keyPair[0].Bytes()...)
+		pubKeys = append(pubKeys, keyPair[1].Bytes()...)
+	}
+
+	Hx, Hy := mapToPoint(pubKeys)
+	H := [2]*big.Int{Hx, Hy}
+	Ux, Uy := compactU()
+	U := [2]*big.Int{Ux, Uy}
+
+	x := compactChallenge(pubKeys, sig)
+
+	// f[j][1] = F_j, f[j][0] = x - F_j
+	f := make([][2]*big.Int, m)
+	for j := 0; j < m; j++ {
+		xMinusF := new(big.Int).Sub(x, sig.F[j])
+		f[j] = [2]*big.Int{xMinusF.Mod(xMinusF, n), sig.F[j]}
+
+		// x*CL_j + CA_j == Com(F_j; ZA_j)
+		left := pointAdd(pointMul(sig.CL[j], x), sig.CA[j])
+		right := pointAdd(pointMul(U, sig.F[j]), pointBaseMul(sig.ZA[j]))
+		if !pointEqual(left, right) {
+			return false
+		}
+
+		// (x - F_j)*CL_j + CB_j == Com(0; ZB_j)
+		left = pointAdd(pointMul(sig.CL[j], f[j][0]), sig.CB[j])
+		if !pointEqual(left, pointBaseMul(sig.ZB[j])) {
+			return false
+		}
+	}
+
+	// sum_i p_i(x)*P_i - sum_k x^k*CD_k == Com(0; ZD)
+	// x^m*Tag - sum_k x^k*Q_k == ZD*H
+	sum := pointInfinity()
+	for i, member := range compactPaddedRing(L, m) {
+		pi := big.NewInt(1)
+		for j := 0; j < m; j++ {
+			pi.Mul(pi, f[j][(i>>uint(j))&1]).Mod(pi, n)
+		}
+		sum = pointAdd(sum, pointMul(member, pi))
+	}
+
+	xk := big.NewInt(1)
+	tagSum := pointInfinity()
+	for k := 0; k < m; k++ {
+		sum = pointAdd(sum, pointNeg(pointMul(sig.CD[k], xk)))
+		tagSum = pointAdd(tagSum, pointNeg(pointMul(sig.Q[k], xk)))
+		xk = new(big.Int).Mod(new(big.Int).Mul(xk, x), n)
+	}
+	tagSum = pointAdd(tagSum, pointMul(sig.Tag, xk))
+
+	return pointEqual(sum, pointBaseMul(sig.ZD)) && pointEqual(tagSum, pointMul(H, sig.ZD))
+}
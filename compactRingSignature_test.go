@@ -0,0 +1,132 @@
+package pollparty
+
+import (
+	"testing"
+)
+
+func TestVerifyGeneratedCompactSignature(t *testing.T) {
+	gossiper := DummyGossiper()
+
+	msg := []byte("Test input")
+
+	for _, numPubKey := range []int{1, 2, 3, 4, 5, 9} {
+		for pos := 0; pos < numPubKey; pos++ {
+			L := DummyPublicKeyArray(gossiper, pos, numPubKey)
+			crs := compactRingSignature(msg, L, &gossiper.KeyPair, pos)
+
+			if !verifyCompactSig(crs, L) {
+				t.Errorf("Unable to verify the generated signature, ring of %d, public key at position %d",
+					numPubKey, pos)
+			}
+		}
+	}
+}
+
+func TestVerifyInvalidCompactSignature(t *testing.T) {
+	gossiper := DummyGossiper()
+
+	msg := []byte("Test input")
+
+	pos := 2
+	numPubKey := 5
+	L := DummyPublicKeyArray(gossiper, pos, numPubKey)
+
+	crs := compactRingSignature(msg, L, &gossiper.KeyPair, pos)
+	crs.F[0] = crs.F[1] // messing with some values
+
+	if verifyCompactSig(crs, L) {
+		t.Errorf("Verified invalid signature")
+	}
+
+	crs = compactRingSignature(msg, L, &gossiper.KeyPair, pos)
+	crs.Message = []byte("Other input")
+
+	if verifyCompactSig(crs, L) {
+		t.Errorf("Verified signature for another message")
+	}
+
+	other := DummyPublicKeyArray(DummyGossiper(), pos, numPubKey)
+	crs = compactRingSignature(msg, L, &gossiper.KeyPair, pos)
+
+	if verifyCompactSig(crs, other) {
+		t.Errorf("Verified signature for another ring")
+	}
+}
+
+func TestCompactSignatureSmallerThanLinkable(t *testing.T) {
+	gossiper := DummyGossiper()
+
+	msg := []byte("Test input")
+
+	pos := 0
+	numPubKey := 64
+	L := DummyPublicKeyArray(gossiper, pos, numPubKey)
+
+	crs := compactRingSignature(msg, L, &gossiper.KeyPair, pos)
+	lrs := linkableRingSignature(msg, L, &gossiper.KeyPair, pos)
+
+	compactSize := 0
+	compact := crs.toWire()
+	for _, elems := range [][][]byte{compact.CL, compact.CA, compact.CB, compact.CD, compact.Q,
+		compact.F, compact.ZA, compact.ZB, {compact.ZD, compact.Tag}} {
+		for _, e := range elems {
+			compactSize += len(e)
+		}
+	}
+
+	linkableSize := 0
+	for _, s := range lrs.toWire().S {
+		linkableSize += len(s)
+	}
+
+	if compactSize >= linkableSize {
+		t.Errorf("Compact signature isn't smaller, got %d bytes against %d", compactSize, linkableSize)
+	}
+}
+
+func TestCompactSignatureLinksWithLinkable(t *testing.T) {
+	gossiper := DummyGossiper()
+
+	pos := 1
+	numPubKey := 3
+	L := DummyPublicKeyArray(gossiper, pos, numPubKey)
+
+	first := compactRingSignature([]byte("first"), L, &gossiper.KeyPair, pos)
+	second := compactRingSignature([]byte("second"), L, &gossiper.KeyPair, pos)
+	lrs := linkableRingSignature([]byte("third"), L, &gossiper.KeyPair, pos)
+
+	if !pointEqual(first.Tag, second.Tag) || !pointEqual(first.Tag, lrs.Tag) {
+		t.Errorf("Same signer in the same ring got different tags")
+	}
+}
+
+func TestCompactSignatureWireRoundTrip(t *testing.T) {
+	gossiper := DummyGossiper()
+
+	pos := 3
+	numPubKey := 6
+	L := DummyPublicKeyArray(gossiper, pos, numPubKey)
+
+	sig := ringSignature(CompactRing, []byte("Test input"), L, &gossiper.KeyPair, pos)
+
+	id := PollKey{gossiper.KeyPair.PublicKey, uint64(1)}
+	commit, _, err := NewCommitment(id, ringTag(L, &gossiper.KeyPair), []string{"Yes"}, "Yes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkg := PollPacket{ID: id, Commitment: &commit}
+	fromWire := *wireRoundTrip(t, GossipPacket{Poll: &pkg, Signature: &sig}).Signature
+
+	if !verifyRingSignature(fromWire, CompactRing, L) {
+		t.Errorf("Unable to verify the signature after encoding")
+	}
+
+	if fromWire.Digest() != sig.Digest() {
+		t.Errorf("Signature digest changed after encoding")
+	}
+
+	if verifyRingSignature(fromWire, LinkableRing, L) {
+		t.Errorf("Accepted a compact signature for a poll using linkable ones")
+	}
+}
@@ -0,0 +1,94 @@
+package pollparty
+
+import (
+	"errors"
+	"time"
+)
+
+// control messages are signed by the origin of the poll, they are the only
+// way to change a poll once it is started
+type ControlAction uint32
+
+const (
+	ControlCancel ControlAction = iota + 1 // the poll has no results
+	ControlClose                           // the key collection ends now
+	ControlExtend                          // the key collection lasts Duration
+)
+
+func ControlActionFromString(name string) (ControlAction, error) {
+	switch name {
+	case "cancel":
+		return ControlCancel, nil
+	case "close":
+		return ControlClose, nil
+	case "extend":
+		return ControlExtend, nil
+	}
+
+	return 0, errors.New("unknown control action \"" + name + "\"")
+}
+
+type PollControl struct {
+	Action   ControlAction
+	Issued   time.Time
+	Duration time.Duration // new duration of the poll, when extending
+}
+
+func NewPollControl(action ControlAction, duration time.Duration) PollControl {
+	return PollControl{
+		Action:   action,
+		Issued:   canonicalTime(time.Now()),
+		Duration: duration,
+	}
+}
+
+func (c PollControl) check() error {
+	if c.Action < ControlCancel || c.Action > ControlExtend {
+		return errors.New("PollControl: unknown action")
+	}
+
+	if c.Action == ControlExtend && c.Duration <= 0 {
+		return errors.New("PollControl: extending without duration")
+	}
+
+	return nil
+}
+
+func (c PollControl) equal(other PollControl) bool {
+	return c.Action == other.Action && c.Issued.Equal(other.Issued) && c.Duration == other.Duration
+}
+
+func (info ShareablePollInfo) Cancelled() bool {
+	for _, c := range info.Controls {
+		if c.Action == ControlCancel {
+			return true
+		}
+	}
+
+	return false
+}
+
+// end of the key collection, with the controls of the origin applied: the
+// longest extension counts, an early close stops it when it was issued
+func (info ShareablePollInfo) Deadline() time.Time {
+	duration := info.Poll.Duration
+	for _, c := range info.Controls {
+		if c.Action == ControlExtend && c.Duration > duration {
+			duration = c.Duration
+		}
+	}
+
+	ret := info.Poll.StartTime.Add(duration)
+	for _, c := range info.Controls {
+		if c.Action == ControlClose && c.Issued.Before(ret) {
+			ret = c.Issued
+		}
+	}
+
+	return ret
+}
+
+// commitments are accepted for a network convergence after the keys
+func (info ShareablePollInfo) commitDeadline() time.Time {
+	return info.Deadline().Add(NetworkConvergeDuration)
+}
@@ -0,0 +1,117 @@
+package pollparty
+
+import (
+	"crypto/ecdsa"
+	"testing"
+	"time"
+)
+
+func TestPollControlDeadline(t *testing.T) {
+	poll := DummyPoll()
+	info := ShareablePollInfo{Poll: *poll}
+
+	if !info.Deadline().Equal(poll.StartTime.Add(poll.Duration)) {
+		t.Errorf("Deadline without control isn't the one of the poll")
+	}
+
+	info.Controls = append(info.Controls, PollControl{Action: ControlExtend, Issued: time.Now(), Duration: 2 * time.Hour})
+	info.Controls = append(info.Controls, PollControl{Action: ControlExtend, Issued: time.Now(), Duration: 90 * time.Minute})
+	if !info.Deadline().Equal(poll.StartTime.Add(2 * time.Hour)) {
+		t.Errorf("Longest extension not applied")
+	}
+
+	closed := time.Now()
+	info.Controls = append(info.Controls, PollControl{Action: ControlClose, Issued: closed})
+	if !info.Deadline().Equal(closed) {
+		t.Errorf("Early close not applied")
+	}
+
+	info.Votes = append(info.Votes, Vote{Option: "Yes"})
+	if info.Cancelled() || info.Results()["Yes"] != 1 {
+		t.Errorf("Poll cancelled without control")
+	}
+
+	info.Controls = append(info.Controls, NewPollControl(ControlCancel, 0))
+	if !info.Cancelled() || len(info.Results()) != 0 {
+		t.Errorf("Cancelled poll still has results")
+	}
+}
+
+func TestPollControlOverDispatcher(t *testing.T) {
+	g := DummyGossiper()
+	dispatch := DispatcherPeersterMessage(g)
+	peer := *parseAddr("127.0.0.1:5001")
+
+	origin := DummyGossiper()
+	id := PollKey{origin.KeyPair.PublicKey, uint64(1)}
+	g.RunningPolls.Add(id, drainHandler)
+	g.Polls.Store(PollPacket{ID: id, Poll: DummyPoll()})
+
+	send := func(control PollControl, signer *Gossiper) {
+		pkg := PollPacket{ID: id, Control: &control}
+		sig, err := ecSignature(signer, pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dispatch(peer, wireRoundTrip(t, GossipPacket{Poll: &pkg, Signature: &sig}))
+	}
+
+	send(NewPollControl(ControlCancel, 0), g)
+	if g.Polls.Get(id).Cancelled() || g.Reputations.Opinions[peer.String()] != -1 {
+		t.Errorf("Accepted a control not signed by the origin")
+	}
+
+	extend := NewPollControl(ControlExtend, 2*time.Hour)
+	send(extend, origin)
+	send(extend, origin)
+
+	info := g.Polls.Get(id)
+	if len(info.Controls) != 1 || !info.Controls[0].equal(extend) {
+		t.Fatalf("Expected the extension to be stored once, got %d controls", len(info.Controls))
+	}
+
+	if !info.Deadline().Equal(info.Poll.StartTime.Add(2 * time.Hour)) {
+		t.Errorf("Extension changed on the wire")
+	}
+}
+
+func TestConflictingPollBodyIgnored(t *testing.T) {
+	g := DummyGossiper()
+	id := PollKey{g.KeyPair.PublicKey, uint64(1)}
+
+	first := DummyPoll()
+	if !g.Polls.Store(PollPacket{ID: id, Poll: first}) {
+		t.Fatalf("First poll body not stored")
+	}
+
+	second := DummyPoll()
+	second.Question = "Do you like cats?"
+	if g.Polls.Store(PollPacket{ID: id, Poll: second}) || g.Polls.Get(id).Poll.Question != first.Question {
+		t.Errorf("Poll body overwritten")
+	}
+}
+
+func TestMasterHandlerCancelled(t *testing.T) {
+	g := DummyGossiper()
+	poll := DummyPoll()
+	id := NewPollKey(g, *poll)
+
+	done := make(chan bool)
+	g.RunningPolls.Add(id, func(id PollKey, key ecdsa.PrivateKey, r RunningPollReader) {
+		MasterHandler(g)(id, key, r)
+		close(done)
+	})
+
+	g.Polls.Store(PollPacket{ID: id, Poll: poll})
+	g.RunningPolls.Send(PollPacket{ID: id, Poll: poll}, nil)
+
+	cancel := NewPollControl(ControlCancel, 0)
+	g.SendPollControl(id, cancel)
+	g.RunningPolls.Send(PollPacket{ID: id, Control: &cancel}, nil)
+
+	select {
+	case <-done:
+	case <-time.After(NetworkConvergeDuration):
+		t.Errorf("Master handler still running after cancellation")
+	}
+}
@@ -0,0 +1,218 @@
+package pollparty
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	secrand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	CookieSize     = sha256.Size
+	CookieLifetime = 2 * time.Minute // cookies of the previous period are still valid
+	MaxCookies     = 4096            // received from peers, forgotten all at once past it
+	StatusBudget   = 32              // packets sent back for one status, the rest waits for the next one
+)
+
+// a status can ask for every packet we have, we only answer it once its
+// sender showed it gets the packets sent to its address: it has to give us
+// back the cookie we sent there. Cookies are derived from the address so we
+// don't keep anything for the addresses we never heard of again. The nonces
+// of our statuses are derived the same way, a cookie is only kept if it
+// echoes the one we sent to its address.
+type Cookies struct {
+	sync.RWMutex
+	secret   []byte
+	received map[string][]byte // the cookies peers gave us, by address
+}
+
+func NewCookies() Cookies {
+	secret := make([]byte, sha256.Size)
+	_, err := secrand.Read(secret)
+	if err != nil {
+		panic(err)
+	}
+
+	return Cookies{
+		secret:   secret,
+		received: make(map[string][]byte),
+	}
+}
+
+func (c *Cookies) of(peer string, epoch int64) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(peer))
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(epoch))
+	mac.Write(buf[:])
+
+	return mac.Sum(nil)
+}
+
+func cookieEpoch(now time.Time) int64 {
+	return now.UnixNano() / int64(CookieLifetime)
+}
+
+// the cookie to send to the address of peer
+func (c *Cookies) Issue(peer string, now time.Time) []byte {
+	return c.of(peer, cookieEpoch(now))
+}
+
+func (c *Cookies) Valid(peer string, cookie []byte, now time.Time) bool {
+	epoch := cookieEpoch(now)
+	return hmac.Equal(cookie, c.of(peer, epoch)) || hmac.Equal(cookie, c.of(peer, epoch-1))
+}
+
+// the nonce of our status to peer
+func (c *Cookies) Nonce(peer string, now time.Time) []byte {
+	return c.Issue("nonce:"+peer, now)
+}
+
+// keeps the cookie of peer if it answers one of our statuses, false if not
+func (c *Cookies) Store(peer string, pkg CookiePacket, now time.Time) bool {
+	if !c.Valid("nonce:"+peer, pkg.Nonce, now) {
+		return false
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if _, ok := c.received[peer]; !ok && len(c.received) >= MaxCookies {
+		c.received = make(map[string][]byte)
+	}
+
+	c.received[peer] = pkg.Cookie
+	return true
+}
+
+// the cookie peer gave us, nil if none
+func (c *Cookies) Received(peer string) []byte {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.received[peer]
+}
+
+func sortedDigests(set map[PacketDigest]bool) []PacketDigest {
+	digests := make([]PacketDigest, 0, len(set))
+	for d := range set {
+		digests = append(digests, d)
+	}
+
+	sort.Slice(digests, func(i, j int) bool {
+		return bytes.Compare(digests[i][:], digests[j][:]) < 0
+	})
+
+	return digests
+}
+
+// the digests are sorted, the maps of the status come in any order
+func (s StatusPacket) hash() []byte {
+	hash := sha256.New()
+
+	for _, set := range []map[PacketDigest]bool{s.PollPkts, s.ReputationPkts} {
+		var count [8]byte
+		binary.BigEndian.PutUint64(count[:], uint64(len(set)))
+		hash.Write(count[:])
+
+		for _, d := range sortedDigests(set) {
+			hash.Write(d[:])
+		}
+	}
+
+	signer := PublicKeyWireFromEcdsa(s.Signer)
+	for _, b := range [][]byte{signer.X, signer.Y, s.Cookie, s.Nonce} {
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(len(b)))
+		hash.Write(size[:])
+		hash.Write(b)
+	}
+
+	return hash.Sum(nil)
+}
+
+func statusSignature(key ecdsa.PrivateKey, s StatusPacket) (Signature, error) {
+	r, sig, err := ecdsa.Sign(secrand.Reader, &key, s.hash())
+	if err != nil {
+		return Signature{}, err
+	}
+
+	return Signature{Elliptic: &EllipticCurveSignature{*r, *sig}}, nil
+}
+
+func statusSignatureValid(pkg GossipPacket) bool {
+	if pkg.Signature == nil || pkg.Signature.Elliptic == nil || pkg.Status.Signer.X == nil {
+		return false
+	}
+
+	return ecdsa.Verify(&pkg.Status.Signer, pkg.Status.hash(),
+		&pkg.Signature.Elliptic.R, &pkg.Signature.Elliptic.S)
+}
+
+// our status, signed with the cookie peer gave us if any
+func (g *Gossiper) sendStatus(peer *net.UDPAddr) {
+	status := getStatus(g)
+	status.Cookie = g.Cookies.Received(peer.String())
+	status.Nonce = g.Cookies.Nonce(peer.String(), time.Now())
+
+	sig, err := statusSignature(g.KeyPair, status)
+	if err != nil {
+		log.Println("unable to sign status:", err)
+		return
+	}
+
+	writeMsgToUDP(g.Server, peer, nil, &status, &sig, nil)
+}
+
+// the sender of a status without our cookie only gets one, smaller than
+// the status, so a spoofed address gets nothing worth it. The checks go
+// from the cheapest to the signature.
+func (g *Gossiper) handleStatus(fromPeer net.UDPAddr, pkg GossipPacket) {
+	peer := fromPeer.String()
+	status := *pkg.Status
+
+	if !g.Cookies.Valid(peer, status.Cookie, time.Now()) {
+		if len(status.Nonce) == 0 {
+			return // the cookie would be dropped anyway
+		}
+		cookie := CookiePacket{Cookie: g.Cookies.Issue(peer, time.Now()), Nonce: status.Nonce}
+		writePacketToUDP(g.Server, &fromPeer, GossipPacket{Cookie: &cookie})
+		return
+	}
+
+	// the address is reachable but another one might have signed for it
+	if !statusSignatureValid(pkg) {
+		log.Println("invalid status signature from " + peer)
+		g.Reputations.Offend(peer, OffenceInvalidSignature, nil)
+		return
+	}
+
+	_, valid := containsKey(g.ValidKeys, status.Signer)
+	if len(g.ValidKeys) > 0 && !valid {
+		log.Println("status signed by an unknown key from " + peer)
+		return
+	}
+
+	// opinions of a valid key are now known by the address
+	if valid {
+		g.Reputations.BindAddress(peer, status.Signer)
+	}
+
+	g.addPeer(fromPeer)
+	syncStatus(g, fromPeer, status, StatusBudget)
+}
+
+// cookies are never answered, only kept for our next status
+func (g *Gossiper) handleCookie(fromPeer net.UDPAddr, pkg GossipPacket) {
+	if !g.Cookies.Store(fromPeer.String(), *pkg.Cookie, time.Now()) {
+		log.Println("cookie from " + fromPeer.String() + " answering none of our statuses, drop it")
+	}
+}
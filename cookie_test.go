@@ -0,0 +1,242 @@
+package pollparty
+
+import (
+	"crypto/ecdsa"
+	crypto "crypto/rand"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dedis/protobuf"
+)
+
+// a gossiper listening on loopback, with more packets than one status gets
+func statusServer(t *testing.T) *Gossiper {
+	key, err := ecdsa.GenerateKey(Curve(), crypto.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newGossiper("server", *key, make([][2]big.Int, 0), NewServer("127.0.0.1:0"))
+
+	for i := 0; i < 2*StatusBudget; i++ {
+		pkg := PollPacket{ID: PollKey{g.KeyPair.PublicKey, uint64(i)}, Poll: DummyPoll()}
+		sig, err := ecSignatureBy(g.KeyPair, pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signed := GossipPacket{Poll: &pkg, Signature: &sig}
+		g.Status.SetPkt(packetDigest(t, signed), signed)
+	}
+
+	return g
+}
+
+// what the conn gets until nothing comes for a while
+func readPackets(t *testing.T, conn *net.UDPConn) []GossipPacket {
+	var packets []GossipPacket
+	buf := make([]byte, 65536)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return packets
+		}
+
+		var msg GossipPacketWire
+		if err := protobuf.Decode(buf[:n], &msg); err != nil {
+			t.Fatal(err)
+		}
+		packets = append(packets, msg.ToBase())
+	}
+}
+
+func signedStatus(t *testing.T, key ecdsa.PrivateKey, cookie []byte) GossipPacket {
+	status := StatusPacket{
+		PollPkts:       make(map[PacketDigest]bool),
+		ReputationPkts: make(map[PacketDigest]bool),
+		Signer:         key.PublicKey,
+		Cookie:         cookie,
+		Nonce:          make([]byte, CookieSize),
+	}
+
+	sig, err := statusSignature(key, status)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return wireRoundTrip(t, GossipPacket{Status: &status, Signature: &sig})
+}
+
+func TestStatusCookie(t *testing.T) {
+	g := statusServer(t)
+	defer g.Server.Conn.Close()
+
+	conn := localConn(t)
+	defer conn.Close()
+	from := *conn.LocalAddr().(*net.UDPAddr)
+
+	key, err := ecdsa.GenerateKey(Curve(), crypto.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only a cookie for a status without one
+	g.handleStatus(from, signedStatus(t, *key, nil))
+	packets := readPackets(t, conn)
+	if len(packets) != 1 || packets[0].Cookie == nil {
+		t.Fatalf("Expected a cookie only, got %d packets", len(packets))
+	}
+	if g.Peers.Set[from.String()] {
+		t.Errorf("Peer added before its address was checked")
+	}
+
+	// the cookie of another address is worth nothing
+	if g.Cookies.Valid("127.0.0.1:1", packets[0].Cookie.Cookie, time.Now()) {
+		t.Errorf("Cookie valid for another address")
+	}
+
+	g.handleStatus(from, signedStatus(t, *key, packets[0].Cookie.Cookie))
+	packets = readPackets(t, conn)
+	if len(packets) != StatusBudget {
+		t.Errorf("Expected %d packets, got %d", StatusBudget, len(packets))
+	}
+	for _, pkg := range packets {
+		if pkg.Poll == nil || !g.SignatureValid(pkg) {
+			t.Fatalf("Expected the stored polls")
+		}
+	}
+	if !g.Peers.Set[from.String()] {
+		t.Errorf("Peer not added once checked")
+	}
+}
+
+func TestStatusSignature(t *testing.T) {
+	g := statusServer(t)
+	defer g.Server.Conn.Close()
+
+	conn := localConn(t)
+	defer conn.Close()
+	from := *conn.LocalAddr().(*net.UDPAddr)
+	cookie := g.Cookies.Issue(from.String(), time.Now())
+
+	key, err := ecdsa.GenerateKey(Curve(), crypto.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(Curve(), crypto.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// signed by one key for another
+	forged := signedStatus(t, *key, cookie)
+	forged.Status.Signer = other.PublicKey
+	g.handleStatus(from, forged)
+	if packets := readPackets(t, conn); len(packets) != 0 {
+		t.Errorf("Expected nothing for an invalid signature, got %d packets", len(packets))
+	}
+
+	// not one of the known keys
+	g.ValidKeys = [][2]big.Int{{*other.X, *other.Y}}
+	g.handleStatus(from, signedStatus(t, *key, cookie))
+	if packets := readPackets(t, conn); len(packets) != 0 {
+		t.Errorf("Expected nothing for an unknown key, got %d packets", len(packets))
+	}
+
+	// without valid keys, the address isn't bound
+	g.ValidKeys = nil
+	g.handleStatus(from, signedStatus(t, *key, cookie))
+	if packets := readPackets(t, conn); len(packets) != StatusBudget {
+		t.Errorf("Expected %d packets, got %d", StatusBudget, len(packets))
+	}
+	if _, bound := g.Reputations.Addresses[from.String()]; bound {
+		t.Errorf("Address bound to a key which isn't a valid one")
+	}
+
+	// the address is the one of the last verified valid key
+	g.ValidKeys = [][2]big.Int{{*key.X, *key.Y}, {*other.X, *other.Y}}
+	g.handleStatus(from, signedStatus(t, *key, cookie))
+	if packets := readPackets(t, conn); len(packets) != StatusBudget {
+		t.Errorf("Expected %d packets, got %d", StatusBudget, len(packets))
+	}
+	if g.Reputations.Addresses[from.String()] != signerKey(key.PublicKey) {
+		t.Errorf("Address not bound once its status was verified")
+	}
+	g.handleStatus(from, signedStatus(t, *other, cookie))
+	if packets := readPackets(t, conn); len(packets) != StatusBudget {
+		t.Errorf("Expected %d packets for the new key of the address, got %d", StatusBudget, len(packets))
+	}
+	if g.Reputations.Addresses[from.String()] != signerKey(other.PublicKey) {
+		t.Errorf("Address not bound to the key of the last verified status")
+	}
+}
+
+func TestCookieNonce(t *testing.T) {
+	g := statusServer(t)
+	defer g.Server.Conn.Close()
+
+	peer := statusServer(t)
+	defer peer.Server.Conn.Close()
+
+	from := *peer.Server.Conn.LocalAddr().(*net.UDPAddr)
+	to := *g.Server.Conn.LocalAddr().(*net.UDPAddr)
+
+	// not answering any status of ours
+	cookie := CookiePacket{Cookie: make([]byte, CookieSize), Nonce: make([]byte, CookieSize)}
+	g.handleCookie(from, GossipPacket{Cookie: &cookie})
+	if g.Cookies.Received(from.String()) != nil {
+		t.Errorf("Stored a cookie we never asked for")
+	}
+
+	// echoing the nonce of our status to another address
+	cookie.Nonce = g.Cookies.Nonce("127.0.0.1:1", time.Now())
+	g.handleCookie(from, GossipPacket{Cookie: &cookie})
+	if g.Cookies.Received(from.String()) != nil {
+		t.Errorf("Stored a cookie answering a status to another address")
+	}
+
+	// the peer answers our status, the next one carries its cookie
+	status := getStatus(g)
+	status.Nonce = g.Cookies.Nonce(from.String(), time.Now())
+	sig, err := statusSignature(g.KeyPair, status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer.handleStatus(to, wireRoundTrip(t, GossipPacket{Status: &status, Signature: &sig}))
+
+	packets := readPackets(t, g.Server.Conn)
+	if len(packets) != 1 || packets[0].Cookie == nil {
+		t.Fatalf("Expected a cookie, got %d packets", len(packets))
+	}
+	g.handleCookie(from, packets[0])
+	if !peer.Cookies.Valid(to.String(), g.Cookies.Received(from.String()), time.Now()) {
+		t.Errorf("Cookie answering our status not stored")
+	}
+}
+
+func TestStatusWireRoundTrip(t *testing.T) {
+	key, err := ecdsa.GenerateKey(Curve(), crypto.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkg := signedStatus(t, *key, make([]byte, CookieSize))
+	pkg.Status.PollPkts[PacketDigest{1}] = true
+	pkg.Status.PollPkts[PacketDigest{2}] = true
+	sig, err := statusSignature(*key, *pkg.Status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg.Signature = &sig
+
+	if !statusSignatureValid(wireRoundTrip(t, pkg)) {
+		t.Errorf("Status signature lost on the wire")
+	}
+
+	unsigned := GossipPacket{Status: pkg.Status}.ToWire()
+	if unsigned.Check() == nil {
+		t.Errorf("Status without signature accepted")
+	}
+}
@@ -0,0 +1,370 @@
+package pollparty
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+)
+
+// Pedersen's distributed key generation, with Feldman commitments, among the
+// trustees of a poll.
+//
+// Every trustee deals the shares of a random polynomial of degree
+// Threshold-1, each share being encrypted with the ECDH key between the
+// dealer and its recipient. A trustee getting a share not matching the
+// commitments complains by revealing this ECDH key with a proof, so that
+// anybody can check the complaint and disqualify the dealer. The poll key is
+// the sum of the secrets of the qualified dealers, and any Threshold trustees
+// can use it.
+
+const dkgShareSize = 32
+
+type DKGDeal struct {
+	Dealer      int           // position in Poll.Trustees
+	Commitments [][2]*big.Int // a_k*G for each coefficient of the polynomial
+	Shares      [][]byte      // f(j+1) for the trustee j, encrypted
+}
+
+type DKGComplaint struct {
+	Dealer  int
+	Accuser int
+	Key     [2]*big.Int // ECDH key between the dealer and the accuser
+	Proof   DLProof     // Key was computed with the secret of the accuser
+}
+
+type DKGOutcome struct {
+	Qualified   []int         // dealers whose secret is part of the key
+	Commitments [][2]*big.Int // sum of the commitments of the qualified dealers
+}
+
+func (p Poll) trusteeKeys() [][2]*big.Int {
+	ret := make([][2]*big.Int, len(p.Trustees))
+	for i, t := range p.Trustees {
+		pub := t.toEcdsa()
+		ret[i] = [2]*big.Int{pub.X, pub.Y}
+	}
+	return ret
+}
+
+func (p Poll) trusteeIndex(pub ecdsa.PublicKey) (int, bool) {
+	for i, t := range p.trusteeKeys() {
+		if t[0].Cmp(pub.X) == 0 && t[1].Cmp(pub.Y) == 0 {
+			return i, true
+		}
+	}
+
+	return -1, false
+}
+
+// trustees have to be distinct valid keys and enough to reach the threshold
+func (p Poll) dkgValid() bool {
+	if len(p.Trustees) == 0 || p.Threshold < 1 || p.Threshold > len(p.Trustees) {
+		return false
+	}
+
+	keys := p.trusteeKeys()
+	for i, k := range keys {
+		if !Curve().IsOnCurve(k[0], k[1]) {
+			return false
+		}
+		for _, other := range keys[:i] {
+			if pointEqual(k, other) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// trustees of a received poll have to be known keys, a homomorphic tally
+// can't be decrypted without them
+func (p Poll) trusteesValid(validKeys [][2]big.Int) bool {
+	if len(p.Trustees) == 0 {
+		return p.Tally != TallyHomomorphic
+	}
+
+	if !p.dkgValid() {
+		return false
+	}
+
+	for _, t := range p.Trustees {
+		if _, ok := containsKey(validKeys, t.toEcdsa()); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func dkgSharePad(id PollKey, dealer, recipient int, key [2]*big.Int) []byte {
+	var indexes [16]byte
+	binary.BigEndian.PutUint64(indexes[:8], uint64(dealer))
+	binary.BigEndian.PutUint64(indexes[8:], uint64(recipient))
+
+	hash := sha256.New()
+	hash.Write(tallyContext(id, "dkg share"))
+	hash.Write(indexes[:])
+	hash.Write(key[0].Bytes())
+	hash.Write(key[1].Bytes())
+	return hash.Sum(nil)
+}
+
+func xorShare(share, pad []byte) []byte {
+	ret := make([]byte, dkgShareSize)
+	for i := range ret {
+		ret[i] = share[i] ^ pad[i]
+	}
+	return ret
+}
+
+// f(x) for the polynomial with the given coefficients
+func evalPolynomial(coefs []*big.Int, x int) *big.Int {
+	n := Curve().Params().N
+	bx := big.NewInt(int64(x))
+
+	ret := new(big.Int)
+	for k := len(coefs) - 1; k >= 0; k-- {
+		ret.Mul(ret, bx).Add(ret, coefs[k]).Mod(ret, n)
+	}
+	return ret
+}
+
+// sum_k x^k*C_k, the public counterpart of f(x)
+func evalCommitments(commitments [][2]*big.Int, x int) [2]*big.Int {
+	bx := big.NewInt(int64(x))
+
+	ret := pointInfinity()
+	for k := len(commitments) - 1; k >= 0; k-- {
+		ret = pointAdd(pointMul(ret, bx), commitments[k])
+	}
+	return ret
+}
+
+func NewDKGDeal(id PollKey, poll Poll, key ecdsa.PrivateKey) (DKGDeal, error) {
+	dealer, ok := poll.trusteeIndex(key.PublicKey)
+	if !ok || !poll.dkgValid() {
+		return DKGDeal{}, errors.New("not a trustee of this poll")
+	}
+
+	var err error
+	coefs := make([]*big.Int, poll.Threshold)
+	ret := DKGDeal{
+		Dealer: dealer,
+	}
+
+	for k := range coefs {
+		coefs[k], err = randomScalar()
+		if err != nil {
+			return DKGDeal{}, err
+		}
+		ret.Commitments = append(ret.Commitments, pointBaseMul(coefs[k]))
+	}
+
+	for j, recipient := range poll.trusteeKeys() {
+		share := evalPolynomial(coefs, j+1).FillBytes(make([]byte, dkgShareSize))
+		pad := dkgSharePad(id, dealer, j, pointMul(recipient, key.D))
+		ret.Shares = append(ret.Shares, xorShare(share, pad))
+	}
+
+	return ret, nil
+}
+
+func (d DKGDeal) wellFormed(poll Poll) bool {
+	if d.Dealer < 0 || d.Dealer >= len(poll.Trustees) ||
+		len(d.Commitments) != poll.Threshold || len(d.Shares) != len(poll.Trustees) {
+		return false
+	}
+
+	for _, c := range d.Commitments {
+		if c[0] == nil || c[1] == nil || !Curve().IsOnCurve(c[0], c[1]) {
+			return false
+		}
+	}
+
+	for _, s := range d.Shares {
+		if len(s) != dkgShareSize {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (d DKGDeal) Digest() [sha256.Size]byte {
+	hash := sha256.New()
+	hash.Write([]byte{byte(d.Dealer)})
+
+	for _, c := range d.Commitments {
+		hash.Write(c[0].Bytes())
+		hash.Write(c[1].Bytes())
+	}
+
+	for _, s := range d.Shares {
+		hash.Write(s)
+	}
+
+	var ret [sha256.Size]byte
+	copy(ret[:], hash.Sum(nil))
+	return ret
+}
+
+// decrypts the share of the recipient with the ECDH key, returns false if it
+// doesn't match the commitments
+func (d DKGDeal) openShare(id PollKey, recipient int, key [2]*big.Int) (*big.Int, bool) {
+	share := new(big.Int).SetBytes(xorShare(d.Shares[recipient], dkgSharePad(id, d.Dealer, recipient, key)))
+	if share.Cmp(Curve().Params().N) >= 0 {
+		return nil, false
+	}
+
+	return share, pointEqual(pointBaseMul(share), evalCommitments(d.Commitments, recipient+1))
+}
+
+// share of the trustee owning key, if valid
+func (d DKGDeal) Share(id PollKey, poll Poll, key ecdsa.PrivateKey) (*big.Int, bool) {
+	recipient, ok := poll.trusteeIndex(key.PublicKey)
+	if !ok || !d.wellFormed(poll) {
+		return nil, false
+	}
+
+	dealer := poll.trusteeKeys()[d.Dealer]
+	return d.openShare(id, recipient, pointMul(dealer, key.D))
+}
+
+func NewDKGComplaint(id PollKey, poll Poll, key ecdsa.PrivateKey, deal DKGDeal) DKGComplaint {
+	accuser, _ := poll.trusteeIndex(key.PublicKey)
+	dealer := poll.trusteeKeys()[deal.Dealer]
+	ecdh := pointMul(dealer, key.D)
+
+	return DKGComplaint{
+		Dealer:  deal.Dealer,
+		Accuser: accuser,
+		Key:     ecdh,
+		Proof: proveDL(key.D, [][2]*big.Int{pointBase(), dealer},
+			[][2]*big.Int{{key.X, key.Y}, ecdh}, tallyContext(id, "dkg complaint")),
+	}
+}
+
+// a complaint is justified if the revealed key is the right one and the share
+// it decrypts doesn't match the commitments of the deal
+func (c DKGComplaint) Justified(id PollKey, poll Poll, deal DKGDeal) bool {
+	if c.Dealer != deal.Dealer || c.Accuser < 0 || c.Accuser >= len(poll.Trustees) ||
+		c.Accuser == c.Dealer || !deal.wellFormed(poll) {
+		return false
+	}
+
+	keys := poll.trusteeKeys()
+	if c.Key[0] == nil || c.Key[1] == nil || !c.Proof.verify([][2]*big.Int{pointBase(), keys[c.Dealer]},
+		[][2]*big.Int{keys[c.Accuser], c.Key}, tallyContext(id, "dkg complaint")) {
+		return false
+	}
+
+	_, valid := deal.openShare(id, c.Accuser, c.Key)
+	return !valid
+}
+
+// qualifies every dealer which sent a single deal without justified
+// complaint, the outcome is only valid with at least Threshold of them
+func computeDKGOutcome(id PollKey, poll Poll, deals []DKGDeal, complaints []DKGComplaint) (DKGOutcome, bool) {
+	if !poll.dkgValid() {
+		return DKGOutcome{}, false
+	}
+
+	byDealer := make(map[int][]DKGDeal)
+	for _, d := range deals {
+		if d.wellFormed(poll) {
+			byDealer[d.Dealer] = append(byDealer[d.Dealer], d)
+		}
+	}
+
+	ret := DKGOutcome{
+		Qualified:   make([]int, 0),
+		Commitments: make([][2]*big.Int, poll.Threshold),
+	}
+	for k := range ret.Commitments {
+		ret.Commitments[k] = pointInfinity()
+	}
+
+	for dealer := range poll.Trustees {
+		dealt := byDealer[dealer]
+		if len(dealt) != 1 { // missing or equivocating
+			continue
+		}
+
+		qualified := true
+		for _, c := range complaints {
+			if c.Dealer == dealer && c.Justified(id, poll, dealt[0]) {
+				qualified = false
+			}
+		}
+
+		if !qualified {
+			continue
+		}
+
+		ret.Qualified = append(ret.Qualified, dealer)
+		for k, c := range dealt[0].Commitments {
+			ret.Commitments[k] = pointAdd(ret.Commitments[k], c)
+		}
+	}
+
+	return ret, len(ret.Qualified) >= poll.Threshold
+}
+
+func (o DKGOutcome) PublicKey() [2]*big.Int {
+	return o.Commitments[0]
+}
+
+// public counterpart of the secret share of the given trustee
+func (o DKGOutcome) PublicShare(trustee int) [2]*big.Int {
+	return evalCommitments(o.Commitments, trustee+1)
+}
+
+// secret share of the trustee owning key, sum of the shares of the qualified
+// dealers
+func (o DKGOutcome) SecretShare(id PollKey, poll Poll, deals []DKGDeal, key ecdsa.PrivateKey) (*big.Int, bool) {
+	n := Curve().Params().N
+	ret := new(big.Int)
+
+	for _, dealer := range o.Qualified {
+		found := false
+		for _, d := range deals {
+			if d.Dealer != dealer {
+				continue
+			}
+
+			share, ok := d.Share(id, poll, key)
+			if !ok {
+				return nil, false
+			}
+			ret.Add(ret, share).Mod(ret, n)
+			found = true
+			break
+		}
+
+		if !found {
+			return nil, false
+		}
+	}
+
+	return ret, true
+}
+
+// coefficient of the given trustee to interpolate at zero with the others
+func lagrangeCoefficient(trustee int, trustees []int) *big.Int {
+	n := Curve().Params().N
+	num, den := big.NewInt(1), big.NewInt(1)
+
+	for _, other := range trustees {
+		if other == trustee {
+			continue
+		}
+
+		num.Mul(num, big.NewInt(int64(other+1))).Mod(num, n)
+		den.Mul(den, big.NewInt(int64(other-trustee))).Mod(den, n)
+	}
+
+	return num.Mul(num, den.ModInverse(den, n)).Mod(num, n)
+}
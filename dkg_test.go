@@ -0,0 +1,401 @@
+package pollparty
+
+import (
+	"crypto/ecdsa"
+	crypto "crypto/rand"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func dummyDKGPoll(t *testing.T, numTrustees, threshold int) (PollKey, Poll, []*ecdsa.PrivateKey) {
+	g := DummyGossiper()
+	id := PollKey{g.KeyPair.PublicKey, uint64(1)}
+
+	poll := *DummyPoll()
+	poll.Threshold = threshold
+
+	keys := make([]*ecdsa.PrivateKey, numTrustees)
+	for i := range keys {
+		var err error
+		keys[i], err = ecdsa.GenerateKey(Curve(), crypto.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		poll.Trustees = append(poll.Trustees, PublicKeyWireFromEcdsa(keys[i].PublicKey))
+	}
+
+	return id, poll, keys
+}
+
+// every trustee checks the deals of the others and complains like dkgHandler
+func simulateDKGComplaints(id PollKey, poll Poll, keys []*ecdsa.PrivateKey, deals []DKGDeal) []DKGComplaint {
+	complaints := make([]DKGComplaint, 0)
+
+	for j, key := range keys {
+		for _, d := range deals {
+			if d.Dealer == j {
+				continue
+			}
+			if _, ok := d.Share(id, poll, *key); !ok {
+				complaints = append(complaints, NewDKGComplaint(id, poll, *key, d))
+			}
+		}
+	}
+
+	return complaints
+}
+
+func honestDeals(t *testing.T, id PollKey, poll Poll, keys []*ecdsa.PrivateKey) []DKGDeal {
+	deals := make([]DKGDeal, len(keys))
+	for i, key := range keys {
+		var err error
+		deals[i], err = NewDKGDeal(id, poll, *key)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return deals
+}
+
+// any threshold trustees should be able to use the key
+func checkDKGShares(t *testing.T, id PollKey, poll Poll, keys []*ecdsa.PrivateKey, deals []DKGDeal, outcome DKGOutcome) {
+	shares := make([]*big.Int, len(keys))
+	for j, key := range keys {
+		var ok bool
+		shares[j], ok = outcome.SecretShare(id, poll, deals, *key)
+		if !ok {
+			t.Fatalf("Trustee %d unable to compute its share", j)
+		}
+
+		if !pointEqual(pointBaseMul(shares[j]), outcome.PublicShare(j)) {
+			t.Errorf("Share of trustee %d doesn't match its public share", j)
+		}
+	}
+
+	for first := 0; first+poll.Threshold <= len(keys); first++ {
+		var set []int
+		for j := first; j < first+poll.Threshold; j++ {
+			set = append(set, j)
+		}
+
+		secret := new(big.Int)
+		for _, j := range set {
+			secret.Add(secret, new(big.Int).Mul(lagrangeCoefficient(j, set), shares[j]))
+		}
+
+		if !pointEqual(pointBaseMul(secret), outcome.PublicKey()) {
+			t.Errorf("Trustees %v unable to recover the key", set)
+		}
+	}
+}
+
+func TestDKGHonestTrustees(t *testing.T) {
+	id, poll, keys := dummyDKGPoll(t, 5, 3)
+	deals := honestDeals(t, id, poll, keys)
+
+	complaints := simulateDKGComplaints(id, poll, keys, deals)
+	if len(complaints) != 0 {
+		t.Errorf("Honest trustees complained: %v", complaints)
+	}
+
+	outcome, ok := computeDKGOutcome(id, poll, deals, complaints)
+	if !ok || len(outcome.Qualified) != len(keys) {
+		t.Fatalf("Honest trustees not all qualified: %v", outcome.Qualified)
+	}
+
+	checkDKGShares(t, id, poll, keys, deals, outcome)
+}
+
+func TestDKGCorruptedShare(t *testing.T) {
+	id, poll, keys := dummyDKGPoll(t, 5, 3)
+	deals := honestDeals(t, id, poll, keys)
+
+	deals[1].Shares[3][0] ^= 1
+
+	complaints := simulateDKGComplaints(id, poll, keys, deals)
+	if len(complaints) != 1 || complaints[0].Accuser != 3 || complaints[0].Dealer != 1 {
+		t.Fatalf("Expected a single complaint of 3 against 1, got %v", complaints)
+	}
+
+	if !complaints[0].Justified(id, poll, deals[1]) {
+		t.Errorf("Complaint against a corrupted share not justified")
+	}
+
+	outcome, ok := computeDKGOutcome(id, poll, deals, complaints)
+	if !ok || len(outcome.Qualified) != len(keys)-1 {
+		t.Fatalf("Dishonest dealer not disqualified: %v", outcome.Qualified)
+	}
+
+	for _, q := range outcome.Qualified {
+		if q == 1 {
+			t.Errorf("Dishonest dealer qualified")
+		}
+	}
+
+	checkDKGShares(t, id, poll, keys, deals, outcome)
+}
+
+func TestDKGWrongCommitments(t *testing.T) {
+	id, poll, keys := dummyDKGPoll(t, 4, 2)
+	deals := honestDeals(t, id, poll, keys)
+
+	// shares no longer match for anyone
+	deals[0].Commitments[1] = pointBaseMul(mustRandomScalar())
+
+	complaints := simulateDKGComplaints(id, poll, keys, deals)
+	if len(complaints) != len(keys)-1 {
+		t.Errorf("Expected every other trustee to complain, got %d complaints", len(complaints))
+	}
+
+	outcome, ok := computeDKGOutcome(id, poll, deals, complaints)
+	if !ok || len(outcome.Qualified) != len(keys)-1 || outcome.Qualified[0] == 0 {
+		t.Fatalf("Dishonest dealer not disqualified: %v", outcome.Qualified)
+	}
+
+	checkDKGShares(t, id, poll, keys, deals, outcome)
+}
+
+func TestDKGFalseComplaint(t *testing.T) {
+	id, poll, keys := dummyDKGPoll(t, 4, 2)
+	deals := honestDeals(t, id, poll, keys)
+
+	// complaining about a valid share doesn't disqualify the dealer
+	honest := NewDKGComplaint(id, poll, *keys[2], deals[0])
+	if honest.Justified(id, poll, deals[0]) {
+		t.Errorf("Complaint against a valid share justified")
+	}
+
+	// neither does revealing a wrong key to get a garbage share
+	forged := honest
+	forged.Key = pointBaseMul(mustRandomScalar())
+	if forged.Justified(id, poll, deals[0]) {
+		t.Errorf("Complaint with a forged key justified")
+	}
+
+	// nor accusing on behalf of another trustee
+	impersonated := honest
+	impersonated.Accuser = 3
+	if impersonated.Justified(id, poll, deals[0]) {
+		t.Errorf("Complaint on behalf of another trustee justified")
+	}
+
+	outcome, ok := computeDKGOutcome(id, poll, deals, []DKGComplaint{honest, forged, impersonated})
+	if !ok || len(outcome.Qualified) != len(keys) {
+		t.Fatalf("False complaints disqualified a dealer: %v", outcome.Qualified)
+	}
+
+	checkDKGShares(t, id, poll, keys, deals, outcome)
+}
+
+func TestDKGMissingAndEquivocatingDealers(t *testing.T) {
+	id, poll, keys := dummyDKGPoll(t, 5, 3)
+	deals := honestDeals(t, id, poll, keys)
+
+	other, err := NewDKGDeal(id, poll, *keys[4])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 3 never dealt and 4 dealt twice
+	deals = append(deals[:3], deals[4], other)
+
+	outcome, ok := computeDKGOutcome(id, poll, deals, nil)
+	if !ok || len(outcome.Qualified) != 3 {
+		t.Fatalf("Expected only the three honest dealers, got %v", outcome.Qualified)
+	}
+
+	checkDKGShares(t, id, poll, keys, deals, outcome)
+
+	// too much dishonest trustees to reach the threshold
+	if _, ok := computeDKGOutcome(id, poll, deals[:2], nil); ok {
+		t.Errorf("DKG succeeded without enough qualified dealers")
+	}
+}
+
+func TestDKGPacketsOverDispatcher(t *testing.T) {
+	id, poll, keys := dummyDKGPoll(t, 3, 2)
+	deals := honestDeals(t, id, poll, keys)
+
+	g := DummyGossiper()
+	dispatch := DispatcherPeersterMessage(g)
+	peer := *parseAddr("127.0.0.1:5001")
+
+	g.Polls.Store(PollPacket{ID: id, Poll: &poll})
+	g.RunningPolls.Add(id, drainHandler)
+
+	send := func(pkg PollPacket, signer *ecdsa.PrivateKey) {
+		sig, err := ecSignature(&Gossiper{KeyPair: *signer}, pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dispatch(peer, wireRoundTrip(t, GossipPacket{Poll: &pkg, Signature: &sig}))
+	}
+
+	send(PollPacket{ID: id, Deal: &deals[0]}, keys[0])
+	send(PollPacket{ID: id, Deal: &deals[1]}, keys[2]) // not signed by its dealer
+
+	deals[2].Shares[0][0] ^= 1
+	send(PollPacket{ID: id, Deal: &deals[2]}, keys[2])
+
+	complaint := NewDKGComplaint(id, poll, *keys[0], deals[2])
+	send(PollPacket{ID: id, Complaint: &complaint}, keys[0])
+
+	unjustified := NewDKGComplaint(id, poll, *keys[1], deals[0])
+	send(PollPacket{ID: id, Complaint: &unjustified}, keys[1])
+
+	info := g.Polls.Get(id)
+	if len(info.Deals) != 2 || len(info.Complaints) != 1 {
+		t.Fatalf("Expected 2 deals and 1 complaint, got %d and %d", len(info.Deals), len(info.Complaints))
+	}
+
+	if g.Reputations.Opinions[peer.String()] == 0 {
+		t.Errorf("Peer forwarding invalid DKG packets not suspected")
+	}
+
+	outcome, ok := computeDKGOutcome(id, poll, info.Deals, info.Complaints)
+	if ok || len(outcome.Qualified) != 1 || outcome.Qualified[0] != 0 {
+		t.Errorf("Expected only the first dealer to qualify, got %v", outcome.Qualified)
+	}
+}
+
+func TestDKGHandler(t *testing.T) {
+	// the handler gossips its packets
+	g := newGossiper("name", DummyGossiper().KeyPair, make([][2]big.Int, 0), NewServer("127.0.0.1:0"))
+	defer g.Server.Conn.Close()
+	dispatch := DispatcherPeersterMessage(g)
+	peer := *parseAddr("127.0.0.1:5001")
+
+	id, poll, keys := dummyDKGPoll(t, 3, 2)
+	keys[0] = &g.KeyPair
+	poll.Trustees[0] = PublicKeyWireFromEcdsa(g.KeyPair.PublicKey)
+	poll.Duration = 500 * time.Millisecond
+
+	g.Polls.Store(PollPacket{ID: id, Poll: &poll})
+	g.RunningPolls.Add(id, func(id PollKey, key ecdsa.PrivateKey, r RunningPollReader) {
+		dkgHandler("Test", g, id, poll, r)
+	})
+
+	deals := honestDeals(t, id, poll, keys)
+	deals[2].Shares[0][0] ^= 1
+
+	for i := 1; i < len(deals); i++ {
+		pkg := PollPacket{ID: id, Deal: &deals[i]}
+		sig, err := ecSignature(&Gossiper{KeyPair: *keys[i]}, pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dispatch(peer, wireRoundTrip(t, GossipPacket{Poll: &pkg, Signature: &sig}))
+	}
+
+	time.Sleep(poll.Duration + 200*time.Millisecond)
+
+	info := g.Polls.Get(id)
+	if info.DKG == nil || info.DKGShare == nil {
+		t.Fatal("DKG outcome not recorded")
+	}
+
+	if len(info.Complaints) != 1 || info.Complaints[0].Dealer != 2 {
+		t.Errorf("Expected a complaint against the dishonest dealer, got %v", info.Complaints)
+	}
+
+	if len(info.DKG.Qualified) != 2 || !pointEqual(pointBaseMul(info.DKGShare), info.DKG.PublicShare(0)) {
+		t.Errorf("Unexpected DKG outcome: %v", info.DKG.Qualified)
+	}
+}
+
+func TestDKGPollTrusteesOverDispatcher(t *testing.T) {
+	origin := DummyGossiper()
+	peer := *parseAddr("127.0.0.1:5001")
+
+	_, poll, keys := dummyDKGPoll(t, 3, 2)
+	validKeys := make([][2]big.Int, 0)
+	for _, k := range keys {
+		validKeys = append(validKeys, [2]big.Int{*k.X, *k.Y})
+	}
+
+	received := func(body Poll, validKeys [][2]big.Int) bool {
+		g := DummyGossiper()
+		g.ValidKeys = validKeys
+		dispatch := DispatcherPeersterMessage(g)
+
+		id := PollKey{origin.KeyPair.PublicKey, pollID(origin.KeyPair.PublicKey, body)}
+		g.RunningPolls.Add(id, drainHandler)
+
+		pkg := PollPacket{ID: id, Poll: &body}
+		sig, err := ecSignature(origin, pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dispatch(peer, wireRoundTrip(t, GossipPacket{Poll: &pkg, Signature: &sig}))
+
+		return g.Polls.Get(id).Tags != nil
+	}
+
+	if !received(poll, validKeys) {
+		t.Fatalf("Poll with valid trustees rejected")
+	}
+
+	if received(poll, validKeys[1:]) {
+		t.Errorf("Accepted a poll with a trustee which isn't a valid key")
+	}
+
+	small := poll
+	small.Threshold = 4
+	if received(small, validKeys) {
+		t.Errorf("Accepted a poll with less trustees than the threshold")
+	}
+
+	duplicated := poll
+	duplicated.Trustees = append(duplicated.Trustees[:2:2], duplicated.Trustees[0])
+	if received(duplicated, validKeys) {
+		t.Errorf("Accepted a poll with a duplicated trustee")
+	}
+
+	homomorphic := *DummyPoll()
+	homomorphic.Tally = TallyHomomorphic
+	if received(homomorphic, validKeys) {
+		t.Errorf("Accepted a homomorphic poll without trustees")
+	}
+}
+
+func TestDKGHandlerFollowsExtend(t *testing.T) {
+	g := newGossiper("name", DummyGossiper().KeyPair, make([][2]big.Int, 0), NewServer("127.0.0.1:0"))
+	defer g.Server.Conn.Close()
+	dispatch := DispatcherPeersterMessage(g)
+	peer := *parseAddr("127.0.0.1:5001")
+
+	id, poll, keys := dummyDKGPoll(t, 3, 2)
+	keys[0] = &g.KeyPair
+	poll.Trustees[0] = PublicKeyWireFromEcdsa(g.KeyPair.PublicKey)
+	poll.StartTime = time.Now()
+	poll.Duration = 200 * time.Millisecond
+
+	g.Polls.Store(PollPacket{ID: id, Poll: &poll})
+	extend := NewPollControl(ControlExtend, 700*time.Millisecond)
+	g.Polls.Store(PollPacket{ID: id, Control: &extend})
+
+	g.RunningPolls.Add(id, func(id PollKey, key ecdsa.PrivateKey, r RunningPollReader) {
+		dkgHandler("Test", g, id, poll, r)
+	})
+
+	deals := honestDeals(t, id, poll, keys)
+	for i := 1; i < len(deals); i++ {
+		pkg := PollPacket{ID: id, Deal: &deals[i]}
+		sig, err := ecSignature(&Gossiper{KeyPair: *keys[i]}, pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dispatch(peer, wireRoundTrip(t, GossipPacket{Poll: &pkg, Signature: &sig}))
+	}
+
+	time.Sleep(400 * time.Millisecond)
+	if g.Polls.Get(id).DKG != nil {
+		t.Fatal("DKG ended before the extended deadline")
+	}
+
+	time.Sleep(600 * time.Millisecond)
+	if g.Polls.Get(id).DKG == nil {
+		t.Error("DKG outcome not recorded after the extended deadline")
+	}
+}
@@ -0,0 +1,125 @@
+package pollparty
+
+import (
+	"sort"
+)
+
+const (
+	EigenTrustAlpha      = 0.5 // given back to the pre-trusted peers at each step, high for cliques not to keep the trust
+	EigenTrustIterations = 50
+	EigenTrustEpsilon    = 1e-9
+)
+
+// global trust of every node, from the opinions each signer has of the
+// others. A node trusts the peers it has an opinion of 1 about, equally,
+// and trust flows from the pre-trusted peers, or from every signer if none
+// of them is known. Nodes only reachable through suspected ones get none.
+func EigenTrust(opinions map[string]RepOpinions, preTrusted []string) map[string]float64 {
+	nodes := make(map[string]bool)
+	for signer, peerOpinions := range opinions {
+		nodes[signer] = true
+		for peer := range peerOpinions {
+			nodes[peer] = true
+		}
+	}
+
+	// sorted to always sum in the same order
+	names := make([]string, 0, len(nodes))
+	for node := range nodes {
+		names = append(names, node)
+	}
+	sort.Strings(names)
+
+	seeds := make(map[string]float64)
+	for _, node := range preTrusted {
+		if nodes[node] {
+			seeds[node] = 1
+		}
+	}
+	if len(seeds) == 0 {
+		for signer := range opinions {
+			seeds[signer] = 1
+		}
+	}
+	for node := range seeds {
+		seeds[node] /= float64(len(seeds))
+	}
+
+	trusted := make(map[string][]string)
+	for signer, peerOpinions := range opinions {
+		for peer, opinion := range peerOpinions {
+			if peer != signer && opinion == 1 {
+				trusted[signer] = append(trusted[signer], peer)
+			}
+		}
+	}
+
+	trust := make(map[string]float64)
+	for node, t := range seeds {
+		trust[node] = t
+	}
+
+	for i := 0; i < EigenTrustIterations; i++ {
+		next := make(map[string]float64)
+		for node, t := range seeds {
+			next[node] = EigenTrustAlpha * t
+		}
+
+		for _, node := range names {
+			t := (1 - EigenTrustAlpha) * trust[node]
+			if t == 0 {
+				continue
+			}
+
+			// trusting no one is the same as trusting the seeds
+			if len(trusted[node]) == 0 {
+				for seed, s := range seeds {
+					next[seed] += t * s
+				}
+				continue
+			}
+
+			for _, peer := range trusted[node] {
+				next[peer] += t / float64(len(trusted[node]))
+			}
+		}
+
+		diff := 0.0
+		for _, node := range names {
+			if d := next[node] - trust[node]; d > 0 {
+				diff += d
+			} else {
+				diff -= d
+			}
+		}
+
+		trust = next
+		if diff < EigenTrustEpsilon {
+			break
+		}
+	}
+
+	return trust
+}
+
+// the opinions of the signers about a peer, weighted by their trust,
+// between -1 and 1. Nobody vouches for itself.
+func weightedOpinion(opinions map[string]RepOpinions, trust map[string]float64, peer string) float64 {
+	sum, total := 0.0, 0.0
+	for signer, peerOpinions := range opinions {
+		if signer == peer {
+			continue
+		}
+
+		if opinion, ok := peerOpinions[peer]; ok {
+			sum += trust[signer] * float64(opinion)
+			total += trust[signer]
+		}
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	return sum / total
+}
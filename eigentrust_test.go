@@ -0,0 +1,202 @@
+package pollparty
+
+import (
+	"math/big"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// the first peers are honest, they suspect the malicious ones if caught,
+// which suspect their targets and trust each other
+func collusion(honest int, malicious int, caught bool, targets func(peer int) bool) map[string]RepOpinions {
+	name := func(i int) string { return "peer" + strconv.Itoa(i) }
+	opinions := make(map[string]RepOpinions)
+
+	for i := 0; i < honest+malicious; i++ {
+		peerOpinions := make(RepOpinions)
+		for j := 0; j < honest+malicious; j++ {
+			switch {
+			case i < honest && j >= honest && caught:
+				peerOpinions.Suspect(name(j))
+			case i >= honest && j < honest && targets(j):
+				peerOpinions.Suspect(name(j))
+			default:
+				peerOpinions.Trust(name(j))
+			}
+		}
+		opinions[name(i)] = peerOpinions
+	}
+
+	return opinions
+}
+
+func collusionScores(opinions map[string]RepOpinions, preTrusted []string) *ReputationInfo {
+	repInfo := NewReputationInfo()
+	repInfo.Config.PreTrusted = preTrusted
+
+	pollKey := PollKey{ID: 1}
+	repInfo.PeersOpinions[pollKey.Pack()] = opinions
+	repInfo.addReputations(pollKey, time.Now())
+
+	return repInfo
+}
+
+func TestEigenTrustSeeds(t *testing.T) {
+	opinions := collusion(6, 3, true, func(int) bool { return true })
+	trust := EigenTrust(opinions, []string{"peer0"})
+
+	sum := 0.0
+	for _, v := range trust {
+		sum += v
+	}
+	if sum < 0.999 || sum > 1.001 {
+		t.Errorf("Trust doesn't sum to 1: %f", sum)
+	}
+
+	for i := 6; i < 9; i++ {
+		if trust["peer"+strconv.Itoa(i)] != 0 {
+			t.Errorf("Caught peer trusted by the seed")
+		}
+	}
+	if trust["peer0"] <= trust["peer1"] {
+		t.Errorf("Seed not trusted first")
+	}
+}
+
+func TestCollusionUpToAThird(t *testing.T) {
+	attacks := map[string]func(int) bool{
+		"one peer":   func(peer int) bool { return peer == 1 },
+		"the seed":   func(peer int) bool { return peer == 0 },
+		"every peer": func(int) bool { return true },
+	}
+
+	for _, n := range []int{3, 6, 9, 12} {
+		for malicious := 1; malicious <= n/3; malicious++ {
+			for attack, targets := range attacks {
+				for _, caught := range []bool{false, true} {
+					honest := n - malicious
+					repInfo := collusionScores(collusion(honest, malicious, caught, targets), []string{"peer0"})
+
+					for i := 0; i < honest; i++ {
+						if score := repInfo.Score("peer"+strconv.Itoa(i), time.Now()); score != 0 {
+							t.Errorf("%d malicious of %d suspecting %s (caught %v) lowered peer%d to %.1f",
+								malicious, n, attack, caught, i, score)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// more colluding peers than honest ones, but caught by the trusted ones
+func TestCollusionOutvoting(t *testing.T) {
+	opinions := collusion(3, 5, true, func(int) bool { return true })
+
+	repTable := make(map[string]int)
+	for _, peerOpinions := range opinions {
+		for peer, rep := range peerOpinions {
+			tempUpdateRep(peer, rep, repTable)
+		}
+	}
+	if repTable["peer1"] >= 0 {
+		t.Fatalf("Plain sum should blacklist the honest peers")
+	}
+
+	repInfo := collusionScores(opinions, []string{"peer0"})
+	for i := 0; i < 8; i++ {
+		peer := "peer" + strconv.Itoa(i)
+		if quarantined := repInfo.Response(peer, time.Now()) == ResponseQuarantine; quarantined != (i >= 3) {
+			t.Errorf("Wrong quarantine of %s: %v", peer, quarantined)
+		}
+	}
+}
+
+func TestSignerAddress(t *testing.T) {
+	repInfo := NewReputationInfo()
+	a, b := DummyGossiper(), DummyGossiper()
+	pollKey := PollKey{ID: 1}
+
+	// the first to send its opinions doesn't get the address
+	repInfo.AddPeerOpinion(&ReputationPacket{Signer: b.KeyPair.PublicKey, Address: "peerA", Opinions: RepOpinions{"peerB": -1}}, pollKey)
+	if _, ok := repInfo.PeersOpinions[pollKey.Pack()]["peerA"]; ok {
+		t.Errorf("Address taken by the key of a reputation packet")
+	}
+
+	repInfo.BindAddress("peerA", a.KeyPair.PublicKey)
+
+	honest := RepOpinions{"peerB": 1}
+	repInfo.AddPeerOpinion(&ReputationPacket{Signer: a.KeyPair.PublicKey, Address: "peerA", Opinions: honest}, pollKey)
+
+	if len(repInfo.PeersOpinions[pollKey.Pack()]) != 2 || repInfo.PeersOpinions[pollKey.Pack()]["peerA"]["peerB"] != 1 {
+		t.Errorf("Opinions of the bound key not known by its address")
+	}
+}
+
+// opinions sent by gossipers, ours filed under our address as the seed
+func TestOpinionsOfGossipers(t *testing.T) {
+	// each one known by the port it got
+	gossiper := func(name string) *Gossiper {
+		server := NewServer("127.0.0.1:0")
+		server.Addr = server.Conn.LocalAddr().(*net.UDPAddr)
+		return newGossiper(name, DummyGossiper().KeyPair, nil, server)
+	}
+	a, b, sybil := gossiper("a"), gossiper("b"), gossiper("sybil")
+	defer a.Server.Conn.Close()
+	defer b.Server.Conn.Close()
+	defer sybil.Server.Conn.Close()
+
+	a.ValidKeys = [][2]big.Int{{*a.KeyPair.X, *a.KeyPair.Y}, {*b.KeyPair.X, *b.KeyPair.Y}}
+	dispatch := DispatcherPeersterMessage(a)
+	peer := *parseAddr("127.0.0.1:5001")
+
+	// b verified its status, they trust each other and suspect the victim
+	address := b.Server.Addr.String()
+	a.Reputations.BindAddress(address, b.KeyPair.PublicKey)
+	a.Reputations.Opinions.Trust(address)
+	b.Reputations.Opinions.Trust(a.Server.Addr.String())
+	victim := "127.0.0.1:5009"
+	a.Reputations.SetOverride(victim, OverrideSuspect)
+	b.Reputations.SetOverride(victim, OverrideSuspect)
+	sybil.Reputations.SetOverride(address, OverrideSuspect)
+
+	// what b and the sybil send, as a would get it
+	conn := localConn(t)
+	defer conn.Close()
+	received := func(g *Gossiper, pollID PollKey) GossipPacket {
+		g.Peers.Set[conn.LocalAddr().String()] = true
+		g.SendReputation(pollID, nil)
+		packets := readPackets(t, conn)
+		if len(packets) == 0 || packets[0].Reputation == nil {
+			t.Fatal("Opinions not sent")
+		}
+		return packets[0]
+	}
+
+	pollID := PollKey{a.KeyPair.PublicKey, uint64(1)}
+	done := a.Reputations.StartRound(pollID, 2)
+
+	a.SendReputation(pollID, nil)
+	dispatch(peer, received(sybil, pollID))
+	select {
+	case <-done:
+		t.Fatal("Round ended by the opinions of an unknown key")
+	default:
+	}
+
+	dispatch(peer, received(b, pollID))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Round not ended once every participant sent its opinions")
+	}
+
+	if score := a.Reputations.Score(victim, time.Now()); score >= 0 {
+		t.Errorf("Peer suspected by the trusted gossipers not penalized: %.1f", score)
+	}
+	if score := a.Reputations.Score(address, time.Now()); score != 0 {
+		t.Errorf("Peer suspected by an unknown key penalized: %.1f", score)
+	}
+}
@@ -0,0 +1,234 @@
+package pollparty
+
+import (
+	"crypto/sha256"
+	"math/big"
+)
+
+// Exponential ElGamal, m*G is encrypted instead of m so that ciphertexts can
+// be summed. Decryption then needs a discrete log, which is fine for counts.
+type ElGamalCiphertext struct {
+	A [2]*big.Int // r*G
+	B [2]*big.Int // m*G + r*Y
+}
+
+func pointBase() [2]*big.Int {
+	params := Curve().Params()
+	return [2]*big.Int{params.Gx, params.Gy}
+}
+
+func elGamalEncrypt(Y [2]*big.Int, m int64, r *big.Int) ElGamalCiphertext {
+	return ElGamalCiphertext{
+		A: pointBaseMul(r),
+		B: pointAdd(pointBaseMul(big.NewInt(m)), pointMul(Y, r)),
+	}
+}
+
+func (c ElGamalCiphertext) add(other ElGamalCiphertext) ElGamalCiphertext {
+	return ElGamalCiphertext{
+		A: pointAdd(c.A, other.A),
+		B: pointAdd(c.B, other.B),
+	}
+}
+
+func elGamalZero() ElGamalCiphertext {
+	return ElGamalCiphertext{
+		A: pointInfinity(),
+		B: pointInfinity(),
+	}
+}
+
+// finds m from m*G, m being at most max
+func discreteLog(M [2]*big.Int, max int) (int, bool) {
+	acc := pointInfinity()
+	G := pointBase()
+
+	for m := 0; m <= max; m++ {
+		if pointEqual(acc, M) {
+			return m, true
+		}
+		acc = pointAdd(acc, G)
+	}
+
+	return 0, false
+}
+
+func hashToScalar(context []byte, points ...[2]*big.Int) *big.Int {
+	hash := sha256.New()
+	hash.Write(context)
+
+	for _, p := range points {
+		hash.Write(p[0].Bytes())
+		hash.Write(p[1].Bytes())
+	}
+
+	return new(big.Int).Mod(new(big.Int).SetBytes(hash.Sum(nil)), Curve().Params().N)
+}
+
+// Proof of knowledge of x such that Points[i] = x*Bases[i] for every i, with
+// one base it is a Schnorr proof, with two a Chaum-Pedersen one
+type DLProof struct {
+	C *big.Int
+	Z *big.Int
+}
+
+func proveDL(x *big.Int, bases, points [][2]*big.Int, context []byte) DLProof {
+	n := Curve().Params().N
+	k := mustRandomScalar()
+
+	toHash := append(append([][2]*big.Int{}, bases...), points...)
+	for _, b := range bases {
+		toHash = append(toHash, pointMul(b, k))
+	}
+
+	c := hashToScalar(context, toHash...)
+	z := new(big.Int).Mul(c, x)
+	z.Add(z, k).Mod(z, n)
+
+	return DLProof{
+		C: c,
+		Z: z,
+	}
+}
+
+func (p DLProof) verify(bases, points [][2]*big.Int, context []byte) bool {
+	if p.C == nil || p.Z == nil || len(bases) != len(points) {
+		return false
+	}
+
+	// k*B = z*B - c*P
+	toHash := append(append([][2]*big.Int{}, bases...), points...)
+	for i, b := range bases {
+		toHash = append(toHash, pointAdd(pointMul(b, p.Z), pointNeg(pointMul(points[i], p.C))))
+	}
+
+	return hashToScalar(context, toHash...).Cmp(p.C) == 0
+}
+
+// Disjunctive Chaum-Pedersen proof that a ciphertext encrypts 0 or 1
+type BitProof struct {
+	C [2]*big.Int
+	Z [2]*big.Int
+}
+
+// (A, B - i*G) should be r*(G, Y) for the encrypted i
+func bitBranchCommitments(Y [2]*big.Int, ct ElGamalCiphertext, i int, c, z *big.Int) [][2]*big.Int {
+	B := pointAdd(ct.B, pointNeg(pointBaseMul(big.NewInt(int64(i)))))
+
+	return [][2]*big.Int{
+		pointAdd(pointBaseMul(z), pointNeg(pointMul(ct.A, c))),
+		pointAdd(pointMul(Y, z), pointNeg(pointMul(B, c))),
+	}
+}
+
+func proveBit(Y [2]*big.Int, ct ElGamalCiphertext, bit int, r *big.Int, context []byte) BitProof {
+	n := Curve().Params().N
+	other := 1 - bit
+
+	var c, z [2]*big.Int
+
+	// simulate the branch we can't prove
+	c[other], z[other] = mustRandomScalar(), mustRandomScalar()
+
+	w := mustRandomScalar()
+	commitments := make([][][2]*big.Int, 2)
+	commitments[other] = bitBranchCommitments(Y, ct, other, c[other], z[other])
+	commitments[bit] = [][2]*big.Int{pointBaseMul(w), pointMul(Y, w)}
+
+	challenge := hashToScalar(context, append([][2]*big.Int{Y, ct.A, ct.B},
+		append(commitments[0], commitments[1]...)...)...)
+
+	c[bit] = new(big.Int).Sub(challenge, c[other])
+	c[bit].Mod(c[bit], n)
+
+	z[bit] = new(big.Int).Mul(c[bit], r)
+	z[bit].Add(z[bit], w).Mod(z[bit], n)
+
+	return BitProof{
+		C: c,
+		Z: z,
+	}
+}
+
+func (p BitProof) verify(Y [2]*big.Int, ct ElGamalCiphertext, context []byte) bool {
+	for i := 0; i < 2; i++ {
+		if p.C[i] == nil || p.Z[i] == nil {
+			return false
+		}
+	}
+
+	commitments := append(bitBranchCommitments(Y, ct, 0, p.C[0], p.Z[0]),
+		bitBranchCommitments(Y, ct, 1, p.C[1], p.Z[1])...)
+	challenge := hashToScalar(context, append([][2]*big.Int{Y, ct.A, ct.B}, commitments...)...)
+
+	sum := new(big.Int).Add(p.C[0], p.C[1])
+	sum.Mod(sum, Curve().Params().N)
+
+	return sum.Cmp(challenge) == 0
+}
+
+// Disjunctive proof that C - i*U = r*G for one i in [0, n), that is C commits
+// to one of the n options
+type OptionProof struct {
+	C []*big.Int
+	Z []*big.Int
+}
+
+// z*G - c*(C - i*U) should be the commitment w*G of the branch i
+func optionBranchCommitment(U, C [2]*big.Int, i int, c, z *big.Int) [2]*big.Int {
+	P := pointAdd(C, pointNeg(pointMul(U, big.NewInt(int64(i)))))
+	return pointAdd(pointBaseMul(z), pointNeg(pointMul(P, c)))
+}
+
+func proveOption(U, C [2]*big.Int, n int, index int, r *big.Int, context []byte) OptionProof {
+	order := Curve().Params().N
+
+	ret := OptionProof{
+		C: make([]*big.Int, n),
+		Z: make([]*big.Int, n),
+	}
+	commitments := make([][2]*big.Int, n)
+
+	// simulate every branch but ours
+	sum := new(big.Int)
+	for i := 0; i < n; i++ {
+		if i == index {
+			continue
+		}
+		ret.C[i], ret.Z[i] = mustRandomScalar(), mustRandomScalar()
+		commitments[i] = optionBranchCommitment(U, C, i, ret.C[i], ret.Z[i])
+		sum.Add(sum, ret.C[i])
+	}
+
+	w := mustRandomScalar()
+	commitments[index] = pointBaseMul(w)
+
+	challenge := hashToScalar(context, append([][2]*big.Int{U, C}, commitments...)...)
+
+	ret.C[index] = new(big.Int).Sub(challenge, sum)
+	ret.C[index].Mod(ret.C[index], order)
+
+	ret.Z[index] = new(big.Int).Mul(ret.C[index], r)
+	ret.Z[index].Add(ret.Z[index], w).Mod(ret.Z[index], order)
+
+	return ret
+}
+
+func (p OptionProof) verify(U, C [2]*big.Int, n int, context []byte) bool {
+	if n == 0 || len(p.C) != n || len(p.Z) != n {
+		return false
+	}
+
+	sum := new(big.Int)
+	commitments := make([][2]*big.Int, n)
+	for i := 0; i < n; i++ {
+		if p.C[i] == nil || p.Z[i] == nil {
+			return false
+		}
+		commitments[i] = optionBranchCommitment(U, C, i, p.C[i], p.Z[i])
+		sum.Add(sum, p.C[i])
+	}
+
+	challenge := hashToScalar(context, append([][2]*big.Int{U, C}, commitments...)...)
+	return sum.Mod(sum, Curve().Params().N).Cmp(challenge) == 0
+}
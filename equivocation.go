@@ -0,0 +1,70 @@
+package pollparty
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/json"
+	"log"
+)
+
+// two different poll bodies signed by the origin under the same PollKey, it
+// proves that the origin showed different polls to different peers
+type PollEquivocation struct {
+	Bodies     [2]Poll
+	Signatures [2]EllipticCurveSignature
+}
+
+func pollBodyJSON(id PollKey, body Poll) []byte {
+	input, err := json.Marshal(PollPacket{ID: id, Poll: &body})
+	if err != nil {
+		log.Printf("unable to encode as json")
+		return nil
+	}
+	return input
+}
+
+// the origin signs the whole poll packet, see SendPoll
+func pollBodySigned(id PollKey, body Poll, sig EllipticCurveSignature) bool {
+	hash := sha256.Sum256(pollBodyJSON(id, body))
+	return ecdsa.Verify(&id.Origin, hash[:], &sig.R, &sig.S)
+}
+
+func samePollBody(a, b Poll) bool {
+	return bytes.Equal(pollBodyJSON(PollKey{}, a), pollBodyJSON(PollKey{}, b))
+}
+
+func (e PollEquivocation) Valid(id PollKey) bool {
+	return !samePollBody(e.Bodies[0], e.Bodies[1]) &&
+		pollBodySigned(id, e.Bodies[0], e.Signatures[0]) &&
+		pollBodySigned(id, e.Bodies[1], e.Signatures[1])
+}
+
+func (info ShareablePollInfo) Equivocated() bool {
+	return info.Equivocation != nil
+}
+
+func (g *Gossiper) storePollSignature(id PollKey, sig EllipticCurveSignature) {
+	g.Polls.Lock()
+	defer g.Polls.Unlock()
+
+	info := g.Polls.m[id.Pack()]
+	if info.PollSignature == nil {
+		info.PollSignature = &sig
+		g.Polls.m[id.Pack()] = info
+	}
+}
+
+// checks the body against the first signed one, returns the evidence if the
+// origin signed both
+func (g *Gossiper) pollEquivocation(pkg GossipPacket) (PollEquivocation, bool) {
+	info := g.Polls.Get(pkg.Poll.ID)
+	if info.PollSignature == nil || pkg.Signature.Elliptic == nil || samePollBody(info.Poll, *pkg.Poll.Poll) {
+		return PollEquivocation{}, false
+	}
+
+	return PollEquivocation{
+		Bodies:     [2]Poll{info.Poll, *pkg.Poll.Poll},
+		Signatures: [2]EllipticCurveSignature{*info.PollSignature, *pkg.Signature.Elliptic},
+	}, true
+}
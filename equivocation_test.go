@@ -0,0 +1,118 @@
+package pollparty
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestPollEquivocationDetected(t *testing.T) {
+	// the evidence is gossiped
+	g := newGossiper("name", DummyGossiper().KeyPair, make([][2]big.Int, 0), NewServer("127.0.0.1:0"))
+	defer g.Server.Conn.Close()
+	dispatch := DispatcherPeersterMessage(g)
+	peer := *parseAddr("127.0.0.1:5001")
+
+	origin := DummyGossiper()
+	first, second := DummyPoll(), DummyPoll()
+	second.Options = []string{"Yes", "No", "Only small ones"}
+
+	// the second body can't match the id, the origin still signed it
+	id := PollKey{origin.KeyPair.PublicKey, pollID(origin.KeyPair.PublicKey, *first)}
+	g.RunningPolls.Add(id, drainHandler)
+
+	send := func(body *Poll) {
+		pkg := PollPacket{ID: id, Poll: body}
+		sig, err := ecSignature(origin, pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dispatch(peer, wireRoundTrip(t, GossipPacket{Poll: &pkg, Signature: &sig}))
+	}
+
+	send(first)
+	send(first)
+	if info := g.Polls.Get(id); info.Equivocated() || info.PollSignature == nil {
+		t.Fatalf("Same body taken as an equivocation")
+	}
+
+	g.Polls.Store(PollPacket{ID: id, Vote: &Vote{Salt: big.NewInt(1), Option: "Yes"}})
+	send(second)
+
+	info := g.Polls.Get(id)
+	if !info.Equivocated() || !info.Equivocation.Valid(id) {
+		t.Fatalf("Conflicting bodies not detected")
+	}
+
+	if len(info.Poll.Options) != len(first.Options) {
+		t.Errorf("Poll body overwritten by the conflicting one")
+	}
+
+	if len(info.Results()) != 0 {
+		t.Errorf("Equivocated poll still has results")
+	}
+
+	if !g.Reputations.IsEquivocator(origin.KeyPair.PublicKey) || g.Reputations.Opinions[peer.String()] != 0 {
+		t.Errorf("Expected the origin to be penalised instead of the peer")
+	}
+
+	// the evidence convinces nodes which only saw one body
+	other := DummyGossiper()
+	other.ValidKeys = [][2]big.Int{{*g.KeyPair.X, *g.KeyPair.Y}}
+	otherDispatch := DispatcherPeersterMessage(other)
+	other.RunningPolls.Add(id, drainHandler)
+	other.Polls.Store(PollPacket{ID: id, Poll: second})
+
+	sendEvidence := func(evidence PollEquivocation) {
+		pkg := PollPacket{ID: id, Equivocation: &evidence}
+		sig, err := ecSignature(g, pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		otherDispatch(peer, wireRoundTrip(t, GossipPacket{Poll: &pkg, Signature: &sig}))
+	}
+
+	forged := *info.Equivocation
+	forged.Bodies[1] = forged.Bodies[0]
+	sendEvidence(forged)
+	if other.Polls.Get(id).Equivocated() || other.Reputations.Opinions[peer.String()] != -1 {
+		t.Errorf("Accepted evidence with the same body twice")
+	}
+
+	sendEvidence(*info.Equivocation)
+	if !other.Polls.Get(id).Equivocated() || !other.Reputations.IsEquivocator(origin.KeyPair.PublicKey) {
+		t.Errorf("Evidence not accepted")
+	}
+}
+
+func TestPollEquivocationNeedsOriginSignatures(t *testing.T) {
+	origin, forger := DummyGossiper(), DummyGossiper()
+	id := PollKey{origin.KeyPair.PublicKey, uint64(1)}
+
+	first, second := DummyPoll(), DummyPoll()
+	second.Question = "Do you like cats?"
+
+	sign := func(g *Gossiper, body *Poll) EllipticCurveSignature {
+		sig, err := ecSignature(g, PollPacket{ID: id, Poll: body})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *sig.Elliptic
+	}
+
+	evidence := PollEquivocation{
+		Bodies:     [2]Poll{*first, *second},
+		Signatures: [2]EllipticCurveSignature{sign(origin, first), sign(forger, second)},
+	}
+	if evidence.Valid(id) {
+		t.Errorf("Accepted a body not signed by the origin")
+	}
+
+	evidence.Signatures[1] = sign(origin, second)
+	if !evidence.Valid(id) {
+		t.Errorf("Unable to verify evidence of equivocation")
+	}
+
+	if evidence.Valid(PollKey{origin.KeyPair.PublicKey, uint64(2)}) {
+		t.Errorf("Accepted evidence for another poll")
+	}
+}
@@ -0,0 +1,199 @@
+package pollparty
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+)
+
+// Pedersen verifiable secret sharing of the opening of a vote commitment
+// among the trustees of the poll, so that they can open it if the voter never
+// reveals its vote.
+//
+// The option m and the salt r are shared with f(0) = m and g(0) = r, the
+// coefficients being committed to as E_k = a_k*U + b_k*G, with U the
+// generator of the commitment, so that E_0 is the commitment itself. As the
+// voter is anonymous, the shares are encrypted with an ephemeral key.
+type SaltEscrow struct {
+	Commitments [][2]*big.Int // E_k for each coefficient, E_0 being the vote commitment
+	Ephemeral   [2]*big.Int   // e*G, shares are encrypted with e*TrusteeKey
+	Shares      [][]byte      // f(j+1) and g(j+1) for the trustee j, encrypted
+}
+
+// a trustee's share of the opening of an unrevealed commitment
+type EscrowShare struct {
+	Commitment [sha256.Size]byte // digest of the commitment
+	Trustee    int
+	Option     *big.Int // f(Trustee+1)
+	Salt       *big.Int // g(Trustee+1)
+}
+
+const escrowShareSize = 2 * dkgShareSize
+
+func escrowPad(id PollKey, recipient int, key [2]*big.Int) []byte {
+	ret := make([]byte, 0, escrowShareSize)
+
+	for i := 0; len(ret) < escrowShareSize; i++ {
+		var indexes [16]byte
+		binary.BigEndian.PutUint64(indexes[:8], uint64(i))
+		binary.BigEndian.PutUint64(indexes[8:], uint64(recipient))
+
+		hash := sha256.New()
+		hash.Write(tallyContext(id, "escrow share"))
+		hash.Write(indexes[:])
+		hash.Write(key[0].Bytes())
+		hash.Write(key[1].Bytes())
+		ret = append(ret, hash.Sum(nil)...)
+	}
+
+	return ret
+}
+
+func xorEscrowShare(share, pad []byte) []byte {
+	ret := make([]byte, escrowShareSize)
+	for i := range ret {
+		ret[i] = share[i] ^ pad[i]
+	}
+	return ret
+}
+
+// tag is the one of the ring signature sending the commitment
+func NewSaltEscrow(id PollKey, poll Poll, tag [2]*big.Int, answer string, salt *big.Int) (SaltEscrow, error) {
+	index, ok := optionIndex(poll.Options, answer)
+	if !ok || !poll.dkgValid() {
+		return SaltEscrow{}, errors.New("unable to escrow \"" + answer + "\"")
+	}
+
+	U := commitmentU(CommitmentVersion, id, tag)
+	option := make([]*big.Int, poll.Threshold)
+	blinding := make([]*big.Int, poll.Threshold)
+
+	var err error
+	ret := SaltEscrow{}
+	for k := range option {
+		if k == 0 {
+			option[k], blinding[k] = big.NewInt(int64(index)), salt
+		} else {
+			option[k], err = randomScalar()
+			if err != nil {
+				return SaltEscrow{}, err
+			}
+			blinding[k], err = randomScalar()
+			if err != nil {
+				return SaltEscrow{}, err
+			}
+		}
+		ret.Commitments = append(ret.Commitments, pointAdd(pointMul(U, option[k]), pointBaseMul(blinding[k])))
+	}
+
+	ephemeral, err := randomScalar()
+	if err != nil {
+		return SaltEscrow{}, err
+	}
+	ret.Ephemeral = pointBaseMul(ephemeral)
+
+	for j, trustee := range poll.trusteeKeys() {
+		share := append(evalPolynomial(option, j+1).FillBytes(make([]byte, dkgShareSize)),
+			evalPolynomial(blinding, j+1).FillBytes(make([]byte, dkgShareSize))...)
+		ret.Shares = append(ret.Shares, xorEscrowShare(share, escrowPad(id, j, pointMul(trustee, ephemeral))))
+	}
+
+	return ret, nil
+}
+
+func (e SaltEscrow) wellFormed(poll Poll, commitment [2]*big.Int) bool {
+	if len(e.Commitments) != poll.Threshold || len(e.Shares) != len(poll.Trustees) ||
+		len(e.Commitments) == 0 || !pointEqual(e.Commitments[0], commitment) {
+		return false
+	}
+
+	for _, c := range append([][2]*big.Int{e.Ephemeral}, e.Commitments...) {
+		if c[0] == nil || c[1] == nil || !Curve().IsOnCurve(c[0], c[1]) {
+			return false
+		}
+	}
+
+	for _, s := range e.Shares {
+		if len(s) != escrowShareSize {
+			return false
+		}
+	}
+
+	return true
+}
+
+// decrypts the share of the trustee owning key, false if it is invalid
+func NewEscrowShare(id PollKey, poll Poll, tag [2]*big.Int, commit Commitment, key ecdsa.PrivateKey) (EscrowShare, bool) {
+	trustee, ok := poll.trusteeIndex(key.PublicKey)
+	if !ok || commit.Escrow == nil || !commit.Escrow.wellFormed(poll, commit.Point) {
+		return EscrowShare{}, false
+	}
+
+	escrow := *commit.Escrow
+	plain := xorEscrowShare(escrow.Shares[trustee], escrowPad(id, trustee, pointMul(escrow.Ephemeral, key.D)))
+
+	ret := EscrowShare{
+		Commitment: commit.Digest(),
+		Trustee:    trustee,
+		Option:     new(big.Int).SetBytes(plain[:dkgShareSize]),
+		Salt:       new(big.Int).SetBytes(plain[dkgShareSize:]),
+	}
+
+	return ret, ret.Valid(id, tag, escrow)
+}
+
+func (s EscrowShare) Valid(id PollKey, tag [2]*big.Int, escrow SaltEscrow) bool {
+	if s.Option == nil || s.Salt == nil || s.Trustee < 0 || s.Trustee >= len(escrow.Shares) {
+		return false
+	}
+
+	U := commitmentU(CommitmentVersion, id, tag)
+	share := pointAdd(pointMul(U, s.Option), pointBaseMul(s.Salt))
+	return pointEqual(share, evalCommitments(escrow.Commitments, s.Trustee+1))
+}
+
+// interpolates the opening from Threshold valid shares of distinct trustees
+func openEscrow(id PollKey, poll Poll, tag [2]*big.Int, commit Commitment, shares []EscrowShare) (Vote, bool) {
+	n := Curve().Params().N
+
+	if commit.Escrow == nil {
+		return Vote{}, false
+	}
+
+	byTrustee := make(map[int]EscrowShare)
+	var trustees []int
+	for _, s := range shares {
+		if _, ok := byTrustee[s.Trustee]; ok || len(trustees) == poll.Threshold ||
+			s.Commitment != commit.Digest() || !s.Valid(id, tag, *commit.Escrow) {
+			continue
+		}
+		byTrustee[s.Trustee] = s
+		trustees = append(trustees, s.Trustee)
+	}
+
+	if len(trustees) < poll.Threshold {
+		return Vote{}, false
+	}
+
+	option, salt := new(big.Int), new(big.Int)
+	for _, j := range trustees {
+		lambda := lagrangeCoefficient(j, trustees)
+		option.Add(option, new(big.Int).Mul(lambda, byTrustee[j].Option)).Mod(option, n)
+		salt.Add(salt, new(big.Int).Mul(lambda, byTrustee[j].Salt)).Mod(salt, n)
+	}
+
+	if !option.IsInt64() || option.Int64() >= int64(len(poll.Options)) {
+		return Vote{}, false
+	}
+
+	vote := Vote{
+		Salt:   salt,
+		Option: poll.Options[option.Int64()],
+		Weight: commit.Weight,
+	}
+
+	opened, ok := vote.Commitment(id, tag, poll.Options)
+	return vote, ok && opened.Digest() == commit.Digest()
+}
@@ -0,0 +1,208 @@
+package pollparty
+
+import (
+	"crypto/ecdsa"
+	crypto "crypto/rand"
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func escrowedCommitment(t *testing.T, id PollKey, poll Poll, tag [2]*big.Int, answer string) (Commitment, *big.Int) {
+	commit, salt, err := NewCommitment(id, tag, poll.Options, answer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	escrow, err := NewSaltEscrow(id, poll, tag, answer, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit.Escrow = &escrow
+
+	return commit, salt
+}
+
+func escrowShares(t *testing.T, id PollKey, poll Poll, tag [2]*big.Int, commit Commitment, keys []*ecdsa.PrivateKey) []EscrowShare {
+	shares := make([]EscrowShare, len(keys))
+	for j, key := range keys {
+		var ok bool
+		shares[j], ok = NewEscrowShare(id, poll, tag, commit, *key)
+		if !ok {
+			t.Fatalf("Trustee %d got an invalid escrow share", j)
+		}
+	}
+	return shares
+}
+
+func TestEscrowOpening(t *testing.T) {
+	id, poll, keys := dummyDKGPoll(t, 4, 3)
+	tag := pointBaseMul(mustRandomScalar())
+
+	commit, salt := escrowedCommitment(t, id, poll, tag, "No")
+	if !commit.Valid(id, tag, len(poll.Options)) || !commit.Escrow.wellFormed(poll, commit.Point) {
+		t.Fatalf("Unable to verify an escrowed commitment")
+	}
+
+	shares := escrowShares(t, id, poll, tag, commit, keys)
+
+	for first := 0; first+poll.Threshold <= len(keys); first++ {
+		vote, ok := openEscrow(id, poll, tag, commit, shares[first:first+poll.Threshold])
+		if !ok || vote.Option != "No" || vote.Salt.Cmp(salt) != 0 {
+			t.Errorf("Trustees from %d unable to open the commitment", first)
+		}
+	}
+
+	if _, ok := openEscrow(id, poll, tag, commit, shares[:poll.Threshold-1]); ok {
+		t.Errorf("Opened the commitment with too few shares")
+	}
+
+	if _, ok := openEscrow(id, poll, tag, commit, []EscrowShare{shares[0], shares[0], shares[0]}); ok {
+		t.Errorf("Opened the commitment with the same share thrice")
+	}
+}
+
+func TestEscrowInvalidShare(t *testing.T) {
+	id, poll, keys := dummyDKGPoll(t, 3, 2)
+	tag := pointBaseMul(mustRandomScalar())
+
+	commit, _ := escrowedCommitment(t, id, poll, tag, "Yes")
+	shares := escrowShares(t, id, poll, tag, commit, keys)
+
+	forged := shares[0]
+	forged.Option = new(big.Int).Add(forged.Option, big.NewInt(1))
+	if forged.Valid(id, tag, *commit.Escrow) {
+		t.Errorf("Verified a forged escrow share")
+	}
+
+	if shares[0].Valid(id, pointBaseMul(mustRandomScalar()), *commit.Escrow) {
+		t.Errorf("Verified an escrow share under another tag")
+	}
+
+	if _, ok := openEscrow(id, poll, tag, commit, []EscrowShare{forged, shares[1]}); ok {
+		t.Errorf("Opened the commitment with a forged share")
+	}
+
+	// the voter encrypted garbage to the first trustee
+	commit.Escrow.Shares[0][0] ^= 1
+	if _, ok := NewEscrowShare(id, poll, tag, commit, *keys[0]); ok {
+		t.Errorf("Accepted a corrupted escrow share")
+	}
+
+	other, _ := escrowedCommitment(t, id, poll, tag, "Yes")
+	commit.Escrow.Commitments[0] = other.Point
+	if commit.Escrow.wellFormed(poll, commit.Point) {
+		t.Errorf("Accepted an escrow of another commitment")
+	}
+}
+
+func TestEscrowWireRoundTrip(t *testing.T) {
+	id, poll, keys := dummyDKGPoll(t, 3, 2)
+	tag := pointBaseMul(mustRandomScalar())
+
+	commit, _ := escrowedCommitment(t, id, poll, tag, "No")
+	sig := Signature{Elliptic: &EllipticCurveSignature{*big.NewInt(1), *big.NewInt(1)}}
+
+	decoded := *wireRoundTrip(t, GossipPacket{Poll: &PollPacket{ID: id, Commitment: &commit}, Signature: &sig}).Poll.Commitment
+	if decoded.Digest() != commit.Digest() || decoded.Escrow == nil || !decoded.Escrow.wellFormed(poll, decoded.Point) {
+		t.Fatalf("Escrow changed on the wire")
+	}
+
+	share, ok := NewEscrowShare(id, poll, tag, decoded, *keys[1])
+	if !ok {
+		t.Fatalf("Invalid escrow share after the wire")
+	}
+
+	fromWire := *wireRoundTrip(t, GossipPacket{Poll: &PollPacket{ID: id, EscrowShare: &share}, Signature: &sig}).Poll.EscrowShare
+	if fromWire.Commitment != share.Commitment || fromWire.Trustee != share.Trustee ||
+		fromWire.Option.Cmp(share.Option) != 0 || fromWire.Salt.Cmp(share.Salt) != 0 {
+		t.Errorf("Escrow share changed on the wire")
+	}
+}
+
+// a voter commits then disappears, the trustees open its vote
+func TestEscrowOverDispatcher(t *testing.T) {
+	id, poll, keys := dummyDKGPoll(t, 3, 2)
+
+	g := DummyGossiper()
+	dispatch := DispatcherPeersterMessage(g)
+	peer := *parseAddr("127.0.0.1:5001")
+
+	g.Polls.Store(PollPacket{ID: id, Poll: &poll})
+	g.RunningPolls.Add(id, drainHandler)
+
+	voter, err := ecdsa.GenerateKey(Curve(), crypto.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	participants := [][2]big.Int{{*voter.X, *voter.Y}, {*g.KeyPair.X, *g.KeyPair.Y}}
+	g.storeParticipants(id, participants, nil)
+	tag := ringTag(participants, voter)
+
+	ringSend := func(pkg PollPacket) {
+		input, err := json.Marshal(pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig := ringSignature(poll.Scheme, input, participants, voter, 0)
+		dispatch(peer, wireRoundTrip(t, GossipPacket{Poll: &pkg, Signature: &sig}))
+	}
+
+	plain, _, err := NewCommitment(id, tag, poll.Options, "Yes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ringSend(PollPacket{ID: id, Commitment: &plain})
+	if len(g.Polls.Get(id).Commitments) != 0 {
+		t.Fatalf("Stored a commitment without escrow")
+	}
+
+	commit, salt := escrowedCommitment(t, id, poll, tag, "Yes")
+	ringSend(PollPacket{ID: id, Commitment: &commit})
+
+	if unrevealed := g.Polls.Get(id).unrevealed(); len(unrevealed) != 1 || unrevealed[0] != commit.Digest() {
+		t.Fatalf("Expected the commitment to be unrevealed, got %d", len(unrevealed))
+	}
+
+	shares := escrowShares(t, id, poll, tag, commit, keys)
+	send := func(share EscrowShare, signer *ecdsa.PrivateKey) {
+		pkg := PollPacket{ID: id, EscrowShare: &share}
+		sig, err := ecSignature(&Gossiper{KeyPair: *signer}, pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dispatch(peer, wireRoundTrip(t, GossipPacket{Poll: &pkg, Signature: &sig}))
+	}
+
+	forged := shares[2]
+	forged.Salt = new(big.Int).Add(forged.Salt, big.NewInt(1))
+	send(forged, keys[2])
+	send(shares[1], keys[0]) // not signed by its trustee
+	send(shares[0], keys[0])
+
+	info := g.Polls.Get(id)
+	if len(info.EscrowShares) != 1 || len(info.Votes) != 0 {
+		t.Fatalf("Expected a single escrow share and no vote, got %d and %d", len(info.EscrowShares), len(info.Votes))
+	}
+
+	if g.Reputations.Opinions[peer.String()] == 0 {
+		t.Errorf("Peer forwarding invalid escrow shares not suspected")
+	}
+
+	send(shares[2], keys[2])
+
+	info = g.Polls.Get(id)
+	if len(info.Votes) != 1 || info.Votes[0].Option != "Yes" || info.Votes[0].Salt.Cmp(salt) != 0 {
+		t.Fatalf("Trustees didn't open the commitment")
+	}
+
+	if len(info.EscrowOpened) != 1 || info.EscrowOpened[0] != commit.Digest() || len(info.unrevealed()) != 0 {
+		t.Errorf("Opening by the trustees not recorded")
+	}
+
+	// the voter comes back, its vote is counted once
+	ringSend(PollPacket{ID: id, Vote: &Vote{Salt: salt, Option: "Yes"}})
+	if results := g.Polls.Get(id).Results(); results["Yes"] != 1 {
+		t.Errorf("Expected a single vote, got %v", results)
+	}
+}
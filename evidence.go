@@ -0,0 +1,361 @@
+package pollparty
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	secrand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand"
+	"net"
+)
+
+const MaxEvidencePackets = 2
+
+// packets signed by the offender proving its offence, anyone can check them
+// again. An invalid packet alone proves nothing, anyone could have made it,
+// so only conflicting packets of the same signer count.
+type EvidencePacket struct {
+	Offence  Offence
+	Packets  []GossipPacket // poll packets with their signature
+	Reporter ecdsa.PublicKey
+}
+
+// the same offence is only counted once, whoever reports it
+func (e EvidencePacket) Digest() (PacketDigest, error) {
+	hash := sha256.New()
+
+	var offence [4]byte
+	binary.BigEndian.PutUint32(offence[:], uint32(e.Offence))
+	hash.Write(offence[:])
+
+	for _, pkg := range e.Packets {
+		digest, err := pkg.Digest()
+		if err != nil {
+			return PacketDigest{}, err
+		}
+		hash.Write(digest[:])
+	}
+
+	var ret PacketDigest
+	copy(ret[:], hash.Sum(nil))
+	return ret, nil
+}
+
+// the poll the offence was seen in, if any
+func (e EvidencePacket) poll() *PollKey {
+	if len(e.Packets) == 0 || e.Packets[0].Poll == nil {
+		return nil
+	}
+
+	return &e.Packets[0].Poll.ID
+}
+
+// the voter is only known by the link tag of its signatures, the one of
+// every packet as verifyEvidence checked
+func (e EvidencePacket) accused() string {
+	tag := e.Packets[0].Signature.LinkTag()
+	return "tag:" + tag[0].String() + "," + tag[1].String()
+}
+
+func (e EvidencePacket) hash() []byte {
+	input, err := json.Marshal(e.ToWire())
+	if err != nil {
+		panic(err)
+	}
+
+	hash := sha256.Sum256(input)
+	return hash[:]
+}
+
+func evidenceSignature(key ecdsa.PrivateKey, e EvidencePacket) (Signature, error) {
+	r, s, err := ecdsa.Sign(secrand.Reader, &key, e.hash())
+	if err != nil {
+		return Signature{}, err
+	}
+
+	return Signature{Elliptic: &EllipticCurveSignature{*r, *s}}, nil
+}
+
+func evidenceSignatureValid(pkg GossipPacket) bool {
+	if pkg.Signature == nil || pkg.Signature.Elliptic == nil {
+		return false
+	}
+
+	return ecdsa.Verify(&pkg.Evidence.Reporter, pkg.Evidence.hash(),
+		&pkg.Signature.Elliptic.R, &pkg.Signature.Elliptic.S)
+}
+
+// ring signatures carry the message they sign, it has to be the packet for
+// the packet to be what the voter sent
+func ringSignsPacket(pkg GossipPacket) bool {
+	input, err := json.Marshal(pkg.Poll)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case pkg.Signature.Linkable != nil:
+		return bytes.Equal(pkg.Signature.Linkable.Message, input)
+	case pkg.Signature.Compact != nil:
+		return bytes.Equal(pkg.Signature.Compact.Message, input)
+	}
+
+	return false
+}
+
+// the stored commitment or ballot of the same tag which the packet conflicts
+// with, as found by doubleVoted
+func (g *Gossiper) doubleVoteOf(pkg GossipPacket) (GossipPacket, bool) {
+	g.Status.RLock()
+	defer g.Status.RUnlock()
+
+	for _, stored := range g.Status.PktStatus {
+		if doubleVote(g.Polls.Get(pkg.Poll.ID).Poll, stored, pkg) {
+			return stored, true
+		}
+	}
+
+	return GossipPacket{}, false
+}
+
+// the stored commitment the vote should have opened, only without re-voting
+// as superseded commitments can't be opened
+func (g *Gossiper) commitmentOf(pkg GossipPacket) (GossipPacket, bool) {
+	if g.Polls.Get(pkg.Poll.ID).Poll.Revoting {
+		return GossipPacket{}, false
+	}
+
+	g.Status.RLock()
+	defer g.Status.RUnlock()
+
+	tag := LinkTagMapFrom(pkg.Signature.LinkTag())
+	for _, stored := range g.Status.PktStatus {
+		if stored.Poll != nil && stored.Poll.Commitment != nil && stored.Poll.ID.Pack() == pkg.Poll.ID.Pack() &&
+			LinkTagMapFrom(stored.Signature.LinkTag()) == tag {
+			return stored, true
+		}
+	}
+
+	return GossipPacket{}, false
+}
+
+// two commitments or ballots with the same tag, for the same sequence with
+// re-voting
+func doubleVote(poll Poll, a GossipPacket, b GossipPacket) bool {
+	if a.Poll == nil || b.Poll == nil || a.Poll.ID.Pack() != b.Poll.ID.Pack() ||
+		!a.Poll.isRingSigned() || !b.Poll.isRingSigned() ||
+		LinkTagMapFrom(a.Signature.LinkTag()) != LinkTagMapFrom(b.Signature.LinkTag()) {
+		return false
+	}
+
+	if a.Poll.Commitment != nil && b.Poll.Commitment != nil {
+		return a.Poll.Commitment.Digest() != b.Poll.Commitment.Digest() &&
+			(!poll.Revoting || a.Poll.Commitment.Sequence == b.Poll.Commitment.Sequence)
+	}
+
+	if a.Poll.Ballot != nil && b.Poll.Ballot != nil {
+		return a.Poll.Ballot.Digest() != b.Poll.Ballot.Digest()
+	}
+
+	return false
+}
+
+// whether the evidence proves the offence, and if we know enough of the poll
+// to tell
+func (g *Gossiper) verifyEvidence(e EvidencePacket) (bool, bool) {
+	if len(e.Packets) == 0 || len(e.Packets) > MaxEvidencePackets {
+		return false, true
+	}
+
+	for _, pkg := range e.Packets {
+		if pkg.Poll == nil || pkg.Signature == nil {
+			return false, true
+		}
+
+		// rings are only final once the participants are known
+		info := g.Polls.Get(pkg.Poll.ID)
+		if pkg.Poll.isRingSigned() && info.Participants == nil {
+			return false, false
+		}
+	}
+
+	switch e.Offence {
+	case OffenceDoubleVote:
+		if len(e.Packets) != 2 {
+			return false, true
+		}
+		a, b := e.Packets[0], e.Packets[1]
+		poll := g.Polls.Get(a.Poll.ID).Poll
+		return doubleVote(poll, a, b) && g.SignatureValid(a) && g.SignatureValid(b) &&
+			ringSignsPacket(a) && ringSignsPacket(b), true
+
+	case OffenceInvalidReveal:
+		if len(e.Packets) != 2 {
+			return false, true
+		}
+		commit, vote := e.Packets[0], e.Packets[1]
+		info := g.Polls.Get(commit.Poll.ID)
+		if info.Poll.Revoting {
+			return false, false
+		}
+		if commit.Poll.Commitment == nil || vote.Poll.Vote == nil || !commit.Poll.isRingSigned() ||
+			!vote.Poll.isRingSigned() || commit.Poll.ID.Pack() != vote.Poll.ID.Pack() ||
+			LinkTagMapFrom(commit.Signature.LinkTag()) != LinkTagMapFrom(vote.Signature.LinkTag()) ||
+			!g.SignatureValid(commit) || !g.SignatureValid(vote) || !ringSignsPacket(commit) || !ringSignsPacket(vote) {
+			return false, true
+		}
+		opened, ok := vote.Poll.Vote.Commitment(vote.Poll.ID, vote.Signature.LinkTag(), info.Poll.Options)
+		return !ok || opened.Digest() != commit.Poll.Commitment.Digest(), true
+	}
+
+	return false, true
+}
+
+// we saw the offence, tell the others if they can check it, but the peer
+// which sent it
+func (g *Gossiper) SendEvidence(fromPeer net.UDPAddr, offence Offence, packets ...GossipPacket) {
+	pkg := EvidencePacket{
+		Offence:  offence,
+		Packets:  packets,
+		Reporter: g.KeyPair.PublicKey,
+	}
+
+	if verified, known := g.verifyEvidence(pkg); !verified || !known {
+		return
+	}
+
+	digest, err := pkg.Digest()
+	if err != nil || !g.Reputations.AddEvidence(digest) {
+		return
+	}
+
+	sig, err := evidenceSignature(g.KeyPair, pkg)
+	if err != nil {
+		log.Println("unable to sign the evidence:", err)
+		return
+	}
+
+	g.SendEvidencePacket(&pkg, &sig, &fromPeer)
+}
+
+func (g *Gossiper) SendEvidencePacket(msg *EvidencePacket, sig *Signature, butNotThisPeer *net.UDPAddr) {
+	for {
+		peer := getRandomPeer(&g.Peers, butNotThisPeer)
+		if peer == nil {
+			break
+		}
+
+		writePacketToUDP(g.Server, peer, GossipPacket{Evidence: msg, Signature: sig})
+
+		printFlippedCoin(peer, "evidence")
+		if rand.Intn(2) == 0 {
+			break
+		}
+	}
+}
+
+// only verified evidence of a valid key lowers the score of the accused,
+// enough of it bans it. Whoever sends false evidence is to blame.
+func (g *Gossiper) handleEvidence(fromPeer net.UDPAddr, pkg GossipPacket) {
+	evidence := *pkg.Evidence
+	poll := evidence.poll()
+
+	if !evidenceSignatureValid(pkg) {
+		log.Println("invalid evidence signature, suspect sender " + fromPeer.String())
+		g.Reputations.Offend(fromPeer.String(), OffenceInvalidSignature, poll)
+		return
+	}
+
+	if _, ok := containsKey(g.ValidKeys, evidence.Reporter); !ok {
+		log.Println("evidence reported by an unknown key, drop it")
+		return
+	}
+
+	digest, err := evidence.Digest()
+	if err != nil {
+		log.Println("unable to digest the evidence of " + fromPeer.String() + ": " + err.Error())
+		return
+	}
+
+	if g.Reputations.HasEvidence(digest) {
+		return
+	}
+
+	verified, known := g.verifyEvidence(evidence)
+	if !known {
+		log.Println("evidence about an unknown poll, drop it")
+		return
+	} else if !verified {
+		log.Println("false evidence, suspect sender " + fromPeer.String())
+		g.Reputations.Offend(fromPeer.String(), OffenceFalseEvidence, poll)
+		return
+	}
+
+	if !g.Reputations.AddEvidence(digest) {
+		return
+	}
+
+	log.Printf("verified evidence of %s by %s", evidence.Offence, evidence.accused())
+	g.Reputations.Penalize(evidence.accused(), evidence.Offence, poll)
+	g.SendEvidencePacket(&evidence, pkg.Signature, &fromPeer)
+}
+
+// Wire ------------------------------------------------------------------------------------------
+
+type EvidencePacketWire struct {
+	Offence    Offence
+	Polls      []PollPacketWire
+	Signatures []SignatureWire
+	Reporter   PublicKeyWire
+}
+
+func (msg EvidencePacketWire) check() error {
+	if len(msg.Polls) == 0 || len(msg.Polls) > MaxEvidencePackets || len(msg.Polls) != len(msg.Signatures) {
+		return errors.New("EvidencePacketWire: wrong number of packets")
+	}
+
+	for i := range msg.Polls {
+		err := msg.Polls[i].check()
+		if err == nil {
+			err = msg.Signatures[i].check()
+		}
+		if err != nil {
+			return errors.New("EvidencePacketWire: " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (msg EvidencePacket) ToWire() EvidencePacketWire {
+	ret := EvidencePacketWire{
+		Offence:  msg.Offence,
+		Reporter: PublicKeyWireFromEcdsa(msg.Reporter),
+	}
+
+	for _, pkg := range msg.Packets {
+		ret.Polls = append(ret.Polls, pkg.Poll.toWire())
+		ret.Signatures = append(ret.Signatures, pkg.Signature.toWire())
+	}
+
+	return ret
+}
+
+func (msg EvidencePacketWire) ToBase() EvidencePacket {
+	ret := EvidencePacket{
+		Offence:  msg.Offence,
+		Reporter: msg.Reporter.toEcdsa(),
+	}
+
+	for i := range msg.Polls {
+		poll := msg.Polls[i].toBase()
+		sig := msg.Signatures[i].toBase()
+		ret.Packets = append(ret.Packets, GossipPacket{Poll: &poll, Signature: &sig})
+	}
+
+	return ret
+}
@@ -0,0 +1,201 @@
+package pollparty
+
+import (
+	"crypto/ecdsa"
+	crypto "crypto/rand"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// a poll known by the gossipers, with a voter outside of them
+func evidencePoll(t *testing.T, gossipers ...*Gossiper) (PollKey, [][2]big.Int, ecdsa.PrivateKey) {
+	voter, err := ecdsa.GenerateKey(Curve(), crypto.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origin := gossipers[0]
+	id := PollKey{origin.KeyPair.PublicKey, uint64(1)}
+	participants := [][2]big.Int{{*voter.X, *voter.Y}, {*origin.KeyPair.X, *origin.KeyPair.Y}}
+
+	for _, g := range gossipers {
+		g.Polls.Store(PollPacket{ID: id, Poll: DummyPoll()})
+		g.storeParticipants(id, participants, nil)
+	}
+
+	return id, participants, *voter
+}
+
+func ringSigned(t *testing.T, pkg PollPacket, participants [][2]big.Int, key ecdsa.PrivateKey) GossipPacket {
+	input, err := json.Marshal(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig := ringSignature(LinkableRing, input, participants, &key, 0)
+	return GossipPacket{Poll: &pkg, Signature: &sig}
+}
+
+func commitmentPacket(t *testing.T, id PollKey, participants [][2]big.Int, key ecdsa.PrivateKey, answer string) (GossipPacket, *big.Int) {
+	commit, salt, err := NewCommitment(id, ringTag(participants, &key), DummyPoll().Options, answer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ringSigned(t, PollPacket{ID: id, Commitment: &commit}, participants, key), salt
+}
+
+func evidencePacket(t *testing.T, reporter *Gossiper, offence Offence, packets ...GossipPacket) GossipPacket {
+	evidence := EvidencePacket{
+		Offence:  offence,
+		Packets:  packets,
+		Reporter: reporter.KeyPair.PublicKey,
+	}
+
+	sig, err := evidenceSignature(reporter.KeyPair, evidence)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return wireRoundTrip(t, GossipPacket{Evidence: &evidence, Signature: &sig})
+}
+
+func TestDoubleVoteEvidence(t *testing.T) {
+	reporter, other, receiver := DummyGossiper(), DummyGossiper(), DummyGossiper()
+	receiver.ValidKeys = [][2]big.Int{{*reporter.KeyPair.X, *reporter.KeyPair.Y}, {*other.KeyPair.X, *other.KeyPair.Y}}
+	dispatch := DispatcherPeersterMessage(receiver)
+	from := *parseAddr("127.0.0.1:5001")
+	id, participants, voter := evidencePoll(t, reporter, receiver)
+
+	yes, _ := commitmentPacket(t, id, participants, voter, "Yes")
+	no, _ := commitmentPacket(t, id, participants, voter, "No")
+
+	evidence := evidencePacket(t, reporter, OffenceDoubleVote, yes, no)
+	if verified, known := receiver.verifyEvidence(*evidence.Evidence); !verified || !known {
+		t.Fatalf("Double vote not verified")
+	}
+
+	dispatch(from, evidence)
+	dispatch(from, evidencePacket(t, other, OffenceDoubleVote, yes, no))
+
+	// the voter is accused by its tag, not the peer which sent the packets
+	score := receiver.Reputations.Score(evidence.Evidence.accused(), time.Now())
+	if score > -OffencePenalties[OffenceDoubleVote]+1 || score < -OffencePenalties[OffenceDoubleVote]-1 {
+		t.Errorf("Expected the double vote to be counted once, score %.1f", score)
+	}
+	if receiver.Reputations.Score(from.String(), time.Now()) != 0 {
+		t.Errorf("Reporter of true evidence suspected")
+	}
+
+	// the same commitment twice isn't a double vote
+	dispatch(from, evidencePacket(t, reporter, OffenceDoubleVote, yes, yes))
+	if receiver.Reputations.Opinions[from.String()] != -1 {
+		t.Errorf("Sender of false evidence not suspected")
+	}
+
+	// nor the signature of one commitment with another one
+	replayed := GossipPacket{Poll: no.Poll, Signature: yes.Signature}
+	if verified, _ := receiver.verifyEvidence(*evidencePacket(t, reporter, OffenceDoubleVote, yes, replayed).Evidence); verified {
+		t.Errorf("Signature replayed on another commitment taken as evidence")
+	}
+
+	stranger := DummyGossiper()
+	if _, known := stranger.verifyEvidence(*evidence.Evidence); known {
+		t.Errorf("Evidence about an unknown poll verified")
+	}
+}
+
+func TestInvalidRevealEvidence(t *testing.T) {
+	reporter, receiver := DummyGossiper(), DummyGossiper()
+	id, participants, voter := evidencePoll(t, reporter, receiver)
+
+	commit, salt := commitmentPacket(t, id, participants, voter, "Yes")
+	honest := ringSigned(t, PollPacket{ID: id, Vote: &Vote{Salt: salt, Option: "Yes"}}, participants, voter)
+	lying := ringSigned(t, PollPacket{ID: id, Vote: &Vote{Salt: salt, Option: "No"}}, participants, voter)
+
+	if verified, _ := receiver.verifyEvidence(*evidencePacket(t, reporter, OffenceInvalidReveal, commit, lying).Evidence); !verified {
+		t.Errorf("Reveal of another option not verified")
+	}
+	if verified, _ := receiver.verifyEvidence(*evidencePacket(t, reporter, OffenceInvalidReveal, commit, honest).Evidence); verified {
+		t.Errorf("Honest reveal taken as evidence")
+	}
+
+	// the reporter finds the commitment the vote should open
+	reporter.Status.SetPkt(packetDigest(t, commit), commit)
+	if stored, ok := reporter.commitmentOf(lying); !ok || packetDigest(t, stored) != packetDigest(t, commit) {
+		t.Errorf("Commitment of the vote not found")
+	}
+}
+
+func TestFabricatedEvidence(t *testing.T) {
+	reporter, receiver := DummyGossiper(), DummyGossiper()
+	receiver.ValidKeys = [][2]big.Int{{*reporter.KeyPair.X, *reporter.KeyPair.Y}}
+	dispatch := DispatcherPeersterMessage(receiver)
+	from := *parseAddr("127.0.0.1:5001")
+	id, participants, voter := evidencePoll(t, reporter, receiver)
+
+	commit, _ := commitmentPacket(t, id, participants, voter, "Yes")
+
+	// anyone can make a packet with an invalid signature
+	outsider, err := ecdsa.GenerateKey(Curve(), crypto.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring := [][2]big.Int{{*outsider.X, *outsider.Y}, participants[1]}
+	forged := ringSigned(t, *commit.Poll, ring, *outsider)
+
+	bad := evidencePacket(t, reporter, OffenceInvalidSignature, forged)
+	if verified, _ := receiver.verifyEvidence(*bad.Evidence); verified {
+		t.Errorf("Invalid signature taken as evidence")
+	}
+
+	// conflicting packets of two voters, the reporter being the other one,
+	// prove nothing about either
+	no, _, err := NewCommitment(id, ringTag(participants, &reporter.KeyPair), DummyPoll().Options, "No")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := json.Marshal(PollPacket{ID: id, Commitment: &no})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := ringSignature(LinkableRing, input, participants, &reporter.KeyPair, 1)
+	other := GossipPacket{Poll: &PollPacket{ID: id, Commitment: &no}, Signature: &sig}
+	if verified, _ := receiver.verifyEvidence(*evidencePacket(t, reporter, OffenceDoubleVote, commit, other).Evidence); verified {
+		t.Errorf("Commitments of two voters taken as a double vote")
+	}
+
+	// only valid keys report
+	conflicting, _ := commitmentPacket(t, id, participants, voter, "No")
+	unknown := evidencePacket(t, DummyGossiper(), OffenceDoubleVote, commit, conflicting)
+	dispatch(from, unknown)
+	digest, err := unknown.Evidence.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receiver.Reputations.HasEvidence(digest) ||
+		receiver.Reputations.Score(unknown.Evidence.accused(), time.Now()) != 0 {
+		t.Errorf("Evidence of an unknown reporter counted")
+	}
+}
+
+func TestReputationWireRoundTrip(t *testing.T) {
+	g := DummyGossiper()
+	rep := ReputationPacket{
+		Signer:   g.KeyPair.PublicKey,
+		Opinions: RepOpinions{"127.0.0.1:5001": -1},
+		PollID:   PollKey{g.KeyPair.PublicKey, 1},
+		Address:  "127.0.0.1:5000",
+	}
+	sig, err := repSignature(g, rep)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := wireRoundTrip(t, GossipPacket{Reputation: &rep, Signature: &sig})
+	if msg.Reputation == nil || msg.Reputation.Address != rep.Address || !repSignatureValid(g, msg) {
+		t.Errorf("Reputation packet lost on the wire")
+	}
+}
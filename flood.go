@@ -0,0 +1,219 @@
+package pollparty
+
+import (
+	"log"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dedis/protobuf"
+)
+
+const (
+	PacketCost     = 1 // taken from the bucket of the peer before decoding
+	RingVerifyCost = 4 // more for ring signatures, checked against every key of the ring
+	MaxPeerBuckets = 4096
+)
+
+type ReceiveConfig struct {
+	Workers   int     // packets dispatched at once
+	Queue     int     // packets waiting for a worker, the next ones are shed
+	PeerRate  float64 // tokens a peer gets back every second
+	PeerBurst float64 // tokens a peer can spend at once
+}
+
+func DefaultReceiveConfig() ReceiveConfig {
+	workers := runtime.NumCPU()
+	if workers < 4 {
+		workers = 4
+	}
+
+	return ReceiveConfig{
+		Workers:   workers,
+		Queue:     256,
+		PeerRate:  200,
+		PeerBurst: 400,
+	}
+}
+
+// what happened to the datagrams we received
+type ReceiveStats struct {
+	Received   uint64
+	Dispatched uint64
+	Banned     uint64 // from banned peers
+	Throttled  uint64 // over the rate of their peer
+	Invalid    uint64 // undecodable or ill-formed
+	Refused    uint64 // from rate limited or quarantined peers
+	Shed       uint64 // the queue was full
+	Held       uint64 // until their poll or ring arrives, see PendingPackets
+	Expired    uint64 // held until the timeout
+}
+
+type tokenBucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// every peer spends tokens for its packets and gets them back over time,
+// so one flooding peer doesn't slow the others down
+type PeerBuckets struct {
+	sync.Mutex
+	m map[string]tokenBucket
+}
+
+func (b *PeerBuckets) Take(peer string, cost float64, rate float64, burst float64, now time.Time) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	bucket, ok := b.m[peer]
+	if !ok {
+		b.prune(rate, burst, now)
+		bucket = tokenBucket{Tokens: burst, Updated: now}
+	}
+
+	if elapsed := now.Sub(bucket.Updated).Seconds(); elapsed > 0 {
+		bucket.Tokens += elapsed * rate
+		if bucket.Tokens > burst {
+			bucket.Tokens = burst
+		}
+	}
+	bucket.Updated = now
+
+	allowed := bucket.Tokens >= cost
+	if allowed {
+		bucket.Tokens -= cost
+	}
+	b.m[peer] = bucket
+
+	return allowed
+}
+
+// full buckets are the same as new ones, forget them if there are too many
+func (b *PeerBuckets) prune(rate float64, burst float64, now time.Time) {
+	if len(b.m) < MaxPeerBuckets {
+		return
+	}
+
+	for peer, bucket := range b.m {
+		if bucket.Tokens+now.Sub(bucket.Updated).Seconds()*rate >= burst {
+			delete(b.m, peer)
+		}
+	}
+}
+
+type receivedPacket struct {
+	From net.UDPAddr
+	Pkg  GossipPacket
+}
+
+type Receiver struct {
+	Config  ReceiveConfig
+	Stats   ReceiveStats // updated atomically, read with Snapshot
+	Buckets PeerBuckets
+}
+
+func NewReceiver() *Receiver {
+	return &Receiver{
+		Config:  DefaultReceiveConfig(),
+		Buckets: PeerBuckets{m: make(map[string]tokenBucket)},
+	}
+}
+
+func (r *Receiver) Snapshot() ReceiveStats {
+	return ReceiveStats{
+		Received:   atomic.LoadUint64(&r.Stats.Received),
+		Dispatched: atomic.LoadUint64(&r.Stats.Dispatched),
+		Banned:     atomic.LoadUint64(&r.Stats.Banned),
+		Throttled:  atomic.LoadUint64(&r.Stats.Throttled),
+		Invalid:    atomic.LoadUint64(&r.Stats.Invalid),
+		Refused:    atomic.LoadUint64(&r.Stats.Refused),
+		Shed:       atomic.LoadUint64(&r.Stats.Shed),
+		Held:       atomic.LoadUint64(&r.Stats.Held),
+		Expired:    atomic.LoadUint64(&r.Stats.Expired),
+	}
+}
+
+func (r *Receiver) take(peer string, cost float64, now time.Time) bool {
+	return r.Buckets.Take(peer, cost, r.Config.PeerRate, r.Config.PeerBurst, now)
+}
+
+// the cheap checks come first, the packet is decoded once the peer paid for
+// it, and its ring signature checked once it paid for that too
+func (g *Gossiper) receive(buf []byte, peerAddr net.UDPAddr, queue chan<- receivedPacket) {
+	r := g.Receiver
+	peer := peerAddr.String()
+	now := time.Now()
+	atomic.AddUint64(&r.Stats.Received, 1)
+
+	if g.Reputations.IsBlacklisted(peer) {
+		atomic.AddUint64(&r.Stats.Banned, 1)
+		return
+	}
+
+	if !r.take(peer, PacketCost, now) {
+		atomic.AddUint64(&r.Stats.Throttled, 1)
+		return
+	}
+
+	// the decoded packet keeps slices of the datagram, and buf is read into
+	// again while the packet waits for a worker
+	datagram := make([]byte, len(buf))
+	copy(datagram, buf)
+
+	var msg GossipPacketWire
+	err := protobuf.Decode(datagram, &msg)
+	if err != nil {
+		log.Println("unable to decode msg:", err)
+		atomic.AddUint64(&r.Stats.Invalid, 1)
+		return
+	}
+
+	err = msg.Check()
+	if err != nil {
+		log.Println("invalid GossipPacketWire received:", err)
+		atomic.AddUint64(&r.Stats.Invalid, 1)
+		g.Reputations.Offend(peer, OffenceInvalidMessage, nil)
+		return
+	}
+
+	pkg := msg.ToBase()
+
+	statusOnly := pkg.Status != nil || pkg.Cookie != nil
+	if !g.Reputations.Allow(peer, statusOnly, now) {
+		atomic.AddUint64(&r.Stats.Refused, 1)
+		return
+	}
+
+	if pkg.Poll != nil && pkg.Poll.isRingSigned() && !r.take(peer, RingVerifyCost, now) {
+		atomic.AddUint64(&r.Stats.Throttled, 1)
+		return
+	}
+
+	select {
+	case queue <- receivedPacket{peerAddr, pkg}:
+	default:
+		atomic.AddUint64(&r.Stats.Shed, 1)
+	}
+}
+
+func (g *Gossiper) dispatchWorker(queue <-chan receivedPacket, dispatcher Dispatcher) {
+	for received := range queue {
+		dispatcher(received.From, received.Pkg)
+		atomic.AddUint64(&g.Receiver.Stats.Dispatched, 1)
+	}
+}
+
+// logs the shed packets, if any, every period
+func (g *Gossiper) logShedding(period time.Duration) {
+	var last ReceiveStats
+	for range time.Tick(period) {
+		stats := g.Receiver.Snapshot()
+		if stats.Shed > last.Shed || stats.Throttled > last.Throttled {
+			log.Printf("overloaded: %d packets shed, %d throttled in the last %s",
+				stats.Shed-last.Shed, stats.Throttled-last.Throttled, period)
+		}
+		last = stats
+	}
+}
@@ -0,0 +1,172 @@
+package pollparty
+
+import (
+	"crypto/ecdsa"
+	crypto "crypto/rand"
+	"encoding/json"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dedis/protobuf"
+)
+
+func encodePacket(t *testing.T, pkg GossipPacket) []byte {
+	wire := pkg.ToWire()
+	buf, err := protobuf.Encode(&wire)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf
+}
+
+func localConn(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn
+}
+
+func TestTokenBucket(t *testing.T) {
+	buckets := PeerBuckets{m: make(map[string]tokenBucket)}
+	now := time.Now()
+
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		if buckets.Take("peerA", 1, 5, 10, now) {
+			allowed++
+		}
+	}
+	if allowed != 10 || !buckets.Take("peerB", 1, 5, 10, now) {
+		t.Errorf("Expected the burst of one peer only, %d packets allowed", allowed)
+	}
+
+	if !buckets.Take("peerA", 5, 5, 10, now.Add(time.Second)) || buckets.Take("peerA", 1, 5, 10, now.Add(time.Second)) {
+		t.Errorf("Tokens not given back at the rate")
+	}
+}
+
+// a peer floods the receiver with copies of a valid commitment while an
+// honest one sends a whole poll
+func TestFloodFromOnePeer(t *testing.T) {
+	const numVoters = 4
+
+	key, err := ecdsa.GenerateKey(Curve(), crypto.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver := newGossiper("receiver", *key, make([][2]big.Int, 0), NewServer("127.0.0.1:0"))
+	receiver.Receiver.Config.Workers = 2
+	receiver.Receiver.Config.Queue = 16
+	receiver.Receiver.Config.PeerRate = 100
+	receiver.Receiver.Config.PeerBurst = 100
+	go RunServer(receiver, receiver.Server, DispatcherPeersterMessage(receiver))
+	defer receiver.Server.Conn.Close()
+	to := receiver.Server.Conn.LocalAddr().(*net.UDPAddr)
+
+	origin := DummyGossiper()
+	body := DummyPoll()
+	id := PollKey{origin.KeyPair.PublicKey, pollID(origin.KeyPair.PublicKey, *body)}
+	receiver.RunningPolls.Add(id, drainHandler)
+
+	keys := make([]*ecdsa.PrivateKey, numVoters)
+	participants := make([][2]big.Int, numVoters)
+	for i := range keys {
+		keys[i], err = ecdsa.GenerateKey(Curve(), crypto.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		participants[i] = [2]big.Int{*keys[i].X, *keys[i].Y}
+	}
+	receiver.storeParticipants(id, participants, nil)
+
+	poll := PollPacket{ID: id, Poll: body}
+	sig, err := ecSignature(origin, poll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packets := [][]byte{encodePacket(t, GossipPacket{Poll: &poll, Signature: &sig})}
+
+	ringSigned := func(pkg PollPacket, pos int) []byte {
+		input, err := json.Marshal(pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig := ringSignature(poll.Poll.Scheme, input, participants, keys[pos], pos)
+		return encodePacket(t, GossipPacket{Poll: &pkg, Signature: &sig})
+	}
+
+	votes := make([][]byte, numVoters)
+	for i := range keys {
+		option := poll.Poll.Options[i%len(poll.Poll.Options)]
+		commit, salt, err := NewCommitment(id, ringTag(participants, keys[i]), poll.Poll.Options, option)
+		if err != nil {
+			t.Fatal(err)
+		}
+		packets = append(packets, ringSigned(PollPacket{ID: id, Commitment: &commit}, i))
+		votes[i] = ringSigned(PollPacket{ID: id, Vote: &Vote{Salt: salt, Option: option}}, i)
+	}
+	packets = append(packets, votes...)
+
+	flooder, honest := localConn(t), localConn(t)
+	defer flooder.Close()
+	defer honest.Close()
+
+	stop := make(chan bool)
+	defer close(stop)
+	// thousands of packets a second, far over the rate of the peer but not so
+	// many the socket drops the honest ones before we read them
+	flood := func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				for i := 0; i < 20; i++ {
+					flooder.WriteToUDP(packets[1], to)
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+
+	// the honest peer sends again what was lost, as anti-entropy would
+	deadline := time.Now().Add(10 * time.Second)
+	for i, buf := range packets {
+		stored := func() bool {
+			info := receiver.Polls.Get(id)
+			switch {
+			case i == 0:
+				return info.Poll.Question != ""
+			case i <= numVoters:
+				return len(info.Commitments) >= i
+			}
+			return len(info.Votes) >= i-numVoters
+		}
+
+		for !stored() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Honest packet %d never handled, stats %+v", i, receiver.Receiver.Snapshot())
+			}
+			honest.WriteToUDP(buf, to)
+			time.Sleep(50 * time.Millisecond)
+		}
+
+		// commitments before the poll are a different matter
+		if i == 0 {
+			go flood()
+		}
+	}
+
+	stats := receiver.Receiver.Snapshot()
+	if stats.Throttled == 0 {
+		t.Errorf("Flooding peer never throttled: %+v", stats)
+	}
+	if receiver.Reputations.Opinion(honest.LocalAddr().String()) != 0 {
+		t.Errorf("Honest peer suspected")
+	}
+}
@@ -14,24 +14,50 @@ import (
 	"math/rand"
 	"net"
 	"sync"
-	"sync/atomic"
 	"time"
-	"strings"
 )
 
 type ShareablePollInfo struct {
 	Poll         Poll
 	Participants [][2]big.Int
+	Weights      []int // of the participants, if the poll is weighted
 	Commitments  []Commitment
 	Votes        []Vote
-	Tags         map[[2]*big.Int][]Commitment // mapping from tag to []commitment to detect double voting
+	Tags         map[LinkTagMap][][sha256.Size]byte // mapping from tag to the digests of what was committed, to detect double voting, by sequence if re-voting
+	Ballots      []Ballot
+	Decryptions  []PartialDecryption
+	Deals        []DKGDeal
+	Complaints   []DKGComplaint
+	DKG          *DKGOutcome         // set once the trustees are done
+	Revealed     [][sha256.Size]byte // commitments opened by their voter
+	EscrowShares []EscrowShare
+	EscrowOpened [][sha256.Size]byte // commitments opened by the trustees
+	Controls     []PollControl       // signed by the origin
+	Equivocation *PollEquivocation   // the poll is invalid if the origin signed two bodies
+	Metadata     *PollMetadata       // the first one signed by the origin
 }
 
 func (info ShareablePollInfo) Results() map[string]int {
+	if info.Cancelled() || info.Equivocated() {
+		return make(map[string]int)
+	}
+
+	if info.Poll.Tally == TallyHomomorphic {
+		ret, ok := info.homomorphicResults()
+		if !ok {
+			return make(map[string]int)
+		}
+		return ret
+	}
+
 	ret := make(map[string]int)
 
 	for _, v := range info.Votes {
-		ret[v.Option]++
+		if info.Poll.Weighted() {
+			ret[v.Option] += v.Weight
+		} else {
+			ret[v.Option]++
+		}
 	}
 
 	return ret
@@ -39,7 +65,11 @@ func (info ShareablePollInfo) Results() map[string]int {
 
 type PollInfo struct {
 	ShareablePollInfo
-	Registry *crypto.PublicKey
+	Registry      *crypto.PublicKey
+	DKGShare      *big.Int                // our secret share of the DKG key, if trustee
+	PollSignature *EllipticCurveSignature // of the first body, evidence if the origin equivocates
+	OriginKey     *ecdsa.PrivateKey       // if we created it anonymously
+	Voted         bool                    // we sent a commitment or a ballot
 }
 
 type Server struct {
@@ -83,25 +113,29 @@ func (s *PollSet) Store(pkg PollPacket) bool {
 	if pkg.Poll != nil {
 		poll := *pkg.Poll
 
-		exist := false
-		if info.Poll.Question == poll.Question &&
-			info.Poll.StartTime.Equal(poll.StartTime) &&
-			info.Poll.Duration.Minutes() == poll.Duration.Minutes() &&
-			strings.Join(info.Poll.Options, ",") == strings.Join(poll.Options,",") {
-				exist = true
-		}
+		exist := samePollBody(info.Poll, poll)
 
-		if !exist{
+		// Tags are created with the first body, later ones can't change it
+		if !exist && info.Tags == nil {
 			added = true
 			info.Poll = poll
-			info.Tags = make(map[[2]*big.Int][]Commitment)
+			info.Tags = make(map[LinkTagMap][][sha256.Size]byte)
+		} else if !exist {
+			log.Println("conflicting poll body, keep the first one")
+		}
+
+		// sent again with every body, only the first one is kept
+		if pkg.Metadata != nil && info.Metadata == nil && samePollBody(info.Poll, poll) {
+			metadata := *pkg.Metadata
+			info.Metadata = &metadata
+			added = true
 		}
 	}
 
 	if pkg.Commitment != nil {
 		exist := false
 		for _,com := range info.Commitments{
-			if string(com.Hash[:]) == string(pkg.Commitment.Hash[:]) {
+			if com.Digest() == pkg.Commitment.Digest() {
 				exist = true
 			}
 		}
@@ -114,7 +148,7 @@ func (s *PollSet) Store(pkg PollPacket) bool {
 	if pkg.Vote != nil {
 		exist := false
 		for _, vote := range info.Votes{
-			if string(vote.Salt[:]) == string(pkg.Vote.Salt[:]) && vote.Option == pkg.Vote.Option {
+			if vote.Salt.Cmp(pkg.Vote.Salt) == 0 && vote.Option == pkg.Vote.Option {
 				exist = true
 			}
 		}
@@ -124,6 +158,89 @@ func (s *PollSet) Store(pkg PollPacket) bool {
 		}
 	}
 
+	if pkg.Ballot != nil {
+		exist := false
+		for _, ballot := range info.Ballots {
+			if ballot.Digest() == pkg.Ballot.Digest() {
+				exist = true
+			}
+		}
+		if !exist {
+			info.Ballots = append(info.Ballots, *pkg.Ballot)
+			added = true
+		}
+	}
+
+	if pkg.Decryption != nil {
+		exist := false
+		for _, d := range info.Decryptions {
+			if d.Trustee == pkg.Decryption.Trustee && d.ballotsKey() == pkg.Decryption.ballotsKey() {
+				exist = true
+			}
+		}
+		if !exist {
+			info.Decryptions = append(info.Decryptions, *pkg.Decryption)
+			added = true
+		}
+	}
+
+	if pkg.Deal != nil {
+		exist := false
+		for _, d := range info.Deals {
+			if d.Digest() == pkg.Deal.Digest() {
+				exist = true
+			}
+		}
+		if !exist {
+			info.Deals = append(info.Deals, *pkg.Deal)
+			added = true
+		}
+	}
+
+	if pkg.Complaint != nil {
+		exist := false
+		for _, c := range info.Complaints {
+			if c.Dealer == pkg.Complaint.Dealer && c.Accuser == pkg.Complaint.Accuser {
+				exist = true
+			}
+		}
+		if !exist {
+			info.Complaints = append(info.Complaints, *pkg.Complaint)
+			added = true
+		}
+	}
+
+	if pkg.EscrowShare != nil {
+		exist := false
+		for _, e := range info.EscrowShares {
+			if e.Commitment == pkg.EscrowShare.Commitment && e.Trustee == pkg.EscrowShare.Trustee {
+				exist = true
+			}
+		}
+		if !exist {
+			info.EscrowShares = append(info.EscrowShares, *pkg.EscrowShare)
+			added = true
+		}
+	}
+
+	if pkg.Equivocation != nil && info.Equivocation == nil {
+		info.Equivocation = pkg.Equivocation
+		added = true
+	}
+
+	if pkg.Control != nil {
+		exist := false
+		for _, c := range info.Controls {
+			if c.equal(*pkg.Control) {
+				exist = true
+			}
+		}
+		if !exist {
+			info.Controls = append(info.Controls, *pkg.Control)
+			added = true
+		}
+	}
+
 	s.m[pkg.ID.Pack()] = info
 
 	return added
@@ -142,56 +259,156 @@ type VoteAndSender struct {
 }
 
 type RunningPollReader struct {
-	Poll       <-chan Poll
-	LocalVote  <-chan string
-	VoteKey    <-chan VoteKey
-	VoteKeys   <-chan VoteKeys
-	Commitment <-chan Commitment
-	Vote       <-chan VoteAndSender
+	Poll         <-chan Poll
+	LocalVote    <-chan string
+	VoteKey      <-chan VoteKey
+	VoteKeys     <-chan VoteKeys
+	Commitment   <-chan Commitment
+	Vote         <-chan VoteAndSender
+	Ballot       <-chan Ballot
+	Decryption   <-chan PartialDecryption
+	Deal         <-chan DKGDeal
+	Complaint    <-chan DKGComplaint
+	EscrowShare  <-chan EscrowShare
+	Control      <-chan PollControl
+	Equivocation <-chan PollEquivocation
 }
 
 type RunningPollWriter struct {
-	Poll       chan<- Poll
-	LocalVote  chan<- string
-	VoteKey    chan<- VoteKey
-	VoteKeys   chan<- VoteKeys
-	Commitment chan<- Commitment
-	Vote       chan<- VoteAndSender
+	Poll         chan<- Poll
+	LocalVote    chan<- string
+	VoteKey      chan<- VoteKey
+	VoteKeys     chan<- VoteKeys
+	Commitment   chan<- Commitment
+	Vote         chan<- VoteAndSender
+	Ballot       chan<- Ballot
+	Decryption   chan<- PartialDecryption
+	Deal         chan<- DKGDeal
+	Complaint    chan<- DKGComplaint
+	EscrowShare  chan<- EscrowShare
+	Control      chan<- PollControl
+	Equivocation chan<- PollEquivocation
 }
 
+// never blocks, a handler which is done or busy would hold the dispatcher,
+// what doesn't fit in the buffer is dropped. The packet is stored anyway.
 func (s RunningPollWriter) Send(pkg PollPacket, fromPeer *net.UDPAddr) {
+	dropped := false
+
 	if pkg.Poll != nil {
 		poll := *pkg.Poll
 		if poll.IsTooLate() {
 			log.Println("poll came in too late")
 		} else {
-			s.Poll <- poll
+			select {
+			case s.Poll <- poll:
+			default:
+				dropped = true
+			}
 		}
 	}
 
 	if pkg.VoteKey != nil {
-		s.VoteKey <- *pkg.VoteKey
+		select {
+		case s.VoteKey <- *pkg.VoteKey:
+		default:
+			dropped = true
+		}
 	}
 
 	if pkg.VoteKeys != nil {
-		s.VoteKeys <- *pkg.VoteKeys
+		select {
+		case s.VoteKeys <- *pkg.VoteKeys:
+		default:
+			dropped = true
+		}
 	}
 
 	if pkg.Commitment != nil {
-		s.Commitment <- *pkg.Commitment
+		select {
+		case s.Commitment <- *pkg.Commitment:
+		default:
+			dropped = true
+		}
 	}
 
 	if pkg.Vote != nil {
-		s.Vote <- VoteAndSender{
-			Vote:   *pkg.Vote,
-			Sender: fromPeer,
+		select {
+		case s.Vote <- VoteAndSender{Vote: *pkg.Vote, Sender: fromPeer}:
+		default:
+			dropped = true
+		}
+	}
+
+	if pkg.Ballot != nil {
+		select {
+		case s.Ballot <- *pkg.Ballot:
+		default:
+			dropped = true
 		}
 	}
+
+	if pkg.Decryption != nil {
+		select {
+		case s.Decryption <- *pkg.Decryption:
+		default:
+			dropped = true
+		}
+	}
+
+	if pkg.Deal != nil {
+		select {
+		case s.Deal <- *pkg.Deal:
+		default:
+			dropped = true
+		}
+	}
+
+	if pkg.Complaint != nil {
+		select {
+		case s.Complaint <- *pkg.Complaint:
+		default:
+			dropped = true
+		}
+	}
+
+	if pkg.EscrowShare != nil {
+		select {
+		case s.EscrowShare <- *pkg.EscrowShare:
+		default:
+			dropped = true
+		}
+	}
+
+	if pkg.Control != nil {
+		select {
+		case s.Control <- *pkg.Control:
+		default:
+			dropped = true
+		}
+	}
+
+	if pkg.Equivocation != nil {
+		select {
+		case s.Equivocation <- *pkg.Equivocation:
+		default:
+			dropped = true
+		}
+	}
+
+	if dropped {
+		log.Println("handler of poll " + pkg.ID.String() + " isn't reading, drop the packet for it")
+	}
 }
 
+const RunningPollBuffer = 64 // packets waiting for the handler of a poll
+
+// the writer of a poll is removed once its handler returns, the poll is
+// still known so that no other handler starts for it
 type RunningPollSet struct {
 	sync.RWMutex
-	m map[PollKeyMap]RunningPollWriter
+	m    map[PollKeyMap]RunningPollWriter
+	done map[PollKeyMap]bool
 }
 
 func (s *RunningPollSet) Has(k PollKey) bool {
@@ -199,7 +416,7 @@ func (s *RunningPollSet) Has(k PollKey) bool {
 	defer s.RUnlock()
 
 	_, ok := s.m[k.Pack()]
-	return ok
+	return ok || s.done[k.Pack()]
 }
 
 func (s *RunningPollSet) Get(k PollKey) RunningPollWriter {
@@ -214,29 +431,50 @@ func (s *RunningPollSet) Get(k PollKey) RunningPollWriter {
 func (s *RunningPollSet) Add(k PollKey, handler PoolPacketHandler) {
 	assert(!s.Has(k))
 
-	poll := make(chan Poll)
-	localVote := make(chan string)
-	commitment := make(chan Commitment)
-	voteKey := make(chan VoteKey)
-	voteKeys := make(chan VoteKeys)
-	vote := make(chan VoteAndSender)
+	poll := make(chan Poll, RunningPollBuffer)
+	localVote := make(chan string, RunningPollBuffer)
+	commitment := make(chan Commitment, RunningPollBuffer)
+	voteKey := make(chan VoteKey, RunningPollBuffer)
+	voteKeys := make(chan VoteKeys, RunningPollBuffer)
+	vote := make(chan VoteAndSender, RunningPollBuffer)
+	ballot := make(chan Ballot, RunningPollBuffer)
+	decryption := make(chan PartialDecryption, RunningPollBuffer)
+	deal := make(chan DKGDeal, RunningPollBuffer)
+	complaint := make(chan DKGComplaint, RunningPollBuffer)
+	escrowShare := make(chan EscrowShare, RunningPollBuffer)
+	control := make(chan PollControl, RunningPollBuffer)
+	equivocation := make(chan PollEquivocation, RunningPollBuffer)
 
 	r := RunningPollReader{
-		Poll:       poll,
-		LocalVote:  localVote,
-		VoteKey:    voteKey,
-		VoteKeys:   voteKeys,
-		Commitment: commitment,
-		Vote:       vote,
+		Poll:         poll,
+		LocalVote:    localVote,
+		VoteKey:      voteKey,
+		VoteKeys:     voteKeys,
+		Commitment:   commitment,
+		Vote:         vote,
+		Ballot:       ballot,
+		Decryption:   decryption,
+		Deal:         deal,
+		Complaint:    complaint,
+		EscrowShare:  escrowShare,
+		Control:      control,
+		Equivocation: equivocation,
 	}
 
 	w := RunningPollWriter{
-		Poll:       poll,
-		LocalVote:  localVote,
-		VoteKey:    voteKey,
-		VoteKeys:   voteKeys,
-		Commitment: commitment,
-		Vote:       vote,
+		Poll:         poll,
+		LocalVote:    localVote,
+		VoteKey:      voteKey,
+		VoteKeys:     voteKeys,
+		Commitment:   commitment,
+		Vote:         vote,
+		Ballot:       ballot,
+		Decryption:   decryption,
+		Deal:         deal,
+		Complaint:    complaint,
+		EscrowShare:  escrowShare,
+		Control:      control,
+		Equivocation: equivocation,
 	}
 
 	s.Lock()
@@ -248,15 +486,47 @@ func (s *RunningPollSet) Add(k PollKey, handler PoolPacketHandler) {
 		panic(err)
 	}
 
-	go handler(k, *key, r)
+	go func() {
+		handler(k, *key, r)
+		s.finish(k)
+	}()
 }
 
+func (s *RunningPollSet) finish(k PollKey) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.m, k.Pack())
+	s.done[k.Pack()] = true
+}
+
+// without keeping the set locked, nothing is sent once the handler is done
 func (s *RunningPollSet) Send(pkg PollPacket, fromPeer *net.UDPAddr) {
 	s.RLock()
-	defer s.RUnlock()
+	r, ok := s.m[pkg.ID.Pack()]
+	s.RUnlock()
 
-	r := s.m[pkg.ID.Pack()]
-	r.Send(pkg, fromPeer)
+	if ok {
+		r.Send(pkg, fromPeer)
+	}
+}
+
+// false if the handler is done or already has votes waiting
+func (s *RunningPollSet) SendLocalVote(k PollKey, option string) bool {
+	s.RLock()
+	r, ok := s.m[k.Pack()]
+	s.RUnlock()
+
+	if !ok {
+		return false
+	}
+
+	select {
+	case r.LocalVote <- option:
+		return true
+	default:
+		return false
+	}
 }
 
 type Route struct {
@@ -271,15 +541,20 @@ func Curve() elliptic.Curve {
 type Gossiper struct {
 	sync.RWMutex
 	Name         string
-	LastID       uint64
 	KeyPair      ecdsa.PrivateKey
 	Peers        PeerSet
 	RunningPolls RunningPollSet
 	Polls        PollSet
 	Server       Server
 	ValidKeys    [][2]big.Int
-	Reputations  ReputationInfo
+	Reputations  *ReputationInfo
+	Receiver     *Receiver
 	Status       Status
+	Cookies      Cookies
+	Pending      PendingPackets
+
+	AnonymousCreators AnonymousCreators
+	Schedules         Scheduler
 }
 
 func (g *Gossiper) addPeer(addr net.UDPAddr) {
@@ -308,11 +583,11 @@ func NewServer(address string) Server {
 
 type Status struct {
 	sync.RWMutex
-	PktStatus        map[SignatureMap]*PollPacket
-	ReputationStatus map[SignatureMap]*ReputationPacket
+	PktStatus        map[PacketDigest]GossipPacket
+	ReputationStatus map[PacketDigest]GossipPacket
 }
 
-func (s *Status) GetRep(k SignatureMap) *ReputationPacket {
+func (s *Status) GetRep(k PacketDigest) GossipPacket {
 	assert(s.HasRep(k))
 
 	s.RLock()
@@ -321,7 +596,7 @@ func (s *Status) GetRep(k SignatureMap) *ReputationPacket {
 	return s.ReputationStatus[k]
 }
 
-func (s *Status) HasRep(k SignatureMap) bool {
+func (s *Status) HasRep(k PacketDigest) bool {
 	s.RLock()
 	defer s.RUnlock()
 
@@ -330,21 +605,21 @@ func (s *Status) HasRep(k SignatureMap) bool {
 	return ok
 }
 
-func (s *Status) SetRep(k SignatureMap, r *ReputationPacket) {
+func (s *Status) SetRep(k PacketDigest, pkg GossipPacket) {
 	s.Lock()
 	defer s.Unlock()
 
-	s.ReputationStatus[k] = r
+	s.ReputationStatus[k] = pkg
 }
 
-func (s *Status) GetPkt(k SignatureMap) *PollPacket {
+func (s *Status) GetPkt(k PacketDigest) GossipPacket {
 	s.RLock()
 	defer s.RUnlock()
 
 	return s.PktStatus[k]
 }
 
-func (s *Status) HasPkt(k SignatureMap) bool {
+func (s *Status) HasPkt(k PacketDigest) bool {
 	s.RLock()
 	defer s.RUnlock()
 
@@ -353,11 +628,11 @@ func (s *Status) HasPkt(k SignatureMap) bool {
 	return ok
 }
 
-func (s *Status) SetPkt(k SignatureMap, p *PollPacket) {
+func (s *Status) SetPkt(k PacketDigest, pkg GossipPacket) {
 	s.Lock()
 	defer s.Unlock()
 
-	s.PktStatus[k] = p
+	s.PktStatus[k] = pkg
 }
 
 func NewGossiper(name string, server Server) (*Gossiper, error) {
@@ -371,6 +646,24 @@ func NewGossiper(name string, server Server) (*Gossiper, error) {
 		return nil, errors.New("NewGossiper: " + err.Error())
 	}
 
+	g := newGossiper(name, keyPair, validKeys, server)
+
+	err = g.Schedules.Load(ScheduleFileName)
+	if err != nil {
+		return nil, errors.New("NewGossiper: " + err.Error())
+	}
+
+	return g, nil
+}
+
+func newGossiper(name string, keyPair ecdsa.PrivateKey, validKeys [][2]big.Int, server Server) *Gossiper {
+	// we trust ourselves first, our opinions are known by our address
+	reputations := NewReputationInfo()
+	if server.Addr != nil {
+		reputations.Config.PreTrusted = []string{server.Addr.String()}
+		reputations.BindAddress(server.Addr.String(), keyPair.PublicKey)
+	}
+
 	return &Gossiper{
 		Name:    name,
 		KeyPair: keyPair,
@@ -379,62 +672,62 @@ func NewGossiper(name string, server Server) (*Gossiper, error) {
 			Set: make(map[string]bool),
 		},
 		RunningPolls: RunningPollSet{
-			m: make(map[PollKeyMap]RunningPollWriter),
+			m:    make(map[PollKeyMap]RunningPollWriter),
+			done: make(map[PollKeyMap]bool),
 		},
 		Polls: PollSet{
 			m: make(map[PollKeyMap]PollInfo),
 		},
 		ValidKeys:   validKeys,
-		Reputations: NewReputationInfo(),
+		Reputations: reputations,
+		Receiver:    NewReceiver(),
+		Cookies:     NewCookies(),
+		Pending:     NewPendingPackets(),
 		Status: Status{
-			PktStatus:        make(map[SignatureMap]*PollPacket),
-			ReputationStatus: make(map[SignatureMap]*ReputationPacket),
+			PktStatus:        make(map[PacketDigest]GossipPacket),
+			ReputationStatus: make(map[PacketDigest]GossipPacket),
+		},
+		AnonymousCreators: AnonymousCreators{
+			m: make(map[LinkTagMap]map[PollKeyMap]time.Time),
 		},
-	}, nil
+		Schedules: Scheduler{
+			m:    make(map[uint64]Schedule),
+			wake: make(chan bool, 1),
+		},
+	}
 }
 
-func NewPollKey(g *Gossiper) PollKey {
-	g.Lock()
-	defer g.Unlock()
-
+func NewPollKey(g *Gossiper, poll Poll) PollKey {
 	return PollKey{
-		ID:     atomic.AddUint64(&g.LastID, 1),
+		ID:     pollID(g.KeyPair.PublicKey, poll),
 		Origin: g.KeyPair.PublicKey,
 	}
 }
 
 type Dispatcher func(net.UDPAddr, GossipPacket)
 
+// packets are dispatched by a fixed number of workers, the ones of peers
+// over their rate or arriving while every worker is busy are dropped
 func RunServer(gossiper *Gossiper, server Server, dispatcher Dispatcher) {
 	buf := make([]byte, 16*1024)
 
+	queue := make(chan receivedPacket, gossiper.Receiver.Config.Queue)
+	for i := 0; i < gossiper.Receiver.Config.Workers; i++ {
+		go gossiper.dispatchWorker(queue, dispatcher)
+	}
+	go gossiper.logShedding(10 * time.Second)
+
 	for {
 		bufSize, peerAddr, err := server.Conn.ReadFromUDP(buf)
-		if err != nil {
+		if errors.Is(err, net.ErrClosed) {
+			close(queue)
+			return
+		} else if err != nil {
 			log.Println("dropped connection:", err)
 			continue
 		}
 
-		if gossiper.Reputations.IsBlacklisted(peerAddr.String()) {
-			log.Println("Received message from blacklisted peer. Ignoring...")
-			continue
-		}
-
-		var msg GossipPacketWire
-		err = protobuf.Decode(buf[:bufSize], &msg)
-		if err != nil {
-			log.Println("unable to decode msg:", err)
-			continue
-		}
-
-		err = msg.Check()
-		if err != nil {
-			log.Println("invalid GossipPacketWire received:", err)
-			return
-		}
-
-		pkg := msg.ToBase()
-		go dispatcher(*peerAddr, pkg)
+		gossiper.receive(buf[:bufSize], *peerAddr, queue)
 	}
 }
 
@@ -456,12 +749,16 @@ func getRandomPeer(peers *PeerSet, butNotThisPeer *net.UDPAddr) *net.UDPAddr {
 
 func writeMsgToUDP(server Server, peer *net.UDPAddr, poll *PollPacket, status *StatusPacket, signature *Signature,
 	reputation *ReputationPacket) {
-	msg := GossipPacket{
+	writePacketToUDP(server, peer, GossipPacket{
 		Poll:       poll,
 		Signature:  signature,
 		Status:     status,
 		Reputation: reputation,
-	}.ToWire()
+	})
+}
+
+func writePacketToUDP(server Server, peer *net.UDPAddr, pkg GossipPacket) {
+	msg := pkg.ToWire()
 	err := msg.Check()
 	if err != nil {
 		panic(err)
@@ -477,13 +774,28 @@ func writeMsgToUDP(server Server, peer *net.UDPAddr, poll *PollPacket, status *S
 
 func (g *Gossiper) SendPoll(id PollKey, msg Poll) {
 	pkg := PollPacket{
-		ID:   id,
-		Poll: &msg,
+		ID:       id,
+		Poll:     &msg,
+		Metadata: g.Polls.Get(id).Metadata,
 	}
-	sig, err := ecSignature(g, pkg)
+
+	key, ok := g.originKey(id)
+	if !ok {
+		log.Println("no key for the origin of the poll")
+		return
+	}
+	sig, err := ecSignatureBy(key, pkg)
 	if err != nil {
 		panic(err)
 	}
+
+	if msg.Anonymous {
+		sig.Linkable, err = g.anonymousSignature(pkg)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+	}
 	g.SendPollPacket(&pkg, &sig, nil)
 }
 
@@ -498,8 +810,8 @@ func (g *Gossiper) SendCommitment(id PollKey, msg Commitment, participants [][2]
 		return
 	}
 
-	lrs := linkableRingSignature(input, participants, &tmpKey, pos)
-	g.SendPollPacket(&pkg, &Signature{&lrs, nil}, nil)
+	sig := ringSignature(g.Polls.Get(id).Poll.Scheme, input, participants, &tmpKey, pos)
+	g.SendPollPacket(&pkg, &sig, nil)
 }
 
 func (g *Gossiper) SendVoteKey(id PollKey, msg VoteKey) {
@@ -522,7 +834,12 @@ func (g *Gossiper) SendVoteKeys(id PollKey, msg VoteKeys) {
 		VoteKeys: &msg,
 	}
 
-	sig, err := ecSignature(g, pkg)
+	key, ok := g.originKey(id)
+	if !ok {
+		log.Println("no key for the origin of the poll")
+		return
+	}
+	sig, err := ecSignatureBy(key, pkg)
 	if err != nil {
 		return
 	}
@@ -531,6 +848,10 @@ func (g *Gossiper) SendVoteKeys(id PollKey, msg VoteKeys) {
 }
 
 func ecSignature(g *Gossiper, poll PollPacket) (Signature, error) {
+	return ecSignatureBy(g.KeyPair, poll)
+}
+
+func ecSignatureBy(key ecdsa.PrivateKey, poll PollPacket) (Signature, error) {
 	input, err := json.Marshal(poll)
 	if err != nil {
 		log.Printf("unable to encode as json")
@@ -539,12 +860,12 @@ func ecSignature(g *Gossiper, poll PollPacket) (Signature, error) {
 
 	hash := sha256.New()
 	_, err = hash.Write(input)
-	r, s, err := ecdsa.Sign(secrand.Reader, &g.KeyPair, hash.Sum(nil))
+	r, s, err := ecdsa.Sign(secrand.Reader, &key, hash.Sum(nil))
 	if err != nil {
 		log.Printf("error generating elliptic curve signature")
 		return Signature{}, err
 	}
-	return Signature{nil, &EllipticCurveSignature{*r, *s}}, nil
+	return Signature{Elliptic: &EllipticCurveSignature{*r, *s}}, nil
 }
 
 func (g *Gossiper) SendVote(id PollKey, vote Vote, participants [][2]big.Int, tmpKey ecdsa.PrivateKey, pos int) {
@@ -559,8 +880,109 @@ func (g *Gossiper) SendVote(id PollKey, vote Vote, participants [][2]big.Int, tm
 		return
 	}
 
-	lrs := linkableRingSignature(input, participants, &tmpKey, pos)
-	g.SendPollPacket(&pkg, &Signature{&lrs, nil}, nil)
+	sig := ringSignature(g.Polls.Get(id).Poll.Scheme, input, participants, &tmpKey, pos)
+	g.SendPollPacket(&pkg, &sig, nil)
+}
+
+// ballots and decryptions are also stored locally, as the tally needs all of them
+func (g *Gossiper) sendRingSigned(pkg PollPacket, participants [][2]big.Int, tmpKey ecdsa.PrivateKey, pos int) {
+	input, err := json.Marshal(pkg)
+	if err != nil {
+		log.Printf("unable to encode as json")
+		return
+	}
+
+	sig := ringSignature(g.Polls.Get(pkg.ID).Poll.Scheme, input, participants, &tmpKey, pos)
+	g.Polls.Store(pkg)
+	signed := GossipPacket{Poll: &pkg, Signature: &sig}
+	digest, err := signed.Digest()
+	if err != nil {
+		log.Println("unable to digest our packet:", err)
+		return
+	}
+	g.Status.SetPkt(digest, signed)
+	g.SendPollPacket(&pkg, &sig, nil)
+}
+
+func (g *Gossiper) SendBallot(id PollKey, ballot Ballot, participants [][2]big.Int, tmpKey ecdsa.PrivateKey, pos int) {
+	g.sendRingSigned(PollPacket{
+		ID:     id,
+		Ballot: &ballot,
+	}, participants, tmpKey, pos)
+}
+
+func (g *Gossiper) SendDecryption(id PollKey, d PartialDecryption) {
+	g.sendECSigned(PollPacket{
+		ID:         id,
+		Decryption: &d,
+	})
+}
+
+// deals, complaints, escrow shares, decryptions and controls are also stored locally, as
+// the outcome of the poll needs all of them
+func (g *Gossiper) sendECSigned(pkg PollPacket) {
+	g.sendSignedBy(g.KeyPair, pkg)
+}
+
+func (g *Gossiper) sendSignedBy(key ecdsa.PrivateKey, pkg PollPacket) {
+	sig, err := ecSignatureBy(key, pkg)
+	if err != nil {
+		return
+	}
+
+	g.Polls.Store(pkg)
+	signed := GossipPacket{Poll: &pkg, Signature: &sig}
+	digest, err := signed.Digest()
+	if err != nil {
+		log.Println("unable to digest our packet:", err)
+		return
+	}
+	g.Status.SetPkt(digest, signed)
+	g.SendPollPacket(&pkg, &sig, nil)
+}
+
+func (g *Gossiper) SendDKGDeal(id PollKey, deal DKGDeal) {
+	g.sendECSigned(PollPacket{
+		ID:   id,
+		Deal: &deal,
+	})
+}
+
+func (g *Gossiper) SendDKGComplaint(id PollKey, complaint DKGComplaint) {
+	g.sendECSigned(PollPacket{
+		ID:        id,
+		Complaint: &complaint,
+	})
+}
+
+func (g *Gossiper) SendEscrowShare(id PollKey, share EscrowShare) {
+	g.sendECSigned(PollPacket{
+		ID:          id,
+		EscrowShare: &share,
+	})
+	g.openEscrow(id, share.Commitment)
+}
+
+// any peer can gossip the evidence of an equivocating origin
+func (g *Gossiper) SendPollEquivocation(id PollKey, evidence PollEquivocation) {
+	g.sendECSigned(PollPacket{
+		ID:           id,
+		Equivocation: &evidence,
+	})
+}
+
+// only the origin of the poll can control it
+func (g *Gossiper) SendPollControl(id PollKey, control PollControl) {
+	key, ok := g.originKey(id)
+	if !ok {
+		log.Println("no key for the origin of the poll")
+		return
+	}
+
+	g.sendSignedBy(key, PollPacket{
+		ID:      id,
+		Control: &control,
+	})
 }
 
 func (g *Gossiper) SendPollPacket(msg *PollPacket, sig *Signature, fromPeer *net.UDPAddr) {
@@ -579,52 +1001,54 @@ func (g *Gossiper) SendPollPacket(msg *PollPacket, sig *Signature, fromPeer *net
 	}
 }
 
-func getStatus(g *Gossiper) StatusPacketMap {
+func getStatus(g *Gossiper) StatusPacket {
 	g.Status.RLock()
 	defer g.Status.RUnlock()
 
-	signatures := make(map[SignatureMap]bool)
+	signatures := make(map[PacketDigest]bool)
 	for sig := range g.Status.PktStatus {
 		signatures[sig] = true
 	}
 
-	reputations := make(map[SignatureMap]bool)
+	reputations := make(map[PacketDigest]bool)
 	for rep := range g.Status.ReputationStatus {
 		reputations[rep] = true
 	}
 
-	return StatusPacketMap{
-		signatures,
-		reputations,
+	return StatusPacket{
+		PollPkts:       signatures,
+		ReputationPkts: reputations,
+		Signer:         g.KeyPair.PublicKey,
 	}
 }
 
-func syncStatus(g *Gossiper, peer net.UDPAddr, status StatusPacket) {
-	rcvStatus := status.toMap()
+// sends at most budget packets, the next status asks for the rest
+func syncStatus(g *Gossiper, peer net.UDPAddr, rcvStatus StatusPacket, budget int) {
 	// check if peer is missing something and send it to him
 	myStatus := getStatus(g)
-	for wireSig := range myStatus.ReputationPkts {
-		_, exist := rcvStatus.ReputationPkts[wireSig]
-		if !exist {
-			sig := wireSig.toBase()
-			writeMsgToUDP(g.Server, &peer, nil, nil, &sig, g.Status.GetRep(wireSig))
+	for digest := range myStatus.ReputationPkts {
+		_, exist := rcvStatus.ReputationPkts[digest]
+		if !exist && budget > 0 {
+			stored := g.Status.GetRep(digest)
+			writeMsgToUDP(g.Server, &peer, nil, nil, stored.Signature, stored.Reputation)
+			budget--
 		}
 	}
 
-	for wireSig := range myStatus.PollPkts {
-		_, exist := rcvStatus.PollPkts[wireSig]
-		if !exist {
-			sig := wireSig.toBase()
-			writeMsgToUDP(g.Server, &peer, g.Status.GetPkt(wireSig), nil, &sig, nil)
+	for digest := range myStatus.PollPkts {
+		_, exist := rcvStatus.PollPkts[digest]
+		if !exist && budget > 0 {
+			stored := g.Status.GetPkt(digest)
+			writeMsgToUDP(g.Server, &peer, stored.Poll, nil, stored.Signature, nil)
+			budget--
 		}
 	}
 
 	// check if I am missing something and request it
-	myStatusBase := myStatus.toBase()
 	for rep := range rcvStatus.ReputationPkts {
 		_, exist := myStatus.ReputationPkts[rep]
 		if !exist {
-			writeMsgToUDP(g.Server, &peer, nil, &myStatusBase, nil, nil)
+			g.sendStatus(&peer)
 			return
 		}
 	}
@@ -632,112 +1056,452 @@ func syncStatus(g *Gossiper, peer net.UDPAddr, status StatusPacket) {
 	for sig := range rcvStatus.PollPkts {
 		_, exist := myStatus.PollPkts[sig]
 		if !exist {
-			writeMsgToUDP(g.Server, &peer, nil, &myStatusBase, nil, nil)
+			g.sendStatus(&peer)
 			return
 		}
 	}
 }
 
 func DispatcherPeersterMessage(g *Gossiper) Dispatcher {
-	return func(fromPeer net.UDPAddr, pkg GossipPacket) {
-		g.addPeer(fromPeer)
+	var dispatch Dispatcher
+	dispatch = func(fromPeer net.UDPAddr, pkg GossipPacket) {
+		// the address of a status might be spoofed, it is added once checked
+		if pkg.Status == nil && pkg.Cookie == nil {
+			g.addPeer(fromPeer)
+		}
 
 		if pkg.Poll != nil {
 			poll := *pkg.Poll
 
+			digest, err := pkg.Digest()
+			if err != nil {
+				log.Println("unable to digest the packet of " + fromPeer.String() + ": " + err.Error())
+				return
+			}
+
+			// already checked and stored, no need to verify it again
+			if g.Status.HasPkt(digest) {
+				return
+			}
+
+			// reordered by the network, not invalid
+			if !g.dependenciesKnown(pkg) {
+				g.holdPacket(fromPeer, pkg, dispatch)
+				return
+			}
+
 			if !g.SignatureValid(pkg) {
 				log.Println("invalid signature found, suspect sender " + fromPeer.String())
-				g.Reputations.Suspect(fromPeer.String())
+				g.Reputations.Offend(fromPeer.String(), OffenceInvalidSignature, &poll.ID)
+				return
+			}
+
+			if pkg.Poll.Poll != nil && g.Reputations.IsEquivocator(pkg.Poll.ID.Origin) {
+				log.Println("poll of an equivocating origin, drop it")
+				return
+			}
+
+			if pkg.Poll.Poll != nil && pkg.Poll.Poll.Anonymous &&
+				!g.AnonymousCreators.Allow(pkg.Signature.Linkable.Tag, pkg.Poll.ID, pkg.Poll.Poll.StartTime) {
+				log.Println("anonymous creator started too many polls, drop it")
+				return
+			}
+
+			if pkg.Poll.Poll != nil {
+				if evidence, ok := g.pollEquivocation(pkg); ok {
+					log.Println("origin signed two poll bodies, gossip the evidence")
+					g.Reputations.SuspectOrigin(pkg.Poll.ID.Origin)
+					g.SendPollEquivocation(pkg.Poll.ID, evidence)
+					if g.RunningPolls.Has(pkg.Poll.ID) {
+						g.RunningPolls.Send(PollPacket{ID: pkg.Poll.ID, Equivocation: &evidence}, &fromPeer)
+					}
+					return
+				}
+			}
+
+			if pkg.Poll.Poll != nil && pkg.Poll.ID.ID != pollID(pkg.Poll.ID.Origin, *pkg.Poll.Poll) {
+				log.Println("poll body does not match its id, suspect sender " + fromPeer.String())
+				g.Reputations.Offend(fromPeer.String(), OffenceInvalidMessage, &poll.ID)
+				return
+			}
+
+			if pkg.Poll.Poll != nil && !pkg.Poll.Poll.weightsValid(g.ValidKeys) {
+				log.Println("poll with an invalid weight registry, suspect sender " + fromPeer.String())
+				g.Reputations.Offend(fromPeer.String(), OffenceInvalidMessage, &poll.ID)
+				return
+			}
+
+			if pkg.Poll.Poll != nil && !pkg.Poll.Poll.trusteesValid(g.ValidKeys) {
+				log.Println("poll with invalid trustees, suspect sender " + fromPeer.String())
+				g.Reputations.Offend(fromPeer.String(), OffenceInvalidMessage, &poll.ID)
 				return
 			}
 
-			if pkg.Signature.Linkable != nil {
+			if pkg.Poll.VoteKey != nil && !g.voteKeyWeightValid(pkg) {
+				log.Println("vote key with a wrong weight, suspect sender " + fromPeer.String())
+				g.Reputations.Offend(fromPeer.String(), OffenceInvalidMessage, &poll.ID)
+				return
+			}
+
+			if pkg.Poll.Equivocation != nil {
+				if !pkg.Poll.Equivocation.Valid(pkg.Poll.ID) {
+					log.Println("invalid equivocation evidence, suspect sender " + fromPeer.String())
+					g.Reputations.Offend(fromPeer.String(), OffenceFalseEvidence, &poll.ID)
+					return
+				}
+				g.Reputations.SuspectOrigin(pkg.Poll.ID.Origin)
+			}
+
+			if poll.isRingSigned() {
 				if doubleVoted(g, pkg) {
 					log.Println("double vote, suspect sender " + fromPeer.String())
-					g.Reputations.Suspect(fromPeer.String())
+					g.Reputations.Offend(fromPeer.String(), OffenceDoubleVote, &poll.ID)
+					if stored, ok := g.doubleVoteOf(pkg); ok {
+						g.SendEvidence(fromPeer, OffenceDoubleVote, stored, pkg)
+					}
+					return
+				}
+				if pkg.Poll.Commitment != nil && invalidCommitment(g, pkg) {
+					log.Println("commitment to an invalid option, suspect sender " + fromPeer.String())
+					g.Reputations.Offend(fromPeer.String(), OffenceInvalidMessage, &poll.ID)
+					return
+				}
+				if pkg.Poll.Commitment != nil && pkg.Poll.Commitment.Sequence > 0 &&
+					time.Now().After(g.Polls.Get(pkg.Poll.ID).commitDeadline()) {
+					log.Println("new commitment after the deadline, drop it")
 					return
 				}
 				if pkg.Poll.Vote != nil && invalidVote(g, pkg) {
 					log.Println("invalid open message , suspect sender " + fromPeer.String())
-					g.Reputations.Suspect(fromPeer.String())
+					g.Reputations.Offend(fromPeer.String(), OffenceInvalidReveal, &poll.ID)
+					if commit, ok := g.commitmentOf(pkg); ok {
+						g.SendEvidence(fromPeer, OffenceInvalidReveal, commit, pkg)
+					}
+					return
+				}
+				if pkg.Poll.Ballot != nil && invalidBallot(g, pkg) {
+					log.Println("invalid ballot, suspect sender " + fromPeer.String())
+					g.Reputations.Offend(fromPeer.String(), OffenceInvalidMessage, &poll.ID)
 					return
 				}
 				g.storeTag(pkg)
 			}
 
+			if pkg.Poll.Deal != nil && !pkg.Poll.Deal.wellFormed(g.Polls.Get(pkg.Poll.ID).Poll) {
+				log.Println("malformed DKG deal, suspect sender " + fromPeer.String())
+				g.Reputations.Offend(fromPeer.String(), OffenceInvalidMessage, &poll.ID)
+				return
+			}
+
+			if pkg.Poll.Complaint != nil && unjustifiedComplaint(g, pkg) {
+				log.Println("unjustified DKG complaint, suspect sender " + fromPeer.String())
+				g.Reputations.Offend(fromPeer.String(), OffenceInvalidMessage, &poll.ID)
+				return
+			}
+
+			if pkg.Poll.Decryption != nil {
+				info := g.Polls.Get(pkg.Poll.ID)
+				ballots, known := info.ballotsOf(*pkg.Poll.Decryption)
+				if !known {
+					g.holdPacket(fromPeer, pkg, dispatch)
+					return
+				}
+				if info.Poll.Tally != TallyHomomorphic ||
+					!pkg.Poll.Decryption.Valid(pkg.Poll.ID, *info.DKG, ballots, len(info.Poll.Options)) {
+					log.Println("invalid decryption, suspect sender " + fromPeer.String())
+					g.Reputations.Offend(fromPeer.String(), OffenceInvalidMessage, &poll.ID)
+					return
+				}
+			}
+
+			if pkg.Poll.EscrowShare != nil {
+				info := g.Polls.Get(pkg.Poll.ID)
+				commit, tag, known := info.committed(pkg.Poll.EscrowShare.Commitment)
+				if !known {
+					g.holdPacket(fromPeer, pkg, dispatch)
+					return
+				}
+				if commit.Escrow == nil || !pkg.Poll.EscrowShare.Valid(pkg.Poll.ID, tag, *commit.Escrow) {
+					log.Println("invalid escrow share, suspect sender " + fromPeer.String())
+					g.Reputations.Offend(fromPeer.String(), OffenceInvalidMessage, &poll.ID)
+					return
+				}
+			}
+
 			added := g.Polls.Store(poll)
 			if !added {
 				return
 			}
 
+			// votes, escrow shares and decryptions might wait for them
+			if poll.Commitment != nil || poll.Ballot != nil {
+				go g.releasePending(poll.ID)
+			}
+
+			if poll.Poll != nil {
+				g.storePollSignature(poll.ID, *pkg.Signature.Elliptic)
+				go g.releasePending(poll.ID)
+			}
+
 			poll.Print(fromPeer)
 
-			g.Status.SetPkt(pkg.Signature.toMap(), pkg.Poll)
+			g.Status.SetPkt(digest, pkg)
+
+			if poll.EscrowShare != nil {
+				g.openEscrow(poll.ID, poll.EscrowShare.Commitment)
+			}
 
 			if !g.RunningPolls.Has(poll.ID) {
 				g.RunningPolls.Add(poll.ID, VoterHandler(g))
 			}
 
-			assert(g.RunningPolls.Has(poll.ID))
 			g.RunningPolls.Send(poll, &fromPeer)
 		}
 
 		if pkg.Status != nil {
-			status := *pkg.Status
-			syncStatus(g, fromPeer, status)
+			g.handleStatus(fromPeer, pkg)
+		}
+
+		if pkg.Cookie != nil {
+			g.handleCookie(fromPeer, pkg)
+		}
+
+		if pkg.Evidence != nil {
+			g.handleEvidence(fromPeer, pkg)
 		}
 
 		if pkg.Reputation != nil {
+			digest, err := pkg.Digest()
+			if err != nil {
+				log.Println("unable to digest the reputation of " + fromPeer.String() + ": " + err.Error())
+				return
+			}
 
-			if g.Status.HasRep(pkg.Signature.toMap()) {
+			if g.Status.HasRep(digest) {
+				return
+			}
+
+			// keys anyone can make would grow the rounds and end them early
+			if _, ok := containsKey(g.ValidKeys, pkg.Reputation.Signer); !ok {
+				log.Println("opinions signed by an unknown key, drop them")
 				return
 			}
 
 			if !repSignatureValid(g, pkg) {
-				g.Reputations.Suspect(fromPeer.String())
+				g.Reputations.Offend(fromPeer.String(), OffenceInvalidSignature, &pkg.Reputation.PollID)
+				return
 			}
 
-			g.Status.SetRep(pkg.Signature.toMap(), pkg.Reputation)
+			g.Status.SetRep(digest, pkg)
 
 			pollID := pkg.Reputation.PollID
 
-			// store Reputation in receivedOpinions[poll]
+			// store Reputation in receivedOpinions[poll], the round ends once they all arrived
 			g.Reputations.AddPeerOpinion(pkg.Reputation, pollID)
 
-			if len(g.Reputations.PeersOpinions[pollID]) == len(g.Polls.Get(pollID).Participants) {
-				g.Reputations.AddReputations(pollID)
-				g.Reputations.AddTablesWait[pollID] <- true
+			g.SendReputation(pollID, &fromPeer)
+		}
+	}
+
+	return dispatch
+}
+
+// if the poll has trustees, the opening has to be escrowed to them
+func invalidCommitment(g *Gossiper, pkg GossipPacket) bool {
+	poll := g.Polls.Get(pkg.Poll.ID).Poll
+	commit := *pkg.Poll.Commitment
+
+	if len(poll.Trustees) > 0 && (commit.Escrow == nil || !commit.Escrow.wellFormed(poll, commit.Point)) {
+		return true
+	}
+
+	if !poll.Revoting && commit.Sequence != 0 {
+		return true
+	}
+
+	return !commit.Valid(pkg.Poll.ID, pkg.Signature.LinkTag(), len(poll.Options))
+}
+
+// the commitment with the given digest and the tag it was sent under
+func (info ShareablePollInfo) committed(digest [sha256.Size]byte) (Commitment, [2]*big.Int, bool) {
+	for tag, digests := range info.Tags {
+		for _, d := range digests {
+			if d != digest {
+				continue
 			}
 
-			g.SendReputation(pollID, &fromPeer)
+			for _, c := range info.Commitments {
+				if c.Digest() == digest {
+					return c, tag.toBase(), true
+				}
+			}
+		}
+	}
+
+	return Commitment{}, [2]*big.Int{}, false
+}
+
+func containsDigest(digests [][sha256.Size]byte, digest [sha256.Size]byte) bool {
+	for _, d := range digests {
+		if d == digest {
+			return true
+		}
+	}
+	return false
+}
+
+func (info ShareablePollInfo) sequenceOf(digest [sha256.Size]byte) (uint64, bool) {
+	for _, c := range info.Commitments {
+		if c.Digest() == digest {
+			return c.Sequence, true
+		}
+	}
+
+	return 0, false
+}
+
+// the commitment sent under the tag which supersedes the others
+func (info ShareablePollInfo) finalCommitment(tag LinkTagMap) ([sha256.Size]byte, bool) {
+	var ret [sha256.Size]byte
+	found := false
+	var last uint64
+
+	for _, d := range info.Tags[tag] {
+		sequence, ok := info.sequenceOf(d)
+		if ok && (!found || sequence > last) {
+			ret, last, found = d, sequence, true
+		}
+	}
+
+	return ret, found
+}
+
+func (info ShareablePollInfo) superseded(tag LinkTagMap, digest [sha256.Size]byte) bool {
+	if !info.Poll.Revoting {
+		return false
+	}
+
+	final, ok := info.finalCommitment(tag)
+	return ok && final != digest
+}
+
+// commitments with an escrow which were neither revealed nor opened yet
+func (info ShareablePollInfo) unrevealed() [][sha256.Size]byte {
+	var ret [][sha256.Size]byte
+	for _, c := range info.Commitments {
+		digest := c.Digest()
+		if c.Escrow == nil || containsDigest(info.Revealed, digest) || containsDigest(info.EscrowOpened, digest) {
+			continue
+		}
+
+		if _, tag, ok := info.committed(digest); ok && !info.superseded(LinkTagMapFrom(tag), digest) {
+			ret = append(ret, digest)
+		}
+	}
+	return ret
+}
+
+// opens the commitment with the escrow shares, if there are enough of them,
+// the opening counts as the vote of the missing voter
+func (g *Gossiper) openEscrow(id PollKey, digest [sha256.Size]byte) {
+	g.Polls.Lock()
+	defer g.Polls.Unlock()
+
+	info := g.Polls.m[id.Pack()]
+	if containsDigest(info.Revealed, digest) || containsDigest(info.EscrowOpened, digest) {
+		return
+	}
+
+	commit, tag, known := info.committed(digest)
+	if !known || info.superseded(LinkTagMapFrom(tag), digest) {
+		return
+	}
+
+	vote, ok := openEscrow(id, info.Poll, tag, commit, info.EscrowShares)
+	if !ok {
+		return
+	}
+
+	info.Votes = append(info.Votes, vote)
+	info.EscrowOpened = append(info.EscrowOpened, digest)
+	g.Polls.m[id.Pack()] = info
+	log.Printf("opened an unrevealed commitment with the escrow of the trustees")
+}
+
+// digest of the commitment opened by the vote, false if the vote doesn't
+// open a commitment sent under the same tag
+func openedCommitment(info ShareablePollInfo, pkg GossipPacket) ([sha256.Size]byte, bool) {
+	tag := pkg.Signature.LinkTag()
+
+	commit, ok := pkg.Poll.Vote.Commitment(pkg.Poll.ID, tag, info.Poll.Options)
+	if !ok {
+		return [sha256.Size]byte{}, false
+	}
+
+	digest := commit.Digest()
+	for _, c := range info.Tags[LinkTagMapFrom(tag)] {
+		if c == digest {
+			return digest, true
 		}
 	}
+
+	return digest, false
 }
 
+// with re-voting, only the final commitment can be opened
 func invalidVote(g *Gossiper, pkg GossipPacket) bool {
-	var hash [sha256.Size]byte
-	vote := *pkg.Poll.Vote
+	info := g.Polls.Get(pkg.Poll.ID).ShareablePollInfo
+	digest, ok := openedCommitment(info, pkg)
+	return !ok || info.superseded(LinkTagMapFrom(pkg.Signature.LinkTag()), digest)
+}
 
-	toHash := make([]byte, 0)
-	toHash = append(toHash, []byte(vote.Option)[:]...)
-	toHash = append(toHash, vote.Salt[:]...)
+func invalidBallot(g *Gossiper, pkg GossipPacket) bool {
+	info := g.Polls.Get(pkg.Poll.ID)
 
-	hash = sha256.Sum256(toHash)
+	return info.Poll.Tally != TallyHomomorphic ||
+		!pkg.Poll.Ballot.Valid(pkg.Poll.ID, info.DKG.PublicKey(), len(info.Poll.Options))
+}
 
-	if g.Status.HasPkt(pkg.Signature.toMap()) {
-		storedPkg := g.Status.GetPkt(pkg.Signature.toMap())
-		return !(string(storedPkg.Commitment.Hash[:]) == string(hash[:]))
+// complaints about unknown deals are kept, the deal might come later
+func unjustifiedComplaint(g *Gossiper, pkg GossipPacket) bool {
+	info := g.Polls.Get(pkg.Poll.ID)
+	complaint := *pkg.Poll.Complaint
+
+	for _, d := range info.Deals {
+		if d.Dealer == complaint.Dealer && !complaint.Justified(pkg.Poll.ID, info.Poll, d) {
+			return true
+		}
 	}
 
-	return true
+	return false
 }
 
 func doubleVoted(g *Gossiper, pkg GossipPacket) bool {
-	tag := pkg.Signature.Linkable.Tag
-	commit, stored := g.Polls.Get(pkg.Poll.ID).Tags[tag]
+	var sent [sha256.Size]byte
+	if pkg.Poll.Commitment != nil {
+		sent = pkg.Poll.Commitment.Digest()
+	} else if pkg.Poll.Ballot != nil {
+		sent = pkg.Poll.Ballot.Digest()
+	} else {
+		return false
+	}
+
+	tag := LinkTagMapFrom(pkg.Signature.LinkTag())
+	info := g.Polls.Get(pkg.Poll.ID)
+	commit, stored := info.Tags[tag]
+
+	// a new commitment has to come with a new sequence number
+	if info.Poll.Revoting && pkg.Poll.Commitment != nil {
+		for _, d := range commit {
+			if sequence, ok := info.sequenceOf(d); ok && sequence == pkg.Poll.Commitment.Sequence && d != sent {
+				return true
+			}
+		}
+		return false
+	}
 
 	if stored && len(commit) == 1 {
-		return !(string(commit[0].Hash[:]) == string(pkg.Poll.Commitment.Hash[:]))
+		return commit[0] != sent
 	}
 
 	return false
@@ -746,11 +1510,28 @@ func doubleVoted(g *Gossiper, pkg GossipPacket) bool {
 func (g *Gossiper) SignatureValid(pkg GossipPacket) bool {
 	poll := pkg.Poll
 
-	if (poll.Commitment != nil || poll.Vote != nil) && !(poll.Commitment != nil && poll.Vote != nil) {
-		return pkg.Signature.Linkable != nil && verifySig(*pkg.Signature.Linkable, g.Polls.Get(pkg.Poll.ID).Participants)
+	if !g.anonymousSignatureValid(pkg) {
+		return false
+	}
+
+	if poll.Metadata != nil && !g.metadataValid(pkg) {
+		return false
+	}
+
+	if poll.isRingSigned() {
+		if !ringSignsPacket(pkg) {
+			return false
+		}
+
+		info := g.Polls.Get(pkg.Poll.ID)
+		return verifyRingSignature(*pkg.Signature, info.Poll.Scheme, info.ring(poll.weight()))
+	}
+
+	if poll.Deal != nil || poll.Complaint != nil || poll.EscrowShare != nil || poll.Decryption != nil {
+		return g.trusteeSignatureValid(pkg)
 	}
 
-	if poll.VoteKeys != nil || poll.Poll != nil || poll.VoteKey != nil {
+	if poll.VoteKeys != nil || poll.Poll != nil || poll.VoteKey != nil || poll.Control != nil || poll.Equivocation != nil {
 		input, err := json.Marshal(poll)
 		if err != nil {
 			log.Printf("unable to encode as json")
@@ -758,9 +1539,9 @@ func (g *Gossiper) SignatureValid(pkg GossipPacket) bool {
 
 		hash := sha256.Sum256(input)
 
-		if poll.VoteKey != nil {
+		if poll.VoteKey != nil || poll.Equivocation != nil {
 			for _,pubkey := range g.ValidKeys{
-				ecKey := ecdsa.PublicKey{Curve(), &pubkey[0], &pubkey[1]}
+				ecKey := ecdsa.PublicKey{Curve: Curve(), X: &pubkey[0], Y: &pubkey[1]}
 				if  pkg.Signature.Elliptic != nil && ecdsa.Verify(&ecKey, hash[:],
 					&pkg.Signature.Elliptic.R, &pkg.Signature.Elliptic.S){
 					return true
@@ -774,42 +1555,123 @@ func (g *Gossiper) SignatureValid(pkg GossipPacket) bool {
 	}
 	return false
 }
+
+// deals, complaints and escrow shares are signed by the trustee sending them
+func (g *Gossiper) trusteeSignatureValid(pkg GossipPacket) bool {
+	poll := g.Polls.Get(pkg.Poll.ID).Poll
+
+	trustee := -1
+	if pkg.Poll.Deal != nil {
+		trustee = pkg.Poll.Deal.Dealer
+	} else if pkg.Poll.Complaint != nil {
+		trustee = pkg.Poll.Complaint.Accuser
+	} else if pkg.Poll.EscrowShare != nil {
+		trustee = pkg.Poll.EscrowShare.Trustee
+	} else if pkg.Poll.Decryption != nil {
+		trustee = pkg.Poll.Decryption.Trustee
+	}
+
+	if trustee < 0 || trustee >= len(poll.Trustees) || pkg.Signature.Elliptic == nil {
+		return false
+	}
+
+	input, err := json.Marshal(pkg.Poll)
+	if err != nil {
+		log.Printf("unable to encode as json")
+		return false
+	}
+
+	hash := sha256.Sum256(input)
+	key := poll.Trustees[trustee].toEcdsa()
+
+	return ecdsa.Verify(&key, hash[:], &pkg.Signature.Elliptic.R, &pkg.Signature.Elliptic.S)
+}
+
 func (g *Gossiper) storeTag(pkg GossipPacket) {
 	id := pkg.Poll.ID
 
-	var commit Commitment
+	var commit [sha256.Size]byte
 	if pkg.Poll.Commitment != nil {
-		commit = *pkg.Poll.Commitment
+		commit = pkg.Poll.Commitment.Digest()
 	} else if pkg.Poll.Vote != nil {
-		vote := *pkg.Poll.Vote
-
-		toHash := make([]byte, 0)
-		toHash = append(toHash, []byte(vote.Option)[:]...)
-		toHash = append(toHash, vote.Salt[:]...)
-
-		hash := sha256.Sum256(toHash)
-
-		commit = Commitment{
-			Hash: hash,
+		digest, ok := openedCommitment(g.Polls.Get(id).ShareablePollInfo, pkg)
+		if !ok {
+			return
 		}
+		commit = digest
+	} else if pkg.Poll.Ballot != nil {
+		commit = pkg.Poll.Ballot.Digest()
+	} else {
+		return
 	}
 
 	g.Polls.Lock()
 	defer g.Polls.Unlock()
 
-	commitments := g.Polls.m[id.Pack()].Tags[pkg.Signature.Linkable.Tag]
+	tag := LinkTagMapFrom(pkg.Signature.LinkTag())
+	commitments := g.Polls.m[id.Pack()].Tags[tag]
 
 	addCommitment := true
 	for _, com := range commitments {
-		if string(com.Hash[:]) == string(commit.Hash[:]) {
+		if com == commit {
 			addCommitment = false
 		}
 	}
 
-	if addCommitment {
-		commitments = append(commitments, commit)
+	if addCommitment && pkg.Poll.Commitment != nil && g.Polls.m[id.Pack()].Poll.Revoting {
+		g.Polls.m[id.Pack()].Tags[tag] = g.supersede(id, tag, commitments, *pkg.Poll.Commitment)
+	} else {
+		if addCommitment {
+			commitments = append(commitments, commit)
+		}
+		g.Polls.m[id.Pack()].Tags[tag] = commitments
+	}
+
+	if pkg.Poll.Vote != nil {
+		g.markRevealed(id, commit)
+	}
+}
+
+// inserts the commitment in the history of the tag, ordered by sequence, and
+// drops the votes opening the commitments it supersedes. Called with the lock
+// held.
+func (g *Gossiper) supersede(id PollKey, tag LinkTagMap, history [][sha256.Size]byte, commit Commitment) [][sha256.Size]byte {
+	info := g.Polls.m[id.Pack()]
+
+	position := len(history)
+	for i, d := range history {
+		if sequence, ok := info.sequenceOf(d); ok && sequence > commit.Sequence {
+			position = i
+			break
+		}
+	}
+
+	ret := append(append(append([][sha256.Size]byte{}, history[:position]...), commit.Digest()), history[position:]...)
+	final := ret[len(ret)-1]
+
+	votes := make([]Vote, 0, len(info.Votes))
+	for _, v := range info.Votes {
+		opened, ok := v.Commitment(id, tag.toBase(), info.Poll.Options)
+		if ok && opened.Digest() != final && containsDigest(ret, opened.Digest()) {
+			log.Println("vote superseded by a new commitment, drop it")
+			continue
+		}
+		votes = append(votes, v)
+	}
+
+	info.Votes = votes
+	g.Polls.m[id.Pack()] = info
+
+	return ret
+}
+
+// called with the lock held
+func (g *Gossiper) markRevealed(id PollKey, digest [sha256.Size]byte) {
+	info := g.Polls.m[id.Pack()]
+	if !containsDigest(info.Revealed, digest) {
+		info.Revealed = append(info.Revealed, digest)
+		g.Polls.m[id.Pack()] = info
 	}
-	g.Polls.m[id.Pack()].Tags[pkg.Signature.Linkable.Tag] = commitments
 }
 
 func parseAddr(str string) *net.UDPAddr {
@@ -833,7 +1695,6 @@ func AntiEntropyGossip(gossiper *Gossiper) {
 		}
 
 		//printFlippedCoin(peer, "status")
-		status := getStatus(gossiper).toBase()
-		writeMsgToUDP(gossiper.Server, peer, nil, &status, nil, nil)
+		gossiper.sendStatus(peer)
 	}
 }
@@ -0,0 +1,274 @@
+package pollparty
+
+import (
+	"crypto/ecdsa"
+	crypto "crypto/rand"
+	"encoding/json"
+	"github.com/dedis/protobuf"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// consumes everything sent to a running poll, for tests without network
+func drainHandler(id PollKey, key ecdsa.PrivateKey, r RunningPollReader) {
+	for {
+		select {
+		case <-r.Poll:
+		case <-r.LocalVote:
+		case <-r.VoteKey:
+		case <-r.VoteKeys:
+		case <-r.Commitment:
+		case <-r.Vote:
+		case <-r.Ballot:
+		case <-r.Decryption:
+		case <-r.Deal:
+		case <-r.Complaint:
+		case <-r.EscrowShare:
+		case <-r.Control:
+		case <-r.Equivocation:
+		}
+	}
+}
+
+func wireRoundTrip(t *testing.T, pkg GossipPacket) GossipPacket {
+	wire := pkg.ToWire()
+	buf, err := protobuf.Encode(&wire)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded GossipPacketWire
+	if err := protobuf.Decode(buf, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := decoded.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	return decoded.ToBase()
+}
+
+func TestDispatchHundredVoters(t *testing.T) {
+	if testing.Short() {
+		t.Skip("signing for a hundred voters is slow")
+	}
+
+	const numVoters = 100
+
+	g := DummyGossiper()
+	dispatch := DispatcherPeersterMessage(g)
+	peer := *parseAddr("127.0.0.1:5001")
+
+	body := DummyPoll()
+	id := PollKey{g.KeyPair.PublicKey, pollID(g.KeyPair.PublicKey, *body)}
+	g.RunningPolls.Add(id, drainHandler)
+
+	poll := PollPacket{
+		ID:   id,
+		Poll: body,
+	}
+	sig, err := ecSignature(g, poll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatch(peer, wireRoundTrip(t, GossipPacket{Poll: &poll, Signature: &sig}))
+
+	keys := make([]*ecdsa.PrivateKey, numVoters)
+	participants := make([][2]big.Int, numVoters)
+	for i := range keys {
+		keys[i], err = ecdsa.GenerateKey(Curve(), crypto.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		participants[i] = [2]big.Int{*keys[i].X, *keys[i].Y}
+	}
+	g.storeParticipants(id, participants, nil)
+
+	send := func(pkg PollPacket, pos int) {
+		input, err := json.Marshal(pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sig := ringSignature(poll.Poll.Scheme, input, participants, keys[pos], pos)
+		dispatch(peer, wireRoundTrip(t, GossipPacket{Poll: &pkg, Signature: &sig}))
+	}
+
+	votes := make([]Vote, numVoters)
+	for i := range keys {
+		option := poll.Poll.Options[i%len(poll.Poll.Options)]
+		commit, salt, err := NewCommitment(id, ringTag(participants, keys[i]), poll.Poll.Options, option)
+		if err != nil {
+			t.Fatal(err)
+		}
+		votes[i] = Vote{Salt: salt, Option: option}
+
+		send(PollPacket{ID: id, Commitment: &commit}, i)
+	}
+
+	for i := range keys {
+		send(PollPacket{ID: id, Vote: &votes[i]}, i)
+	}
+
+	if len(g.Reputations.Opinions) != 0 {
+		t.Errorf("Honest voters were suspected: %v", g.Reputations.Opinions)
+	}
+
+	info := g.Polls.Get(id)
+	if len(info.Commitments) != numVoters || len(info.Votes) != numVoters {
+		t.Errorf("Expected %d commitments and votes, got %d and %d", numVoters,
+			len(info.Commitments), len(info.Votes))
+	}
+
+	for _, option := range poll.Poll.Options {
+		if info.Results()[option] != numVoters/len(poll.Poll.Options) {
+			t.Errorf("Wrong results: %v", info.Results())
+		}
+	}
+
+	status := getStatus(g)
+	if len(status.PollPkts) != 1+2*numVoters {
+		t.Errorf("Expected %d packets in status, got %d", 1+2*numVoters, len(status.PollPkts))
+	}
+
+	wire := status.toWire()
+	if err := wire.check(); err != nil {
+		t.Fatal(err)
+	}
+
+	for digest := range wire.toBase().PollPkts {
+		if !status.PollPkts[digest] {
+			t.Errorf("Status changed on the wire")
+		}
+	}
+}
+
+func TestRunningPollNeverBlocks(t *testing.T) {
+	g := DummyGossiper()
+	id := PollKey{g.KeyPair.PublicKey, 1}
+
+	release := make(chan bool)
+	g.RunningPolls.Add(id, func(id PollKey, key ecdsa.PrivateKey, r RunningPollReader) {
+		<-release
+		<-r.Poll
+	})
+
+	// a busy handler, then one which is done, never read the vote keys
+	sendAll := func() bool {
+		sent := make(chan bool)
+		go func() {
+			for i := 0; i < 2*RunningPollBuffer; i++ {
+				g.RunningPolls.Send(PollPacket{ID: id, VoteKey: &VoteKey{}}, nil)
+			}
+			sent <- true
+		}()
+
+		select {
+		case <-sent:
+			return true
+		case <-time.After(time.Second):
+			return false
+		}
+	}
+
+	g.RunningPolls.Send(PollPacket{ID: id, Poll: DummyPoll()}, nil)
+	if !sendAll() {
+		t.Fatalf("Blocked on a busy handler")
+	}
+
+	release <- true
+	writerRemoved := func() bool {
+		g.RunningPolls.RLock()
+		defer g.RunningPolls.RUnlock()
+
+		_, ok := g.RunningPolls.m[id.Pack()]
+		return !ok
+	}
+	if !eventually(writerRemoved) {
+		t.Fatalf("Writer kept once the handler returned")
+	}
+
+	if !sendAll() || g.RunningPolls.SendLocalVote(id, "Yes") {
+		t.Errorf("Sent to a handler which is done")
+	}
+	if !g.RunningPolls.Has(id) {
+		t.Errorf("Poll forgotten, another handler would start")
+	}
+}
+
+// the handler counts the commitments stored while it was busy, even the
+// ones its full buffer dropped
+func TestCommitmentsDroppedWhileBusy(t *testing.T) {
+	g := newGossiper("name", DummyGossiper().KeyPair, make([][2]big.Int, 0), NewServer("127.0.0.1:0"))
+	defer g.Server.Conn.Close()
+	conn := localConn(t)
+	defer conn.Close()
+	g.Peers.Set[conn.LocalAddr().String()] = true
+
+	poll := DummyPoll()
+	id := NewPollKey(g, *poll)
+	g.Polls.Store(PollPacket{ID: id, Poll: poll})
+
+	const numVoters = RunningPollBuffer + 16
+
+	keys := make([]*ecdsa.PrivateKey, numVoters)
+	var voteKeys VoteKeys
+	for i := range keys {
+		var err error
+		keys[i], err = ecdsa.GenerateKey(Curve(), crypto.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		voteKeys.Keys = append(voteKeys.Keys, VoteKey{tmpKey: keys[i].PublicKey})
+	}
+	participants := voteKeys.ToParticipants()
+
+	release := make(chan bool)
+	g.RunningPolls.Add(id, func(id PollKey, key ecdsa.PrivateKey, r RunningPollReader) {
+		<-release
+		commonHandler("Test", g, id, *keys[0], voteKeys, r)
+	})
+
+	// stored then sent to the handler, as the dispatcher does
+	deliver := func(pkg PollPacket) {
+		g.Polls.Store(pkg)
+		g.RunningPolls.Send(pkg, nil)
+	}
+
+	for i := 1; i < numVoters; i++ {
+		commit, _, err := NewCommitment(id, ringTag(participants, keys[i]), poll.Options, poll.Options[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		deliver(PollPacket{ID: id, Commitment: &commit})
+	}
+
+	release <- true
+	if !g.RunningPolls.SendLocalVote(id, poll.Options[0]) {
+		t.Fatal("Local vote not sent")
+	}
+
+	// our own commitment comes back from a peer
+	var own *PollPacket
+	for _, pkg := range readPackets(t, conn) {
+		if pkg.Poll != nil && pkg.Poll.Commitment != nil {
+			own = pkg.Poll
+		}
+	}
+	if own == nil {
+		t.Fatal("Commitment not sent")
+	}
+	deliver(*own)
+
+	voteSent := false
+	for _, pkg := range readPackets(t, conn) {
+		if pkg.Poll != nil && pkg.Poll.Vote != nil {
+			voteSent = true
+		}
+	}
+	if !voteSent {
+		t.Errorf("Vote not sent once all %d commitments arrived", numVoters)
+	}
+}
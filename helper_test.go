@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"log"
 	"math/big"
-	"sync"
 	"testing"
 	"time"
 )
@@ -31,8 +30,8 @@ func TestValidECSignature(t *testing.T) {
 	}
 
 	if !g.SignatureValid(msg) {
-		t.Errorf("Cannot verify generated signature, \ns: %d\nr: %d", sig.Elliptic.S,
-			sig.Elliptic.R)
+		t.Errorf("Cannot verify generated signature, \ns: %d\nr: %d", &sig.Elliptic.S,
+			&sig.Elliptic.R)
 	}
 }
 
@@ -52,6 +51,8 @@ func TestValidLinkableRingSignature(t *testing.T) {
 	numPubKey := 4
 	L := DummyPublicKeyArray(g, pos, numPubKey)
 
+	g.storeParticipants(poll.ID, L, nil)
+
 	sig := linkableRingSignature(input, L, &g.KeyPair, pos)
 	if err != nil {
 		return
@@ -59,7 +60,7 @@ func TestValidLinkableRingSignature(t *testing.T) {
 
 	msg := GossipPacket{
 		Poll:      &poll,
-		Signature: &Signature{&sig, nil},
+		Signature: &Signature{Linkable: &sig},
 		Status:    nil,
 	}
 
@@ -74,26 +75,39 @@ func DummyGossiper() *Gossiper {
 		fmt.Printf("error generating key pair")
 	}
 
-	return &Gossiper{
-		sync.RWMutex{},
-		"name",
-		uint64(0),
-		*key,
-		PeerSet{},
-		RunningPollSet{},
-		PollSet{},
-		Server{},
-		make([][2]big.Int, 0),
-		NewReputationInfo(),
-		Status{},
-	}
+	return newGossiper("name", *key, make([][2]big.Int, 0), Server{})
 }
 
 func DummyPoll() *Poll {
 	return &Poll{
 		Question:  "Do you like dogs?",
 		Options:   []string{"Yes", "No"},
-		StartTime: time.Now(),
+		StartTime: canonicalTime(time.Now()),
 		Duration:  time.Hour,
 	}
 }
+
+func packetDigest(t *testing.T, pkg GossipPacket) PacketDigest {
+	digest, err := pkg.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return digest
+}
+
+func TestCopiedRingSignature(t *testing.T) {
+	g := DummyGossiper()
+	id, participants, voter := evidencePoll(t, g)
+
+	honest, _ := commitmentPacket(t, id, participants, voter, "Yes")
+	other, _ := commitmentPacket(t, id, participants, voter, "No")
+	forged := GossipPacket{Poll: other.Poll, Signature: honest.Signature}
+
+	if !g.SignatureValid(honest) || g.SignatureValid(forged) {
+		t.Errorf("Ring signature accepted on another packet")
+	}
+
+	if packetDigest(t, forged) == packetDigest(t, honest) {
+		t.Errorf("Packet with a copied signature has the same digest")
+	}
+}
@@ -0,0 +1,208 @@
+package pollparty
+
+import (
+	"crypto/elliptic"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	PhaseRegistration = "registration" // the origin collects the vote keys
+	PhaseVoting       = "voting"       // commitments or ballots are sent
+	PhaseRevealing    = "revealing"
+	PhaseClosed       = "closed"
+	PhaseCancelled    = "cancelled"
+	PhaseEquivocated  = "equivocated"
+)
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 1000
+)
+
+func (info ShareablePollInfo) Phase(now time.Time) string {
+	switch {
+	case info.Equivocated():
+		return PhaseEquivocated
+	case info.Cancelled():
+		return PhaseCancelled
+	case now.Before(info.Deadline()):
+		return PhaseRegistration
+	case now.Before(info.commitDeadline()):
+		return PhaseVoting
+	case now.Before(info.commitDeadline().Add(NetworkConvergeDuration)):
+		return PhaseRevealing
+	}
+
+	return PhaseClosed
+}
+
+type PollSummary struct {
+	ID           string
+	Question     string
+	Origin       string // compressed key, in hex
+	Anonymous    bool   // the origin is a key of this poll only
+	Mine         bool   // we are the origin, even anonymously
+	Created      time.Time
+	Phase        string
+	Participants int
+	Voted        bool     // by this node
+	Tags         []string `json:",omitempty"`
+	Creator      string   `json:",omitempty"` // name signed by the origin
+}
+
+type PollFilter struct {
+	Phase  string
+	Origin string // prefix of the origin, or "me"
+	Search string // in the question, ignoring case
+	Tag    string
+	Sort   string // created, question or participants, descending with a leading "-"
+	Limit  int
+	Cursor string // last ID of the previous page
+}
+
+func originString(id PollKey) string {
+	return hex.EncodeToString(elliptic.MarshalCompressed(Curve(), id.Origin.X, id.Origin.Y))
+}
+
+func (f PollFilter) match(s PollSummary) bool {
+	if f.Phase != "" && s.Phase != f.Phase {
+		return false
+	}
+
+	if f.Origin == "me" {
+		if !s.Mine {
+			return false
+		}
+	} else if !strings.HasPrefix(s.Origin, strings.ToLower(f.Origin)) {
+		return false
+	}
+
+	if f.Tag != "" && !containsTag(s.Tags, f.Tag) {
+		return false
+	}
+
+	return strings.Contains(strings.ToLower(s.Question), strings.ToLower(f.Search))
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func pollSummaryLess(key string) (func(a, b PollSummary) bool, error) {
+	descending := strings.HasPrefix(key, "-")
+	key = strings.TrimPrefix(key, "-")
+
+	var less func(a, b PollSummary) bool
+	switch key {
+	case "", "created":
+		less = func(a, b PollSummary) bool { return a.Created.Before(b.Created) }
+	case "question":
+		less = func(a, b PollSummary) bool { return a.Question < b.Question }
+	case "participants":
+		less = func(a, b PollSummary) bool { return a.Participants < b.Participants }
+	default:
+		return nil, errors.New("unknown sort key \"" + key + "\"")
+	}
+
+	// ties are broken by ID, for the cursor to be stable
+	return func(a, b PollSummary) bool {
+		if less(a, b) == less(b, a) {
+			return a.ID < b.ID
+		}
+		return less(a, b) != descending
+	}, nil
+}
+
+// a page of the polls we know the body of, and the cursor of the next one if
+// there are more
+func (g *Gossiper) ListPolls(f PollFilter) ([]PollSummary, string, error) {
+	if f.Sort == "" {
+		f.Sort = "-created"
+	}
+	less, err := pollSummaryLess(f.Sort)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if f.Limit <= 0 {
+		f.Limit = DefaultListLimit
+	} else if f.Limit > MaxListLimit {
+		f.Limit = MaxListLimit
+	}
+
+	now := time.Now()
+	me := originString(PollKey{Origin: g.KeyPair.PublicKey})
+	all := make([]PollSummary, 0)
+	var cursor *PollSummary = nil
+
+	g.Polls.RLock()
+	for k, info := range g.Polls.m {
+		if info.Tags == nil {
+			continue
+		}
+
+		id := k.Unpack()
+		s := PollSummary{
+			ID:           id.String(),
+			Question:     info.Poll.Question,
+			Origin:       originString(id),
+			Anonymous:    info.Poll.Anonymous,
+			Mine:         originString(id) == me || info.OriginKey != nil,
+			Created:      info.Poll.StartTime,
+			Phase:        info.Phase(now),
+			Participants: len(info.Participants),
+			Voted:        info.Voted,
+		}
+		if info.Metadata != nil {
+			s.Tags = info.Metadata.Tags
+			s.Creator = info.Metadata.Creator
+		}
+
+		if s.ID == f.Cursor {
+			cursor = &s
+		}
+
+		if f.match(s) {
+			all = append(all, s)
+		}
+	}
+	g.Polls.RUnlock()
+
+	if f.Cursor != "" && cursor == nil {
+		return nil, "", errors.New("unknown cursor")
+	}
+
+	sort.Slice(all, func(i, j int) bool { return less(all[i], all[j]) })
+
+	// the cursor might not match the filter anymore, its position remains
+	start := 0
+	if cursor != nil {
+		start = sort.Search(len(all), func(i int) bool { return less(*cursor, all[i]) })
+	}
+
+	end := start + f.Limit
+	if end >= len(all) {
+		return all[start:], "", nil
+	}
+
+	return all[start:end], all[end-1].ID, nil
+}
+
+func (g *Gossiper) markVoted(id PollKey) {
+	g.Polls.Lock()
+	defer g.Polls.Unlock()
+
+	info := g.Polls.m[id.Pack()]
+	info.Voted = true
+	g.Polls.m[id.Pack()] = info
+}
@@ -0,0 +1,87 @@
+package pollparty
+
+import (
+	"testing"
+	"time"
+)
+
+func TestListPolls(t *testing.T) {
+	g := DummyGossiper()
+	other := DummyGossiper()
+
+	questions := []string{"Pizza on friday?", "Move the retro?", "More pizza?", "New office?", "Hire an intern?"}
+	var ids []PollKey
+	for i, q := range questions {
+		poll := DummyPoll()
+		poll.Question = q
+		poll.StartTime = time.Now().Add(time.Duration(i) * time.Minute)
+
+		origin := g
+		if i%2 == 1 {
+			origin = other
+		}
+		id := NewPollKey(origin, *poll)
+		g.Polls.Store(PollPacket{ID: id, Poll: poll})
+		ids = append(ids, id)
+	}
+
+	cancel := NewPollControl(ControlCancel, 0)
+	g.Polls.Store(PollPacket{ID: ids[3], Control: &cancel})
+	g.markVoted(ids[0])
+
+	// a poll we only know a vote key of isn't listed
+	g.Polls.Store(PollPacket{ID: PollKey{other.KeyPair.PublicKey, 1}, VoteKey: &VoteKey{}})
+
+	all, next, err := g.ListPolls(PollFilter{})
+	if err != nil || next != "" || len(all) != len(questions) {
+		t.Fatalf("Expected %d polls on a single page, got %d (%v)", len(questions), len(all), err)
+	}
+	if all[0].Question != questions[4] || all[4].Question != questions[0] || !all[4].Voted || all[0].Voted {
+		t.Errorf("Polls not listed from the newest")
+	}
+
+	found, _, _ := g.ListPolls(PollFilter{Search: "PIZZA", Sort: "question"})
+	if len(found) != 2 || found[0].Question != questions[2] || found[1].Question != questions[0] {
+		t.Errorf("Wrong search result: %v", found)
+	}
+
+	mine, _, _ := g.ListPolls(PollFilter{Origin: "me"})
+	if len(mine) != 3 {
+		t.Errorf("Expected 3 polls of ours, got %d", len(mine))
+	}
+	theirs, _, _ := g.ListPolls(PollFilter{Origin: originString(ids[1])[:10]})
+	if len(theirs) != 2 {
+		t.Errorf("Expected 2 polls of the other origin, got %d", len(theirs))
+	}
+
+	cancelled, _, _ := g.ListPolls(PollFilter{Phase: PhaseCancelled})
+	if len(cancelled) != 1 || cancelled[0].ID != ids[3].String() {
+		t.Errorf("Cancelled poll not filtered")
+	}
+
+	var paged []PollSummary
+	filter := PollFilter{Sort: "created", Limit: 2}
+	for pages := 0; ; pages++ {
+		page, next, err := g.ListPolls(filter)
+		if err != nil || pages > len(questions) {
+			t.Fatalf("Pagination doesn't end: %v", err)
+		}
+		paged = append(paged, page...)
+		if next == "" {
+			break
+		}
+		filter.Cursor = next
+	}
+	for i, p := range paged {
+		if p.ID != ids[i].String() {
+			t.Fatalf("Pages don't list the polls in order")
+		}
+	}
+
+	if _, _, err := g.ListPolls(PollFilter{Sort: "origin"}); err == nil {
+		t.Errorf("Accepted an unknown sort key")
+	}
+	if _, _, err := g.ListPolls(PollFilter{Cursor: "nope"}); err == nil {
+		t.Errorf("Accepted an unknown cursor")
+	}
+}
@@ -0,0 +1,103 @@
+package pollparty
+
+import (
+	"crypto/ecdsa"
+	secrand "crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/url"
+)
+
+const (
+	MaxDescriptionSize = 4096 // a poll packet has to fit in a datagram
+	MaxMetadataItems   = 8
+	MaxMetadataItemLen = 256
+)
+
+// optional details of a poll, sent with its body. They are signed apart from
+// the packet, so that older nodes can verify it without knowing them.
+type PollMetadata struct {
+	Description string // in markdown
+	Tags        []string
+	Links       []string
+	Creator     string          // name of the origin in the registry
+	Registry    *WeightRegistry // naming the creator, if the poll has none
+	Signature   EllipticCurveSignatureWire
+}
+
+func (m PollMetadata) hash(id PollKey) []byte {
+	m.Signature = EllipticCurveSignatureWire{}
+
+	input, err := json.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+
+	hash := sha256.Sum256(append(input, id.String()...))
+	return hash[:]
+}
+
+func (m *PollMetadata) sign(id PollKey, key ecdsa.PrivateKey) error {
+	r, s, err := ecdsa.Sign(secrand.Reader, &key, m.hash(id))
+	if err != nil {
+		return err
+	}
+	m.Signature = EllipticCurveSignature{*r, *s}.toWire()
+
+	return nil
+}
+
+func (m PollMetadata) check() error {
+	if len(m.Description) > MaxDescriptionSize {
+		return errors.New("PollMetadata: description too long")
+	}
+
+	if len(m.Tags) > MaxMetadataItems || len(m.Links) > MaxMetadataItems {
+		return errors.New("PollMetadata: too many tags or links")
+	}
+
+	for _, item := range append(append([]string{m.Creator}, m.Tags...), m.Links...) {
+		if len(item) > MaxMetadataItemLen {
+			return errors.New("PollMetadata: tag, link or name too long")
+		}
+	}
+
+	for _, link := range m.Links {
+		u, err := url.Parse(link)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return errors.New("PollMetadata: links have to be http(s) URLs")
+		}
+	}
+
+	return nil
+}
+
+// signed by the origin, with the creator named by the registry of the poll
+// or the one given
+func (m PollMetadata) Valid(id PollKey, poll Poll, validKeys [][2]big.Int) bool {
+	sig := m.Signature.toBase()
+	if !ecdsa.Verify(&id.Origin, m.hash(id), &sig.R, &sig.S) {
+		return false
+	}
+
+	if m.Creator == "" {
+		return true
+	}
+
+	registry := poll.Registry
+	if registry == nil {
+		registry = m.Registry
+	}
+
+	return registry != nil && registry.Valid(validKeys) && registry.NameOf(id.Origin) == m.Creator
+}
+
+func (g *Gossiper) metadataValid(pkg GossipPacket) bool {
+	if pkg.Poll.Poll == nil {
+		return false
+	}
+
+	return pkg.Poll.Metadata.check() == nil && pkg.Poll.Metadata.Valid(pkg.Poll.ID, *pkg.Poll.Poll, g.ValidKeys)
+}
@@ -0,0 +1,122 @@
+package pollparty
+
+import (
+	"math/big"
+	"testing"
+)
+
+func metadataPoll(t *testing.T, g *Gossiper, poll *Poll, metadata PollMetadata) GossipPacket {
+	id := NewPollKey(g, *poll)
+	if err := metadata.sign(id, g.KeyPair); err != nil {
+		t.Fatal(err)
+	}
+
+	pkg := PollPacket{ID: id, Poll: poll, Metadata: &metadata}
+	sig, err := ecSignature(g, pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return GossipPacket{Poll: &pkg, Signature: &sig}
+}
+
+func TestPollMetadataSignature(t *testing.T) {
+	gossipers := DummyValidGossipers(2)
+	creator, receiver := gossipers[0], gossipers[1]
+
+	metadata := PollMetadata{
+		Description: "Where do we go for the **team lunch**?",
+		Tags:        []string{"food", "team"},
+		Links:       []string{"https://example.com/menu"},
+	}
+	msg := wireRoundTrip(t, metadataPoll(t, creator, DummyPoll(), metadata))
+
+	if msg.Poll.Metadata == nil || msg.Poll.Metadata.Description != metadata.Description ||
+		len(msg.Poll.Metadata.Tags) != 2 || msg.Poll.Metadata.Links[0] != metadata.Links[0] {
+		t.Fatalf("Metadata lost on the wire: %v", msg.Poll.Metadata)
+	}
+	if !receiver.SignatureValid(msg) {
+		t.Fatalf("Poll with metadata rejected")
+	}
+
+	// nodes not knowing the metadata still verify the poll
+	received := *msg.Poll.Metadata
+	msg.Poll.Metadata = nil
+	if !receiver.SignatureValid(msg) {
+		t.Errorf("Poll without its metadata rejected")
+	}
+
+	tampered := received
+	tampered.Description = "Nothing to see here"
+	msg.Poll.Metadata = &tampered
+	if receiver.SignatureValid(msg) {
+		t.Errorf("Accepted tampered metadata")
+	}
+
+	other := received
+	if err := other.sign(msg.Poll.ID, receiver.KeyPair); err != nil {
+		t.Fatal(err)
+	}
+	msg.Poll.Metadata = &other
+	if receiver.SignatureValid(msg) {
+		t.Errorf("Accepted metadata not signed by the origin")
+	}
+
+	invalid := PollMetadata{Links: []string{"javascript:alert(1)"}}
+	if invalid.check() == nil {
+		t.Errorf("Accepted a link that isn't http(s)")
+	}
+}
+
+func TestPollMetadataCreator(t *testing.T) {
+	gossipers := DummyValidGossipers(2)
+	creator, receiver := gossipers[0], gossipers[1]
+
+	registry, err := NewWeightRegistry([]IdentityWeight{
+		{Key: PublicKeyWireFromEcdsa(creator.KeyPair.PublicKey), Weight: 1, Name: "Alice"},
+		{Key: PublicKeyWireFromEcdsa(receiver.KeyPair.PublicKey), Weight: 1},
+	}, creator.KeyPair)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	named := metadataPoll(t, creator, DummyPoll(), PollMetadata{Creator: "Alice", Registry: &registry})
+	if !receiver.SignatureValid(wireRoundTrip(t, named)) {
+		t.Errorf("Creator named by the registry rejected")
+	}
+
+	impostor := metadataPoll(t, creator, DummyPoll(), PollMetadata{Creator: "Bob", Registry: &registry})
+	if receiver.SignatureValid(impostor) {
+		t.Errorf("Accepted a creator name not in the registry")
+	}
+
+	unnamed := metadataPoll(t, creator, DummyPoll(), PollMetadata{Creator: "Alice"})
+	if receiver.SignatureValid(unnamed) {
+		t.Errorf("Accepted a creator name without registry")
+	}
+
+	outsider := DummyGossiper()
+	receiver.ValidKeys = [][2]big.Int{{*receiver.KeyPair.X, *receiver.KeyPair.Y}}
+	if receiver.SignatureValid(named) || outsider.SignatureValid(named) {
+		t.Errorf("Accepted a registry not issued by a valid key")
+	}
+}
+
+func TestPollMetadataStore(t *testing.T) {
+	g := DummyGossiper()
+	poll := DummyPoll()
+	id := NewPollKey(g, *poll)
+
+	first := PollMetadata{Description: "first"}
+	second := PollMetadata{Description: "second"}
+
+	if !g.Polls.Store(PollPacket{ID: id, Poll: poll, Metadata: &first}) {
+		t.Fatalf("Poll with metadata not stored")
+	}
+	if g.Polls.Store(PollPacket{ID: id, Poll: poll, Metadata: &second}) {
+		t.Errorf("Metadata replaced")
+	}
+	if g.Polls.Get(id).Metadata.Description != first.Description {
+		t.Errorf("First metadata not kept")
+	}
+}
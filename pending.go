@@ -0,0 +1,211 @@
+package pollparty
+
+import (
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	PendingTimeout    = time.Minute
+	MaxPendingPackets = 1024
+	MaxPendingPerPeer = 64 // so one peer can't fill the buffer with packets of polls never coming
+)
+
+type pendingPacket struct {
+	From     net.UDPAddr
+	Pkg      GossipPacket
+	Received time.Time
+	dispatch Dispatcher
+}
+
+// packets which can't be verified yet, as the poll or the ring they are
+// signed with didn't arrive, they are dispatched again once it does
+type PendingPackets struct {
+	sync.Mutex
+	Timeout time.Duration
+	m       map[PollKeyMap]map[PacketDigest]pendingPacket
+	peers   map[string]int // packets held for each peer
+	count   int
+}
+
+func NewPendingPackets() PendingPackets {
+	return PendingPackets{
+		Timeout: PendingTimeout,
+		m:       make(map[PollKeyMap]map[PacketDigest]pendingPacket),
+		peers:   make(map[string]int),
+	}
+}
+
+func (p *PendingPackets) remove(key PollKeyMap, digest PacketDigest) {
+	pending := p.m[key][digest]
+
+	delete(p.m[key], digest)
+	if len(p.m[key]) == 0 {
+		delete(p.m, key)
+	}
+
+	peer := pending.From.String()
+	p.peers[peer]--
+	if p.peers[peer] <= 0 {
+		delete(p.peers, peer)
+	}
+	p.count--
+}
+
+func (p *PendingPackets) expired(pending pendingPacket, now time.Time) bool {
+	return now.Sub(pending.Received) > p.Timeout
+}
+
+// drops the expired packets, returns how many
+func (p *PendingPackets) prune(now time.Time) int {
+	expired := 0
+	for key, packets := range p.m {
+		for digest, pending := range packets {
+			if p.expired(pending, now) {
+				p.remove(key, digest)
+				expired++
+			}
+		}
+	}
+
+	return expired
+}
+
+// false if the packet was dropped, the buffer or the share of its peer being
+// full, with how many packets expired
+func (p *PendingPackets) Add(from net.UDPAddr, pkg GossipPacket, dispatch Dispatcher, now time.Time) (bool, int) {
+	p.Lock()
+	defer p.Unlock()
+
+	expired := p.prune(now)
+
+	key := pkg.Poll.ID.Pack()
+	digest, err := pkg.Digest()
+	if err != nil {
+		return false, expired
+	}
+	if _, ok := p.m[key][digest]; ok {
+		return true, expired
+	}
+
+	peer := from.String()
+	if p.count >= MaxPendingPackets || p.peers[peer] >= MaxPendingPerPeer {
+		return false, expired
+	}
+
+	if p.m[key] == nil {
+		p.m[key] = make(map[PacketDigest]pendingPacket)
+	}
+	p.m[key][digest] = pendingPacket{From: from, Pkg: pkg, Received: now, dispatch: dispatch}
+	p.peers[peer]++
+	p.count++
+
+	return true, expired
+}
+
+// takes the packets of the poll which are ready, the others stay until they
+// expire
+func (p *PendingPackets) Release(id PollKey, ready func(GossipPacket) bool, now time.Time) ([]pendingPacket, int) {
+	p.Lock()
+	defer p.Unlock()
+
+	expired := p.prune(now)
+
+	var released []pendingPacket
+	key := id.Pack()
+	for digest, pending := range p.m[key] {
+		if ready(pending.Pkg) {
+			released = append(released, pending)
+			p.remove(key, digest)
+		}
+	}
+
+	return released, expired
+}
+
+func (p *PendingPackets) Len() int {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.count
+}
+
+// ring signatures are checked against the participants, trustee ones against
+// the trustees of the body, tally packets against the DKG outcome. Votes,
+// escrow shares and decryptions also need what they open or decrypt, they
+// are only invalid if it's known.
+func (g *Gossiper) dependenciesKnown(pkg GossipPacket) bool {
+	poll := pkg.Poll
+	if poll.Poll != nil || poll.Equivocation != nil {
+		return true
+	}
+
+	info := g.Polls.Get(poll.ID)
+	bodyKnown := info.Tags != nil
+
+	// ballots are encrypted to the DKG key, decryptions checked against its
+	// shares
+	dkgKnown := info.Poll.Tally != TallyHomomorphic || info.DKG != nil
+
+	if poll.isRingSigned() {
+		return bodyKnown && len(info.Participants) > 0 && (poll.Ballot == nil || dkgKnown) &&
+			(poll.Vote == nil || voteCommitmentKnown(info.ShareablePollInfo, pkg))
+	}
+
+	if poll.Decryption != nil {
+		_, ballotsKnown := info.ballotsOf(*poll.Decryption)
+		return bodyKnown && dkgKnown && ballotsKnown
+	}
+
+	if poll.EscrowShare != nil {
+		_, _, committed := info.committed(poll.EscrowShare.Commitment)
+		return bodyKnown && committed
+	}
+
+	if poll.Deal != nil || poll.Complaint != nil {
+		return bodyKnown
+	}
+
+	return true
+}
+
+// with re-voting, the commitment the vote opens might not be the first one
+// of its tag
+func voteCommitmentKnown(info ShareablePollInfo, pkg GossipPacket) bool {
+	if pkg.Signature.Linkable == nil && pkg.Signature.Compact == nil {
+		return true // the signature is invalid anyway
+	}
+
+	if !info.Poll.Revoting {
+		return len(info.Tags[LinkTagMapFrom(pkg.Signature.LinkTag())]) > 0
+	}
+
+	_, opened := openedCommitment(info, pkg)
+	return opened
+}
+
+// holds the packet instead of suspecting its sender for a signature we can't
+// check yet
+func (g *Gossiper) holdPacket(from net.UDPAddr, pkg GossipPacket, dispatch Dispatcher) {
+	held, expired := g.Pending.Add(from, pkg, dispatch, time.Now())
+	atomic.AddUint64(&g.Receiver.Stats.Expired, uint64(expired))
+
+	if !held {
+		log.Println("too many pending packets, drop the one of " + from.String())
+		return
+	}
+	atomic.AddUint64(&g.Receiver.Stats.Held, 1)
+}
+
+// dispatches again the packets of the poll which can now be verified
+func (g *Gossiper) releasePending(id PollKey) {
+	released, expired := g.Pending.Release(id, g.dependenciesKnown, time.Now())
+	atomic.AddUint64(&g.Receiver.Stats.Expired, uint64(expired))
+
+	for _, pending := range released {
+		pending.dispatch(pending.From, pending.Pkg)
+	}
+}
@@ -0,0 +1,196 @@
+package pollparty
+
+import (
+	"crypto/ecdsa"
+	crypto "crypto/rand"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// waits for the released packets, dispatched in the background
+func eventually(condition func() bool) bool {
+	for i := 0; i < 100; i++ {
+		if condition() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return false
+}
+
+func pendingPoll(t *testing.T) (PollKey, GossipPacket, [][2]big.Int, ecdsa.PrivateKey) {
+	origin := DummyGossiper()
+	poll := DummyPoll()
+	id := PollKey{origin.KeyPair.PublicKey, pollID(origin.KeyPair.PublicKey, *poll)}
+
+	body := PollPacket{ID: id, Poll: poll}
+	sig, err := ecSignatureBy(origin.KeyPair, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	voter, err := ecdsa.GenerateKey(Curve(), crypto.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	participants := [][2]big.Int{{*voter.X, *voter.Y}, {*origin.KeyPair.X, *origin.KeyPair.Y}}
+
+	return id, GossipPacket{Poll: &body, Signature: &sig}, participants, *voter
+}
+
+func TestPendingCommitment(t *testing.T) {
+	receiver := DummyGossiper()
+	dispatch := DispatcherPeersterMessage(receiver)
+	from := *parseAddr("127.0.0.1:5001")
+
+	id, body, participants, voter := pendingPoll(t)
+	receiver.RunningPolls.Add(id, drainHandler)
+	commit, _ := commitmentPacket(t, id, participants, voter, "Yes")
+	commit = wireRoundTrip(t, commit)
+
+	// before the poll
+	dispatch(from, commit)
+	if receiver.Pending.Len() != 1 {
+		t.Fatalf("Commitment before the poll not held")
+	}
+
+	// before the ring
+	dispatch(from, wireRoundTrip(t, body))
+	time.Sleep(50 * time.Millisecond)
+	if receiver.Pending.Len() != 1 || receiver.Status.HasPkt(packetDigest(t, commit)) {
+		t.Fatalf("Commitment before the ring not held")
+	}
+
+	receiver.storeParticipants(id, participants, nil)
+	if !eventually(func() bool { return receiver.Status.HasPkt(packetDigest(t, commit)) }) {
+		t.Fatalf("Held commitment not dispatched once the ring arrived")
+	}
+
+	if receiver.Pending.Len() != 0 || receiver.Reputations.Score(from.String(), time.Now()) != 0 {
+		t.Errorf("Sender of a reordered commitment suspected")
+	}
+
+	// the ring is known, a forged commitment is no longer held
+	outsider, err := ecdsa.GenerateKey(Curve(), crypto.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring := [][2]big.Int{{*outsider.X, *outsider.Y}, participants[1]}
+	forged := ringSigned(t, *commit.Poll, ring, *outsider)
+
+	dispatch(from, forged)
+	if receiver.Pending.Len() != 0 || receiver.Reputations.Score(from.String(), time.Now()) >= 0 {
+		t.Errorf("Forged commitment held instead of suspected")
+	}
+}
+
+func TestPendingExpiry(t *testing.T) {
+	receiver := DummyGossiper()
+	receiver.Pending.Timeout = 20 * time.Millisecond
+	dispatch := DispatcherPeersterMessage(receiver)
+	from := *parseAddr("127.0.0.1:5001")
+
+	id, body, participants, voter := pendingPoll(t)
+	receiver.RunningPolls.Add(id, drainHandler)
+	commit, _ := commitmentPacket(t, id, participants, voter, "Yes")
+
+	dispatch(from, commit)
+	time.Sleep(50 * time.Millisecond)
+
+	dispatch(from, body)
+	receiver.storeParticipants(id, participants, nil)
+	time.Sleep(50 * time.Millisecond)
+
+	if receiver.Pending.Len() != 0 || receiver.Status.HasPkt(packetDigest(t, commit)) {
+		t.Errorf("Expired commitment dispatched")
+	}
+	if receiver.Receiver.Snapshot().Expired != 1 {
+		t.Errorf("Expected one expired packet, got %d", receiver.Receiver.Snapshot().Expired)
+	}
+}
+
+func TestPendingPerPeer(t *testing.T) {
+	receiver := DummyGossiper()
+	dispatch := DispatcherPeersterMessage(receiver)
+	from := *parseAddr("127.0.0.1:5001")
+
+	id, _, participants, voter := pendingPoll(t)
+	for i := 0; i < MaxPendingPerPeer+8; i++ {
+		commit, _ := commitmentPacket(t, id, participants, voter, "Yes")
+		dispatch(from, commit)
+	}
+
+	if receiver.Pending.Len() != MaxPendingPerPeer {
+		t.Errorf("Expected %d packets held for the peer, got %d", MaxPendingPerPeer, receiver.Pending.Len())
+	}
+
+	commit, _ := commitmentPacket(t, id, participants, voter, "No")
+	dispatch(*parseAddr("127.0.0.1:5002"), commit)
+	if receiver.Pending.Len() != MaxPendingPerPeer+1 {
+		t.Errorf("Packet of another peer not held")
+	}
+}
+
+func TestPendingVote(t *testing.T) {
+	receiver := DummyGossiper()
+	dispatch := DispatcherPeersterMessage(receiver)
+	from := *parseAddr("127.0.0.1:5001")
+
+	id, body, participants, voter := pendingPoll(t)
+	receiver.RunningPolls.Add(id, drainHandler)
+	dispatch(from, body)
+	receiver.storeParticipants(id, participants, nil)
+
+	commit, salt := commitmentPacket(t, id, participants, voter, "Yes")
+	vote := ringSigned(t, PollPacket{ID: id, Vote: &Vote{Salt: salt, Option: "Yes"}}, participants, voter)
+
+	// before the commitment it opens
+	dispatch(from, wireRoundTrip(t, vote))
+	if receiver.Pending.Len() != 1 || receiver.Reputations.Score(from.String(), time.Now()) != 0 {
+		t.Fatalf("Vote before its commitment not held")
+	}
+
+	dispatch(from, wireRoundTrip(t, commit))
+	if !eventually(func() bool { return receiver.Status.HasPkt(packetDigest(t, vote)) }) {
+		t.Fatalf("Held vote not dispatched once its commitment arrived")
+	}
+	if receiver.Reputations.Score(from.String(), time.Now()) != 0 {
+		t.Errorf("Sender of a reordered vote suspected")
+	}
+
+	// the commitment is known, a lying reveal isn't held
+	lying := ringSigned(t, PollPacket{ID: id, Vote: &Vote{Salt: salt, Option: "No"}}, participants, voter)
+	dispatch(from, lying)
+	if receiver.Pending.Len() != 0 || receiver.Reputations.Score(from.String(), time.Now()) >= 0 {
+		t.Errorf("Lying reveal held instead of suspected")
+	}
+}
+
+func TestPendingDecryption(t *testing.T) {
+	g := DummyGossiper()
+	id, shares, info := dummyTallyPoll(t, 3, 2)
+
+	ballot, err := NewBallot(id, info.DKG.PublicKey(), info.Poll.Options, "Yes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewPartialDecryption(id, 0, shares[0], []Ballot{ballot}, len(info.Poll.Options))
+	pkg := GossipPacket{Poll: &PollPacket{ID: id, Decryption: &d}, Signature: &Signature{}}
+
+	g.Polls.Store(PollPacket{ID: id, Poll: &info.Poll})
+	if g.dependenciesKnown(pkg) {
+		t.Errorf("Decryption checked before the DKG outcome")
+	}
+
+	g.storeDKGOutcome(id, *info.DKG, nil)
+	if g.dependenciesKnown(pkg) {
+		t.Errorf("Decryption checked before its ballots")
+	}
+
+	g.Polls.Store(PollPacket{ID: id, Ballot: &ballot})
+	if !g.dependenciesKnown(pkg) {
+		t.Errorf("Decryption held with its ballots known")
+	}
+}
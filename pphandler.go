@@ -2,40 +2,73 @@ package pollparty
 
 import (
 	"crypto/ecdsa"
+	"crypto/sha256"
 	"log"
 	"math/big"
 	"time"
 )
 
-const NetworkConvergeDuration = time.Duration(3) * time.Second
+const (
+	NetworkConvergeDuration = time.Duration(3) * time.Second
+	TallyTimeout            = 10 * NetworkConvergeDuration // from the keys to the decrypted result
+)
 
 type PoolPacketHandler func(PollKey, ecdsa.PrivateKey, RunningPollReader)
 
 func VoterHandler(g *Gossiper) PoolPacketHandler {
 	return func(id PollKey, key ecdsa.PrivateKey, r RunningPollReader) {
-		_ = <-r.Poll
+		poll := <-r.Poll
 		log.Println("Voter: new poll:", id.String())
 
-		voteKey := VoteKey{
-			tmpKey:    key.PublicKey,
+		if len(poll.Trustees) > 0 {
+			go dkgHandler("Voter", g, id, poll, r)
+		}
+
+		weight, eligible := g.voteWeight(poll)
+		if eligible {
+			voteKey := VoteKey{
+				tmpKey:    key.PublicKey,
+				Proof:     voteKeyProof(id, key),
+				Weight:    weight,
+			}
+			g.SendVoteKey(id, voteKey)
+			log.Println("Voter: send back key")
+		} else {
+			log.Println("Voter: not in the weight registry, only follow the poll")
 		}
-		g.SendVoteKey(id, voteKey)
-		log.Println("Voter: send back key")
 
-		keys := <-r.VoteKeys
+		var keys VoteKeys
+	Keys:
+		for {
+			select {
+			case keys = <-r.VoteKeys:
+				break Keys
+			case <-r.Control:
+				if g.Polls.Get(id).Cancelled() {
+					log.Println("Voter: poll cancelled")
+					return
+				}
+			case <-r.Equivocation:
+				log.Println("Voter: poll origin equivocated")
+				return
+			}
+		}
 		log.Println("Voter: got keys")
 
 		commonHandler("Voter", g, id, key, keys, r)
 	}
 }
 
-func (g *Gossiper) storeParticipants(id PollKey, participants [][2]big.Int) {
+func (g *Gossiper) storeParticipants(id PollKey, participants [][2]big.Int, weights []int) {
 	g.Polls.Lock()
-	defer g.Polls.Unlock()
-
 	pollInfo := g.Polls.m[id.Pack()]
 	pollInfo.Participants = participants
+	pollInfo.Weights = weights
 	g.Polls.m[id.Pack()] = pollInfo
+	g.Polls.Unlock()
+
+	// commitments and votes might have come before the ring
+	go g.releasePending(id)
 }
 
 func containsKey(keyArray [][2]big.Int, tmpKey ecdsa.PublicKey) (int, bool) {
@@ -55,26 +88,57 @@ func MasterHandler(g *Gossiper) PoolPacketHandler {
 
 		g.SendPoll(id, poll)
 
-		keysMap := make(map[VoteKeyMap]bool)
-		mapKey := VoteKey{
-			tmpKey:    key.PublicKey,
-		}.Pack()
-		keysMap[mapKey] = true
+		if len(poll.Trustees) > 0 {
+			go dkgHandler("Master", g, id, poll, r)
+		}
+
+		keysMap := make(map[VoteKeyMap]VoteKey)
+		if weight, eligible := g.voteWeight(poll); eligible {
+			myKey := VoteKey{
+				tmpKey:    key.PublicKey,
+				Proof:     voteKeyProof(id, key),
+				Weight:    weight,
+			}
+			keysMap[myKey.Pack()] = myKey
+
+			// otherwise, the creator would be the valid key without one
+			if poll.Anonymous {
+				g.SendVoteKey(id, myKey)
+			}
+		}
+
+		deadline := time.After(poll.Duration)
 
 	Timeout:
 		for {
 			select {
 			case k := <-r.VoteKey:
-				keysMap[k.Pack()] = true
+				if poll.Tally == TallyHomomorphic && !k.proofValid(id) {
+					log.Println("Master: vote key without valid proof, ignore it")
+					continue
+				}
+				keysMap[k.Pack()] = k
 
-			case <-time.After(poll.Duration):
+			case <-r.Control:
+				info := g.Polls.Get(id)
+				if info.Cancelled() {
+					log.Println("Master: poll cancelled")
+					return
+				}
+				deadline = time.After(time.Until(info.Deadline()))
+
+			case <-r.Equivocation:
+				log.Println("Master: poll origin equivocated")
+				return
+
+			case <-deadline:
 				break Timeout
 			}
 		}
 
 		var keys []VoteKey
-		for k := range keysMap {
-			keys = append(keys, k.Unpack())
+		for _, k := range keysMap {
+			keys = append(keys, k)
 		}
 
 		voteKeys := VoteKeys{
@@ -89,7 +153,19 @@ func MasterHandler(g *Gossiper) PoolPacketHandler {
 
 func commonHandler(logName string, g *Gossiper, id PollKey, key ecdsa.PrivateKey, keys VoteKeys, r RunningPollReader) {
 	participants := keys.ToParticipants()
-	g.storeParticipants(id, participants)
+	g.storeParticipants(id, participants, keys.Weights())
+
+	poll := g.Polls.Get(id).Poll
+	if _, trustee := poll.trusteeIndex(g.KeyPair.PublicKey); trustee && poll.Tally != TallyHomomorphic {
+		go escrowHandler(logName, g, id, poll)
+	}
+
+	// trustees decrypt the tally even if they don't vote
+	if poll.Tally == TallyHomomorphic {
+		tallyHandler(logName, g, id, key, keys, r)
+		UpdateReputations(g, id)
+		return
+	}
 
 	position, ok := containsKey(participants, key.PublicKey)
 	if !ok {
@@ -97,56 +173,93 @@ func commonHandler(logName string, g *Gossiper, id PollKey, key ecdsa.PrivateKey
 		return
 	}
 
-	commits := make([]Commitment, 0)
-	votes := make([]Vote, 0)
+	// in a weighted poll, we sign in the ring of our weight class
+	ring, weight := keys.ring(poll, key.PublicKey)
+	position, _ = containsKey(ring, key.PublicKey)
 
-	salt := make(chan [SaltSize]byte)
+	salt := make(chan *big.Int)
 	option := make(chan string)
 
-	g.Reputations.AddTablesWait[id] = make(chan bool)
-
+	// if the poll allows it, a new local vote supersedes the previous one
+	// until the commit deadline, the last one is revealed
 	go func() {
 		o := <-r.LocalVote
 		log.Printf("%s: got local vote for \"%s\"", logName, o)
 
-		commit, s := NewCommitment(o)
-		g.SendCommitment(id, commit, participants, key, position)
+		tag := ringTag(ring, &key)
+		s, err := g.commitLocalVote(id, poll, tag, o, 0, weight, ring, key, position)
+		if err != nil {
+			log.Printf("%s: %s", logName, err)
+			return
+		}
 		log.Printf("%s: send commit for \"%s\"", logName, o)
 
-		salt <- s
-		option <- o
+		var revote <-chan string = nil
+		if poll.Revoting {
+			revote = r.LocalVote
+		}
+		deadline := time.After(time.Until(g.Polls.Get(id).commitDeadline()))
+
+		for sequence := uint64(1); ; {
+			select {
+			case newOption := <-revote:
+				newSalt, err := g.commitLocalVote(id, poll, tag, newOption, sequence, weight, ring, key, position)
+				if err != nil {
+					log.Printf("%s: %s", logName, err)
+					continue
+				}
+				log.Printf("%s: send commit %d for \"%s\"", logName, sequence, newOption)
+				s, o = newSalt, newOption
+				sequence++
+
+			case <-deadline:
+				revote = nil
 
-		close(salt)
-		close(option)
+			case salt <- s:
+				option <- o
+
+				close(salt)
+				close(option)
+				return
+			}
+		}
 	}()
 
 	voteSent := false
 	timedout := false
+
+	// the packets are counted in the poll, the channels only wake us up so
+	// a packet dropped while we were busy still counts. With re-voting, the
+	// voters are counted instead of their commitments.
+	commits := 0
+	committers := func() int {
+		info := g.Polls.Get(id)
+		if poll.Revoting {
+			return len(info.Tags)
+		}
+		if !timedout {
+			commits = len(info.Commitments)
+		} // do not accept commits after timeout, to prevent influencing
+		return commits
+	}
+
 	timeout := time.After(NetworkConvergeDuration)
+	revealDeadline := time.After(2 * NetworkConvergeDuration)
+	revealed := false
+	var escrowDeadline <-chan time.Time = nil
+
+Closed:
 	for {
 		select {
-		case commit := <-r.Commitment:
-			if !timedout {
-				commits = append(commits, commit)
-			} // do not accept commits after timeout, to prevent influencing
-			if len(commits) == len(keys.Keys) {
-				g.SendVote(id, Vote{
-					Salt:   <-salt,
-					Option: <-option,
-				}, participants, key, position)
-				log.Printf("%s: send vote", logName)
-				voteSent = true
-			}
+		case <-r.Commitment:
 		case vote := <-r.Vote:
-			if len(commits) < len(keys.Keys) || timedout {
-				myStatus := getStatus(g).toBase()
-				writeMsgToUDP(g.Server, vote.Sender, nil, &myStatus, nil, nil)
+			if committers() < len(keys.Keys) || timedout {
+				g.sendStatus(vote.Sender)
 				time.Sleep(time.Duration(250) * time.Millisecond)
-				if len(commits) < len(keys.Keys) {
-					g.Reputations.Suspect(vote.Sender.String())
+				if committers() < len(keys.Keys) {
+					g.Reputations.Offend(vote.Sender.String(), OffenceEarlyVote, &id)
 				}
 			}
-			votes = append(votes, vote.Vote)
 		case <-timeout:
 			log.Printf("%s: timeout", logName)
 			timedout = true
@@ -154,12 +267,54 @@ func commonHandler(logName string, g *Gossiper, id PollKey, key ecdsa.PrivateKey
 				g.SendVote(id, Vote{
 					Salt:   <-salt,
 					Option: <-option,
-				}, participants, key, position)
+					Weight: weight,
+				}, ring, key, position)
 				log.Printf("%s: send vote at timeout", logName)
+				voteSent = true
+			}
+		case <-r.EscrowShare:
+		case <-r.Control:
+			info := g.Polls.Get(id)
+			if info.Cancelled() {
+				log.Printf("%s: poll cancelled", logName)
+				return
 			}
+			if !timedout {
+				timeout = time.After(time.Until(info.commitDeadline()))
+			}
+			if !revealed {
+				revealDeadline = time.After(time.Until(info.commitDeadline().Add(NetworkConvergeDuration)))
+			}
+		case <-r.Equivocation:
+			log.Printf("%s: poll origin equivocated", logName)
+			return
+		case <-revealDeadline:
+			revealed = true
+			if len(poll.Trustees) > 0 {
+				escrowDeadline = time.After(2 * NetworkConvergeDuration)
+			}
+		case <-escrowDeadline:
+			log.Printf("%s: %d commitments were never opened", logName, len(g.Polls.Get(id).unrevealed()))
+			break Closed
+		}
+
+		if !poll.Revoting && !voteSent && committers() == len(keys.Keys) {
+			g.SendVote(id, Vote{
+				Salt:   <-salt,
+				Option: <-option,
+				Weight: weight,
+			}, ring, key, position)
+			log.Printf("%s: send vote", logName)
+			voteSent = true
 		}
 
-		if len(votes) == len(keys.Keys) && len(commits) == len(keys.Keys) {
+		info := g.Polls.Get(id)
+		if len(info.Votes) == len(keys.Keys) && committers() == len(keys.Keys) {
+			break
+		}
+
+		// the trustees open the commitments of the voters who left
+		if revealed && len(poll.Trustees) > 0 && len(info.Votes)+len(info.EscrowOpened) >= committers() {
 			break
 		}
 	}
@@ -168,3 +323,254 @@ func commonHandler(logName string, g *Gossiper, id PollKey, key ecdsa.PrivateKey
 
 	UpdateReputations(g, id)
 }
+
+// commits to the option, escrowing its opening if the poll has trustees, and
+// returns the salt to reveal it
+func (g *Gossiper) commitLocalVote(id PollKey, poll Poll, tag [2]*big.Int, option string, sequence uint64, weight int,
+	ring [][2]big.Int, key ecdsa.PrivateKey, position int) (*big.Int, error) {
+	commit, s, err := NewCommitment(id, tag, poll.Options, option)
+	if err != nil {
+		return nil, err
+	}
+	commit.Sequence = sequence
+	commit.Weight = weight
+
+	if len(poll.Trustees) > 0 {
+		escrow, err := NewSaltEscrow(id, poll, tag, option, s)
+		if err != nil {
+			return nil, err
+		}
+		commit.Escrow = &escrow
+	}
+	g.storeRevealed(id, commit.Digest()) // we reveal it ourselves
+
+	g.SendCommitment(id, commit, ring, key, position)
+	g.markVoted(id)
+	return s, nil
+}
+
+// after the reveal deadline, a trustee sends its share of the opening of
+// every commitment which wasn't revealed
+func escrowHandler(logName string, g *Gossiper, id PollKey, poll Poll) {
+	time.Sleep(2 * NetworkConvergeDuration)
+
+	// the origin might have extended the poll meanwhile
+	for {
+		wait := time.Until(g.Polls.Get(id).commitDeadline().Add(NetworkConvergeDuration))
+		if wait <= 0 {
+			break
+		}
+		time.Sleep(wait)
+	}
+
+	info := g.Polls.Get(id)
+	if info.Cancelled() || info.Equivocated() {
+		return
+	}
+	for _, digest := range info.unrevealed() {
+		commit, tag, _ := info.committed(digest)
+
+		share, ok := NewEscrowShare(id, poll, tag, commit, g.KeyPair)
+		if !ok {
+			log.Printf("%s: invalid escrow share for an unrevealed commitment", logName)
+			continue
+		}
+
+		g.SendEscrowShare(id, share)
+		log.Printf("%s: send escrow share of trustee %d", logName, share.Trustee)
+	}
+}
+
+func (g *Gossiper) storeRevealed(id PollKey, digest [sha256.Size]byte) {
+	g.Polls.Lock()
+	defer g.Polls.Unlock()
+
+	g.markRevealed(id, digest)
+}
+
+// encrypted ballots are summed then decrypted by a quorum of trustees, so
+// that no single vote is ever revealed. Trustees might withhold their
+// decryption, we give up on the result at the deadline.
+func tallyHandler(logName string, g *Gossiper, id PollKey, key ecdsa.PrivateKey, keys VoteKeys, r RunningPollReader) {
+	participants := keys.ToParticipants()
+	position, voter := containsKey(participants, key.PublicKey)
+	poll := g.Polls.Get(id).Poll
+	trustee, _ := poll.trusteeIndex(g.KeyPair.PublicKey)
+
+	deadline := time.After(TallyTimeout)
+
+	outcome, ok := waitDKG(g, id, 2*NetworkConvergeDuration)
+	if !ok {
+		log.Printf("%s: no DKG outcome, abort", logName)
+		return
+	}
+
+	if voter {
+		go func() {
+			o := <-r.LocalVote
+			log.Printf("%s: got local vote for \"%s\"", logName, o)
+
+			ballot, err := NewBallot(id, outcome.PublicKey(), poll.Options, o)
+			if err != nil {
+				log.Printf("%s: %s", logName, err)
+				return
+			}
+
+			g.SendBallot(id, ballot, participants, key, position)
+			g.markVoted(id)
+			log.Printf("%s: send encrypted ballot", logName)
+		}()
+	}
+
+	// only the trustees with a share decrypt, once
+	share := g.Polls.Get(id).DKGShare
+	decryptionSent := share == nil
+	timeout := time.After(NetworkConvergeDuration)
+
+	sendDecryption := func() {
+		info := g.Polls.Get(id)
+		if len(info.Ballots) == 0 {
+			return
+		}
+
+		d := NewPartialDecryption(id, trustee, share, info.Ballots, len(poll.Options))
+		g.SendDecryption(id, d)
+		log.Printf("%s: send partial decryption of %d ballots", logName, len(info.Ballots))
+		decryptionSent = true
+	}
+
+	for {
+		select {
+		case <-r.Ballot:
+		case <-r.Decryption:
+		case <-r.Control:
+			if g.Polls.Get(id).Cancelled() {
+				log.Printf("%s: poll cancelled", logName)
+				return
+			}
+		case <-r.Equivocation:
+			log.Printf("%s: poll origin equivocated", logName)
+			return
+		case <-timeout:
+			log.Printf("%s: timeout", logName)
+			timeout = nil
+			if !decryptionSent {
+				sendDecryption() // ballots arriving later are ignored, to prevent influencing
+			}
+			if !decryptionSent {
+				timeout = time.After(NetworkConvergeDuration)
+			}
+		case <-deadline:
+			log.Printf("%s: not enough trustees decrypted the tally, give up", logName)
+			return
+		}
+
+		if !decryptionSent && len(g.Polls.Get(id).Ballots) == len(keys.Keys) {
+			sendDecryption()
+		}
+
+		if _, done := g.Polls.Get(id).homomorphicResults(); done {
+			break
+		}
+	}
+
+	log.Printf("%s: pool's closed", logName)
+}
+
+// the DKG outcome is stored at the end of the key collection, about when
+// the keys arrive
+func waitDKG(g *Gossiper, id PollKey, timeout time.Duration) (DKGOutcome, bool) {
+	end := time.Now().Add(timeout)
+
+	for {
+		if outcome := g.Polls.Get(id).DKG; outcome != nil {
+			return *outcome, true
+		}
+
+		if time.Now().After(end) {
+			return DKGOutcome{}, false
+		}
+		time.Sleep(NetworkConvergeDuration / 30)
+	}
+}
+
+// every node follows the key generation of the trustees to record its
+// outcome, the trustees also deal and check their shares. Complaints are
+// accepted until the end of the key collection, the gossip should have
+// converged by then.
+func dkgHandler(logName string, g *Gossiper, id PollKey, poll Poll, r RunningPollReader) {
+	_, trustee := poll.trusteeIndex(g.KeyPair.PublicKey)
+
+	if trustee {
+		deal, err := NewDKGDeal(id, poll, g.KeyPair)
+		if err == nil {
+			g.SendDKGDeal(id, deal)
+			log.Printf("%s: send DKG deal", logName)
+		} else {
+			log.Printf("%s: %s", logName, err)
+		}
+	}
+
+	// controls go to the main handler, so follow the deadline they set
+	end := time.After(time.Until(g.Polls.Get(id).Deadline()))
+
+Timeout:
+	for {
+		select {
+		case deal := <-r.Deal:
+			if !trustee {
+				continue
+			}
+
+			if _, ok := deal.Share(id, poll, g.KeyPair); !ok {
+				g.SendDKGComplaint(id, NewDKGComplaint(id, poll, g.KeyPair, deal))
+				log.Printf("%s: complain about DKG deal of trustee %d", logName, deal.Dealer)
+			}
+
+		case <-r.Complaint:
+
+		case <-end:
+			info := g.Polls.Get(id)
+			if info.Cancelled() {
+				log.Printf("%s: poll cancelled, stop the DKG", logName)
+				return
+			}
+			if time.Now().Before(info.Deadline()) {
+				end = time.After(time.Until(info.Deadline()))
+				continue
+			}
+			break Timeout
+		}
+	}
+
+	info := g.Polls.Get(id)
+	outcome, ok := computeDKGOutcome(id, poll, info.Deals, info.Complaints)
+	if !ok {
+		log.Printf("%s: DKG failed, only %d qualified trustees", logName, len(outcome.Qualified))
+		return
+	}
+
+	var share *big.Int = nil
+	if trustee {
+		share, ok = outcome.SecretShare(id, poll, info.Deals, g.KeyPair)
+		if !ok {
+			log.Printf("%s: unable to compute our DKG share", logName)
+		}
+	}
+
+	g.storeDKGOutcome(id, outcome, share)
+	log.Printf("%s: DKG done with %d qualified trustees", logName, len(outcome.Qualified))
+}
+
+func (g *Gossiper) storeDKGOutcome(id PollKey, outcome DKGOutcome, share *big.Int) {
+	g.Polls.Lock()
+	defer g.Polls.Unlock()
+
+	pollInfo := g.Polls.m[id.Pack()]
+	pollInfo.DKG = &outcome
+	pollInfo.DKGShare = share
+	g.Polls.m[id.Pack()] = pollInfo
+
+	// ballots and decryptions might have come before
+	go g.releasePending(id)
+}
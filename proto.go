@@ -2,10 +2,13 @@ package pollparty
 
 import (
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"math/big"
-	"math/rand"
 	"strconv"
 	"strings"
 	"time"
@@ -18,39 +21,73 @@ type PollKey struct {
 
 const PollKeySep = "_"
 
-func (msg PollKey) String() string {
-	return msg.Origin.X.String() + PollKeySep + msg.Origin.Y.String() + PollKeySep + strconv.FormatUint(msg.ID, 10)
-}
+// lowercase base32 of the ID followed by the compressed origin, the ID comes
+// first so that a short prefix is enough to tell polls apart
+var pollKeyEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
 
-func PollKeyFromString(packed string) (PollKey, error) {
-	var ret PollKey
-	errRet := func(v string) (PollKey, error) {
-		return ret, errors.New("unable to parse \"" + v + "\" as int")
+const pollKeyIDSize = 8
+
+// the ID is derived from the origin and the poll body, which includes its
+// start time, so that a restarted node doesn't reissue an earlier key
+func pollID(origin ecdsa.PublicKey, poll Poll) uint64 {
+	// the same on every node, whatever its time zone
+	body, err := json.Marshal(poll.canonical())
+	if err != nil {
+		panic(err)
 	}
 
-	splitted := strings.SplitN(packed, PollKeySep, 3)
+	hash := sha256.New()
+	hash.Write(elliptic.MarshalCompressed(Curve(), origin.X, origin.Y))
+	hash.Write(body)
+	return binary.BigEndian.Uint64(hash.Sum(nil)[:pollKeyIDSize])
+}
 
-	x, ok := new(big.Int).SetString(splitted[0], 10)
-	if !ok {
-		return errRet(splitted[0])
+func (msg PollKey) String() string {
+	packed := make([]byte, pollKeyIDSize)
+	binary.BigEndian.PutUint64(packed, msg.ID)
+	packed = append(packed, elliptic.MarshalCompressed(Curve(), msg.Origin.X, msg.Origin.Y)...)
+
+	return strings.ToLower(pollKeyEncoding.EncodeToString(packed))
+}
+
+func PollKeyFromString(packed string) (PollKey, error) {
+	raw, err := pollKeyEncoding.DecodeString(strings.ToUpper(packed))
+	if err != nil {
+		return PollKey{}, err
 	}
 
-	y, ok := new(big.Int).SetString(splitted[1], 10)
-	if !ok {
-		return errRet(splitted[1])
+	if len(raw) <= pollKeyIDSize {
+		return PollKey{}, errors.New("poll key \"" + packed + "\" too short")
 	}
 
-	id, err := strconv.ParseUint(splitted[2], 10, 64)
-	if err != nil {
-		return ret, err
+	x, y := elliptic.UnmarshalCompressed(Curve(), raw[pollKeyIDSize:])
+	if x == nil {
+		return PollKey{}, errors.New("invalid origin in poll key \"" + packed + "\"")
 	}
 
-	ret = PollKey{
+	return PollKey{
 		Origin: ecdsa.PublicKey{Curve: Curve(), X: x, Y: y},
-		ID:     id,
+		ID:     binary.BigEndian.Uint64(raw[:pollKeyIDSize]),
+	}, nil
+}
+
+// ring signature used by the voters to anonymously sign their packets
+type RingScheme uint32
+
+const (
+	LinkableRing RingScheme = iota // size linear in the ring
+	CompactRing                    // size logarithmic in the ring
+)
+
+func RingSchemeFromString(name string) (RingScheme, error) {
+	switch name {
+	case "", "linkable":
+		return LinkableRing, nil
+	case "compact":
+		return CompactRing, nil
 	}
 
-	return ret, nil
+	return LinkableRing, errors.New("unknown ring scheme \"" + name + "\"")
 }
 
 type Poll struct {
@@ -58,35 +95,108 @@ type Poll struct {
 	Options   []string
 	StartTime time.Time
 	Duration  time.Duration // After duration has passed, can no longer participate in votes
+	Scheme    RingScheme
+	Tally     TallyMode
+	Trustees  []PublicKeyWire // chosen from the valid keys, run a DKG if any
+	Threshold int             // trustees needed to use the DKG key
+	Revoting  bool            // a later commitment of a voter supersedes its earlier ones
+
+	MinParticipants int          // quorum, in accepted vote keys
+	MinTurnout      int          // percent of the participants who have to send a ballot
+	Rule            DecisionRule // how the winner is chosen
+
+	Registry *WeightRegistry // weights of the voters, if the poll is weighted
+
+	Anonymous bool // the origin is a fresh key, the creator only shows it is a valid key
 }
 
 func (p Poll) IsTooLate() bool {
 	return p.StartTime.Add(p.Duration).Before(time.Now())
 }
 
-const SaltSize = 20
-
+// the option index is committed to, as m*U + r*G with r drawn from
+// crypto/rand, so that the commitment hides the option and can prove that it
+// is one of them. U depends on the version, the poll and the ring tag of the
+// voter, a commitment can't be replayed by someone else or in another poll.
 type Commitment struct {
-	Hash [sha256.Size]byte
+	Version  uint32
+	Sequence uint64 // increased on each new commitment of the voter, if re-voting
+	Point    [2]*big.Int
+	Proof    OptionProof
+	Escrow   *SaltEscrow // needed if the poll has trustees
+	Weight   int         // class of the ring signing it, if the poll is weighted
+}
+
+// 0 was sha256(option|salt) with a math/rand salt, easy to brute-force
+const CommitmentVersion = 1
+
+const commitmentBase = "PeersterPoll vote commitment"
+
+func commitmentU(version uint32, id PollKey, tag [2]*big.Int) [2]*big.Int {
+	input := []byte(commitmentBase + PollKeySep + strconv.FormatUint(uint64(version), 10) +
+		PollKeySep + id.String() + PollKeySep)
+	input = append(input, elliptic.MarshalCompressed(Curve(), tag[0], tag[1])...)
+
+	x, y := mapToPoint(input)
+	return [2]*big.Int{x, y}
 }
 
-func NewCommitment(answer string) (Commitment, [SaltSize]byte) {
-	var salt [SaltSize]byte
-	rand.Read(salt[:])
+func optionIndex(options []string, answer string) (int, bool) {
+	for i, o := range options {
+		if o == answer {
+			return i, true
+		}
+	}
 
-	toHash := make([]byte, 0)
-	toHash = append(toHash, []byte(answer)[:]...)
-	toHash = append(toHash, salt[:]...)
+	return -1, false
+}
 
-	hash := sha256.Sum256(toHash)
+func commitOption(U [2]*big.Int, index int, salt *big.Int) [2]*big.Int {
+	return pointAdd(pointMul(U, big.NewInt(int64(index))), pointBaseMul(salt))
+}
+
+// tag is the one of the ring signature which will be used to send it
+func NewCommitment(id PollKey, tag [2]*big.Int, options []string, answer string) (Commitment, *big.Int, error) {
+	index, ok := optionIndex(options, answer)
+	if !ok {
+		return Commitment{}, nil, errors.New("\"" + answer + "\" isn't an option")
+	}
+
+	U := commitmentU(CommitmentVersion, id, tag)
+	salt, err := randomScalar()
+	if err != nil {
+		return Commitment{}, nil, err
+	}
+	point := commitOption(U, index, salt)
 
 	return Commitment{
-		Hash: hash,
-	}, salt
+		Version: CommitmentVersion,
+		Point:   point,
+		Proof:   proveOption(U, point, len(options), index, salt, tallyContext(id, "commitment")),
+	}, salt, nil
+}
+
+// checks that the commitment is to one of the options
+func (c Commitment) Valid(id PollKey, tag [2]*big.Int, numOptions int) bool {
+	if c.Version != CommitmentVersion || c.Point[0] == nil || c.Point[1] == nil ||
+		!Curve().IsOnCurve(c.Point[0], c.Point[1]) {
+		return false
+	}
+
+	return c.Proof.verify(commitmentU(c.Version, id, tag), c.Point, numOptions, tallyContext(id, "commitment"))
+}
+
+func (c Commitment) Digest() [sha256.Size]byte {
+	var version [4]byte
+	binary.BigEndian.PutUint32(version[:], c.Version)
+
+	return sha256.Sum256(append(version[:], elliptic.MarshalCompressed(Curve(), c.Point[0], c.Point[1])...))
 }
 
 type VoteKey struct {
 	tmpKey    ecdsa.PublicKey
+	Proof     *DLProof // knowledge of the secret, needed for homomorphic tally
+	Weight    int      // of the voter in the registry, if the poll is weighted
 }
 
 type VoteKeys struct {
@@ -105,22 +215,63 @@ func (msg VoteKeys) ToParticipants() [][2]big.Int {
 }
 
 type Vote struct {
-	Salt   [SaltSize]byte
+	Salt   *big.Int // randomness of the commitment
 	Option string
+	Weight int // same as the commitment
+}
+
+// the commitment opened by the vote, if it is an option
+func (v Vote) Commitment(id PollKey, tag [2]*big.Int, options []string) (Commitment, bool) {
+	index, ok := optionIndex(options, v.Option)
+	if !ok || v.Salt == nil {
+		return Commitment{}, false
+	}
+
+	return Commitment{
+		Version: CommitmentVersion,
+		Point:   commitOption(commitmentU(CommitmentVersion, id, tag), index, v.Salt),
+	}, true
 }
 
 type PollPacket struct {
-	ID         PollKey
-	Poll       *Poll
-	VoteKey    *VoteKey
-	VoteKeys   *VoteKeys
-	Commitment *Commitment
-	Vote       *Vote
+	ID           PollKey
+	Poll         *Poll
+	VoteKey      *VoteKey
+	VoteKeys     *VoteKeys
+	Commitment   *Commitment
+	Vote         *Vote
+	Ballot       *Ballot
+	Decryption   *PartialDecryption
+	Deal         *DKGDeal
+	Complaint    *DKGComplaint
+	EscrowShare  *EscrowShare
+	Control      *PollControl
+	Equivocation *PollEquivocation
+	Metadata     *PollMetadata `json:"-"` // with the poll body, signed on its own
+}
+
+// packets sent anonymously by the voters
+func (pkg PollPacket) isRingSigned() bool {
+	return pkg.Commitment != nil || pkg.Vote != nil || pkg.Ballot != nil
 }
 
+// identifies a signed packet in the status, see GossipPacket.Digest
+type PacketDigest [sha256.Size]byte
+
+// signed by the key of the sender, with the cookie the receiver gave it to
+// show it can be reached at its address
 type StatusPacket struct {
-	PollPkts       map[Signature]bool
-	ReputationPkts map[Signature]bool
+	PollPkts       map[PacketDigest]bool
+	ReputationPkts map[PacketDigest]bool
+	Signer         ecdsa.PublicKey
+	Cookie         []byte
+	Nonce          []byte // echoed by the cookie sent back, if any
+}
+
+// sent back to a status without a valid cookie, see Cookies
+type CookiePacket struct {
+	Cookie []byte
+	Nonce  []byte // of the status it answers
 }
 
 type GossipPacket struct {
@@ -128,6 +279,8 @@ type GossipPacket struct {
 	Signature  *Signature
 	Status     *StatusPacket
 	Reputation *ReputationPacket
+	Evidence   *EvidencePacket
+	Cookie     *CookiePacket
 }
 
 type EllipticCurveSignature struct {
@@ -138,4 +291,146 @@ type EllipticCurveSignature struct {
 type Signature struct {
 	Linkable *LinkableRingSignature
 	Elliptic *EllipticCurveSignature
+	Compact  *CompactRingSignature
+}
+
+func ringSignature(scheme RingScheme, msg []byte, L [][2]big.Int, tmpKey *ecdsa.PrivateKey, pos int) Signature {
+	if scheme == CompactRing {
+		crs := compactRingSignature(msg, L, tmpKey, pos)
+		return Signature{Compact: &crs}
+	}
+
+	lrs := linkableRingSignature(msg, L, tmpKey, pos)
+	return Signature{Linkable: &lrs}
+}
+
+// IsRing reports if the signature is one of the anonymous ring schemes
+func (s Signature) IsRing() bool {
+	return s.Linkable != nil || s.Compact != nil
+}
+
+// tag the ring signatures of tmpKey over L will have, whatever the scheme
+func ringTag(L [][2]big.Int, tmpKey *ecdsa.PrivateKey) [2]*big.Int {
+	var pubKeys []byte
+	for _, keyPair := range L {
+		pubKeys = append(pubKeys, keyPair[0].Bytes()...)
+		pubKeys = append(pubKeys, keyPair[1].Bytes()...)
+	}
+
+	Hx, Hy := mapToPoint(pubKeys)
+	return pointMul([2]*big.Int{Hx, Hy}, tmpKey.D)
+}
+
+func (s Signature) LinkTag() [2]*big.Int {
+	if s.Compact != nil {
+		return s.Compact.Tag
+	}
+
+	return s.Linkable.Tag
+}
+
+// Digest identifies the signature, with a canonical encoding contrary to the
+// wire one
+func (s Signature) Digest() PacketDigest {
+	hash := sha256.New()
+	write := func(elems ...[]byte) {
+		for _, e := range elems {
+			var size [4]byte
+			binary.BigEndian.PutUint32(size[:], uint32(len(e)))
+			hash.Write(size[:])
+			hash.Write(e)
+		}
+	}
+
+	wire := s.toWire()
+
+	if wire.Linkable != nil {
+		write([]byte("linkable"), wire.Linkable.Message, wire.Linkable.C0)
+		write(wire.Linkable.S...)
+		write(wire.Linkable.Tag...)
+	}
+
+	if wire.Elliptic != nil {
+		write([]byte("elliptic"), wire.Elliptic.R, wire.Elliptic.S)
+	}
+
+	if wire.Compact != nil {
+		c := wire.Compact
+		write([]byte("compact"), c.Message, c.ZD, c.Tag)
+		for _, elems := range [][][]byte{c.CL, c.CA, c.CB, c.CD, c.Q, c.F, c.ZA, c.ZB} {
+			write(elems...)
+		}
+	}
+
+	var ret PacketDigest
+	copy(ret[:], hash.Sum(nil))
+	return ret
+}
+
+// times decoded from the wire are in the zone of the node, the canonical
+// one is UTC
+func canonicalTime(t time.Time) time.Time {
+	return time.Unix(0, t.UnixNano()).UTC()
+}
+
+func (p Poll) canonical() Poll {
+	p.StartTime = canonicalTime(p.StartTime)
+	return p
+}
+
+// the same packet whatever node decoded it
+func (pkg PollPacket) canonical() PollPacket {
+	if pkg.Poll != nil {
+		poll := pkg.Poll.canonical()
+		pkg.Poll = &poll
+	}
+
+	if pkg.Control != nil {
+		control := *pkg.Control
+		control.Issued = canonicalTime(control.Issued)
+		pkg.Control = &control
+	}
+
+	if pkg.Equivocation != nil {
+		evidence := *pkg.Equivocation
+		for i := range evidence.Bodies {
+			evidence.Bodies[i] = evidence.Bodies[i].canonical()
+		}
+		pkg.Equivocation = &evidence
+	}
+
+	return pkg
+}
+
+// Digest identifies a signed packet, by its signature and what it carries: a
+// ring signature embeds its message, so it can be copied onto another packet.
+// The content is hashed in its canonical form, fields in a fixed order and
+// times in UTC, so that every node gets the same digest.
+func (pkg GossipPacket) Digest() (PacketDigest, error) {
+	var content interface{}
+	if pkg.Poll != nil {
+		content = pkg.Poll.canonical()
+	} else if pkg.Reputation != nil {
+		content = pkg.Reputation
+	}
+
+	input, err := json.Marshal(content)
+	if err != nil {
+		return PacketDigest{}, err
+	}
+
+	sig := pkg.Signature.Digest()
+	return PacketDigest(sha256.Sum256(append(sig[:], input...))), nil
+}
+
+// verifies a ring signature, only accepting the scheme of the poll
+func verifyRingSignature(s Signature, scheme RingScheme, L [][2]big.Int) bool {
+	switch scheme {
+	case LinkableRing:
+		return s.Linkable != nil && s.Compact == nil && len(s.Linkable.S) == len(L) && verifySig(*s.Linkable, L)
+	case CompactRing:
+		return s.Compact != nil && s.Linkable == nil && verifyCompactSig(*s.Compact, L)
+	}
+
+	return false
 }
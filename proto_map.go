@@ -88,145 +88,16 @@ func (vk VoteKeyMap) Unpack() VoteKey {
 	}
 }
 
-type StatusPacketMap struct {
-	PollPkts       map[SignatureMap]bool
-	ReputationPkts map[SignatureMap]bool
-}
-
-func (s StatusPacket) toMap() StatusPacketMap {
-	ret := StatusPacketMap{
-		make(map[SignatureMap]bool),
-		make(map[SignatureMap]bool),
-	}
-
-	for sig, _ := range s.PollPkts {
-		ret.PollPkts[sig.toMap()] = true
-	}
-
-	for sig, _ := range s.ReputationPkts {
-		ret.ReputationPkts[sig.toMap()] = true
-	}
-
-	return ret
-}
-
-func (s StatusPacketMap) toBase() StatusPacket {
-	ret := StatusPacket{
-		make(map[Signature]bool),
-		make(map[Signature]bool),
-	}
-
-	for sig, _ := range s.PollPkts {
-		ret.PollPkts[sig.toBase()] = true
-	}
-
-	for sig, _ := range s.ReputationPkts {
-		ret.ReputationPkts[sig.toBase()] = true
-	}
-
-	return ret
-}
+// the tag of ring signatures, as [2]*big.Int compares pointers
+type LinkTagMap [2]BigIntMap
 
-type EllipticCurveSignatureMap struct {
-	R BigIntMap
-	S BigIntMap
-}
-
-func (s EllipticCurveSignature) toMap() EllipticCurveSignatureMap {
-	return EllipticCurveSignatureMap{
-		BigIntMapFrom(&s.R),
-		BigIntMapFrom(&s.S),
+func LinkTagMapFrom(tag [2]*big.Int) LinkTagMap {
+	return LinkTagMap{
+		BigIntMapFrom(tag[0]),
+		BigIntMapFrom(tag[1]),
 	}
 }
 
-func (s EllipticCurveSignatureMap) toBase() EllipticCurveSignature {
-	return EllipticCurveSignature{
-		*s.R.toBase(),
-		*s.S.toBase(),
-	}
-}
-
-type LinkableRingSignatureMap struct {
-	Message string
-	C0      string
-	S       [32]BigIntMap
-	SSize   int
-	Tag     [2]BigIntMap
-}
-
-func (s LinkableRingSignature) toMap() LinkableRingSignatureMap {
-	ret := LinkableRingSignatureMap{
-		Message: string(s.Message),
-		C0:      string(s.C0),
-		SSize:   len(s.S),
-	}
-
-	for i, v := range s.S {
-		ret.S[i] = BigIntMapFrom(v)
-	}
-
-	for i, v := range s.Tag {
-		ret.Tag[i] = BigIntMapFrom(v)
-	}
-
-	return ret
-}
-
-func (s LinkableRingSignatureMap) toBase() LinkableRingSignature {
-	ret := LinkableRingSignature{
-		Message: []byte(s.Message),
-		C0:      []byte(s.C0),
-		S:       make([]*big.Int, 0),
-	}
-
-	for i := 0; i < s.SSize; i++ {
-		v := s.S[i]
-		ret.S = append(ret.S, v.toBase())
-	}
-
-	for i, v := range s.Tag {
-		ret.Tag[i] = v.toBase()
-	}
-
-	return ret
-}
-
-type SignatureMap struct {
-	Linkable      LinkableRingSignatureMap
-	LinkableEmpty bool
-	Elliptic      EllipticCurveSignatureMap
-	EllipticEmpty bool
-}
-
-func (s Signature) toMap() SignatureMap {
-	ret := SignatureMap{
-		LinkableEmpty: s.Linkable == nil,
-		EllipticEmpty: s.Elliptic == nil,
-	}
-
-	if s.Linkable != nil {
-		ret.Linkable = s.Linkable.toMap()
-	}
-
-	if s.Elliptic != nil {
-		ret.Elliptic = s.Elliptic.toMap()
-	}
-
-	return ret
-}
-
-func (s SignatureMap) toBase() Signature {
-	var l *LinkableRingSignature
-	if !s.LinkableEmpty {
-		sig := s.Linkable.toBase()
-		l = &sig
-	}
-
-	var e *EllipticCurveSignature
-	if !s.EllipticEmpty {
-		sig := s.Elliptic.toBase()
-		e = &sig
-	}
-
-	return Signature{l, e}
+func (t LinkTagMap) toBase() [2]*big.Int {
+	return [2]*big.Int{t[0].toBase(), t[1].toBase()}
 }
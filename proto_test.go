@@ -0,0 +1,418 @@
+package pollparty
+
+import (
+	"crypto/ecdsa"
+	crypto "crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommitmentValid(t *testing.T) {
+	g := DummyGossiper()
+	id := PollKey{g.KeyPair.PublicKey, uint64(1)}
+	options := []string{"Yes", "No", "Maybe"}
+	tag := pointBaseMul(mustRandomScalar())
+
+	for _, o := range options {
+		commit, salt, err := NewCommitment(id, tag, options, o)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !commit.Valid(id, tag, len(options)) {
+			t.Errorf("Unable to verify commitment to \"%s\"", o)
+		}
+
+		opened, ok := Vote{Salt: salt, Option: o}.Commitment(id, tag, options)
+		if !ok || opened.Digest() != commit.Digest() {
+			t.Errorf("Vote doesn't open its commitment to \"%s\"", o)
+		}
+
+		if commit.Valid(PollKey{g.KeyPair.PublicKey, uint64(2)}, tag, len(options)) {
+			t.Errorf("Commitment replayed in another poll")
+		}
+
+		if commit.Valid(id, pointBaseMul(mustRandomScalar()), len(options)) {
+			t.Errorf("Commitment replayed by another voter")
+		}
+
+		commit.Version++
+		if commit.Valid(id, tag, len(options)) {
+			t.Errorf("Commitment with an unknown version accepted")
+		}
+	}
+
+	if _, _, err := NewCommitment(id, tag, options, "Perhaps"); err == nil {
+		t.Errorf("Committed to an unknown option")
+	}
+}
+
+func TestCommitmentHiding(t *testing.T) {
+	g := DummyGossiper()
+	id := PollKey{g.KeyPair.PublicKey, uint64(1)}
+	options := []string{"Yes", "No"}
+	tag := pointBaseMul(mustRandomScalar())
+
+	first, _, err := NewCommitment(id, tag, options, "Yes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, _, err := NewCommitment(id, tag, options, "Yes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Digest() == second.Digest() {
+		t.Errorf("Same commitment for the same option")
+	}
+}
+
+func TestCommitmentToInvalidOption(t *testing.T) {
+	g := DummyGossiper()
+	id := PollKey{g.KeyPair.PublicKey, uint64(1)}
+	options := []string{"Yes", "No"}
+	context := tallyContext(id, "commitment")
+	tag := pointBaseMul(mustRandomScalar())
+	U := commitmentU(CommitmentVersion, id, tag)
+
+	// commits to the third option of a two options poll
+	salt := mustRandomScalar()
+	point := commitOption(U, 2, salt)
+	proof := proveOption(U, point, 3, 2, salt, context)
+
+	if (Commitment{Version: CommitmentVersion, Point: point, Proof: proof}).Valid(id, tag, len(options)) {
+		t.Errorf("Accepted a proof with too much options")
+	}
+
+	proof.C, proof.Z = proof.C[1:], proof.Z[1:]
+	if (Commitment{Version: CommitmentVersion, Point: point, Proof: proof}).Valid(id, tag, len(options)) {
+		t.Errorf("Accepted a commitment to an invalid option")
+	}
+
+	valid, _, err := NewCommitment(id, tag, options, "No")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if (Commitment{Version: CommitmentVersion, Point: point, Proof: valid.Proof}).Valid(id, tag, len(options)) {
+		t.Errorf("Accepted a proof for another commitment")
+	}
+}
+
+func TestInvalidCommitmentRejectedBeforeReveal(t *testing.T) {
+	g := DummyGossiper()
+	dispatch := DispatcherPeersterMessage(g)
+	peer := *parseAddr("127.0.0.1:5001")
+
+	id := PollKey{g.KeyPair.PublicKey, uint64(1)}
+	g.RunningPolls.Add(id, drainHandler)
+	poll := DummyPoll()
+	g.Polls.Store(PollPacket{ID: id, Poll: poll})
+
+	key, err := ecdsa.GenerateKey(Curve(), crypto.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	participants := [][2]big.Int{{*key.X, *key.Y}, {*g.KeyPair.X, *g.KeyPair.Y}}
+	g.storeParticipants(id, participants, nil)
+
+	U := commitmentU(CommitmentVersion, id, ringTag(participants, key))
+	salt := mustRandomScalar()
+	point := commitOption(U, len(poll.Options), salt)
+	commit := Commitment{
+		Version: CommitmentVersion,
+		Point:   point,
+		Proof:   proveOption(U, point, len(poll.Options)+1, len(poll.Options), salt, tallyContext(id, "commitment")),
+	}
+	commit.Proof.C, commit.Proof.Z = commit.Proof.C[1:], commit.Proof.Z[1:]
+
+	pkg := PollPacket{ID: id, Commitment: &commit}
+	input, err := json.Marshal(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig := ringSignature(poll.Scheme, input, participants, key, 0)
+	dispatch(peer, wireRoundTrip(t, GossipPacket{Poll: &pkg, Signature: &sig}))
+
+	if len(g.Polls.Get(id).Commitments) != 0 {
+		t.Errorf("Stored a commitment to an invalid option")
+	}
+
+	if g.Reputations.Opinions[peer.String()] != -1 {
+		t.Errorf("Peer forwarding an invalid commitment not suspected")
+	}
+}
+
+func TestVoteOpensOnlyItsOwnCommitment(t *testing.T) {
+	g := DummyGossiper()
+	id := PollKey{g.KeyPair.PublicKey, uint64(1)}
+	tag, other := pointBaseMul(mustRandomScalar()), pointBaseMul(mustRandomScalar())
+
+	info := ShareablePollInfo{
+		Poll: *DummyPoll(),
+		Tags: make(map[LinkTagMap][][sha256.Size]byte),
+	}
+
+	commit, salt, err := NewCommitment(id, tag, info.Poll.Options, "No")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info.Tags[LinkTagMapFrom(tag)] = [][sha256.Size]byte{commit.Digest()}
+
+	voteUnder := func(tag [2]*big.Int, vote Vote) GossipPacket {
+		return GossipPacket{
+			Poll:      &PollPacket{ID: id, Vote: &vote},
+			Signature: &Signature{Linkable: &LinkableRingSignature{Tag: tag}},
+		}
+	}
+
+	if _, ok := openedCommitment(info, voteUnder(tag, Vote{Salt: salt, Option: "No"})); !ok {
+		t.Errorf("Vote doesn't open its commitment")
+	}
+
+	if _, ok := openedCommitment(info, voteUnder(tag, Vote{Salt: salt, Option: "Yes"})); ok {
+		t.Errorf("Vote opened a commitment to another option")
+	}
+
+	if _, ok := openedCommitment(info, voteUnder(other, Vote{Salt: salt, Option: "No"})); ok {
+		t.Errorf("Vote opened a commitment under another tag")
+	}
+}
+
+func TestRevotingSupersedesCommitments(t *testing.T) {
+	g := DummyGossiper()
+	dispatch := DispatcherPeersterMessage(g)
+	peer := *parseAddr("127.0.0.1:5001")
+
+	id := PollKey{g.KeyPair.PublicKey, uint64(1)}
+	g.RunningPolls.Add(id, drainHandler)
+	poll := DummyPoll()
+	poll.Revoting = true
+	g.Polls.Store(PollPacket{ID: id, Poll: poll})
+
+	key, err := ecdsa.GenerateKey(Curve(), crypto.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	participants := [][2]big.Int{{*key.X, *key.Y}, {*g.KeyPair.X, *g.KeyPair.Y}}
+	g.storeParticipants(id, participants, nil)
+	tag := ringTag(participants, key)
+
+	send := func(pkg PollPacket) {
+		input, err := json.Marshal(pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig := ringSignature(poll.Scheme, input, participants, key, 0)
+		dispatch(peer, wireRoundTrip(t, GossipPacket{Poll: &pkg, Signature: &sig}))
+	}
+
+	commits := make([]Commitment, 3)
+	salts := make([]*big.Int, 3)
+	for i, o := range []string{"Yes", "No", "Yes"} {
+		commits[i], salts[i], err = NewCommitment(id, tag, poll.Options, o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commits[i].Sequence = uint64(i)
+	}
+
+	// gossip doesn't keep the order
+	send(PollPacket{ID: id, Commitment: &commits[1]})
+	send(PollPacket{ID: id, Commitment: &commits[0]})
+
+	history := g.Polls.Get(id).Tags[LinkTagMapFrom(tag)]
+	if len(history) != 2 || history[0] != commits[0].Digest() || history[1] != commits[1].Digest() {
+		t.Fatalf("Supersession history not ordered by sequence")
+	}
+
+	if g.Reputations.Opinions[peer.String()] != 0 {
+		t.Errorf("Peer forwarding a new commitment suspected")
+	}
+
+	equivocation, _, err := NewCommitment(id, tag, poll.Options, "Yes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	equivocation.Sequence = 1
+	send(PollPacket{ID: id, Commitment: &equivocation})
+	if len(g.Polls.Get(id).Commitments) != 2 || g.Reputations.Opinions[peer.String()] != -1 {
+		t.Errorf("Two commitments with the same sequence accepted")
+	}
+
+	send(PollPacket{ID: id, Vote: &Vote{Salt: salts[0], Option: "Yes"}})
+	send(PollPacket{ID: id, Vote: &Vote{Salt: salts[1], Option: "No"}})
+	if results := g.Polls.Get(id).Results(); results["Yes"] != 0 || results["No"] != 1 {
+		t.Errorf("Expected only the final vote to be counted, got %v", results)
+	}
+
+	send(PollPacket{ID: id, Commitment: &commits[2]})
+	if results := g.Polls.Get(id).Results(); len(results) != 0 {
+		t.Errorf("Superseded vote still counted: %v", results)
+	}
+
+	send(PollPacket{ID: id, Vote: &Vote{Salt: salts[2], Option: "Yes"}})
+	if results := g.Polls.Get(id).Results(); results["Yes"] != 1 || results["No"] != 0 {
+		t.Errorf("Expected only the final vote to be counted, got %v", results)
+	}
+}
+
+func TestRevotingNeedsPollPolicy(t *testing.T) {
+	g := DummyGossiper()
+	dispatch := DispatcherPeersterMessage(g)
+	peer := *parseAddr("127.0.0.1:5001")
+
+	id := PollKey{g.KeyPair.PublicKey, uint64(1)}
+	g.RunningPolls.Add(id, drainHandler)
+	poll := DummyPoll()
+	g.Polls.Store(PollPacket{ID: id, Poll: poll})
+
+	key, err := ecdsa.GenerateKey(Curve(), crypto.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	participants := [][2]big.Int{{*key.X, *key.Y}, {*g.KeyPair.X, *g.KeyPair.Y}}
+	g.storeParticipants(id, participants, nil)
+
+	send := func(answer string, sequence uint64) {
+		commit, _, err := NewCommitment(id, ringTag(participants, key), poll.Options, answer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commit.Sequence = sequence
+
+		pkg := PollPacket{ID: id, Commitment: &commit}
+		input, err := json.Marshal(pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig := ringSignature(poll.Scheme, input, participants, key, 0)
+		dispatch(peer, wireRoundTrip(t, GossipPacket{Poll: &pkg, Signature: &sig}))
+	}
+
+	send("Yes", 0)
+	send("No", 1)
+	if len(g.Polls.Get(id).Commitments) != 1 || g.Reputations.Opinions[peer.String()] != -1 {
+		t.Errorf("Accepted a new commitment in a poll without re-voting")
+	}
+}
+
+func TestPollKeyString(t *testing.T) {
+	g := DummyGossiper()
+	id := NewPollKey(g, *DummyPoll())
+
+	packed := id.String()
+	if len(packed) > 70 || strings.ToLower(packed) != packed {
+		t.Errorf("Poll key not compact: %s", packed)
+	}
+
+	unpacked, err := PollKeyFromString(packed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unpacked.Pack() != id.Pack() {
+		t.Errorf("Poll key changed by its encoding")
+	}
+
+	if _, err := PollKeyFromString(strings.ToUpper(packed)); err != nil {
+		t.Errorf("Poll key encoding is case sensitive")
+	}
+
+	for _, invalid := range []string{"", packed[:10], packed[:len(packed)-5], "not-base32"} {
+		if _, err := PollKeyFromString(invalid); err == nil {
+			t.Errorf("Parsed invalid poll key \"%s\"", invalid)
+		}
+	}
+}
+
+func TestNewPollKeyAfterRestart(t *testing.T) {
+	g := DummyGossiper()
+	restarted := newGossiper("name", g.KeyPair, make([][2]big.Int, 0), Server{})
+
+	poll := *DummyPoll()
+	if NewPollKey(g, poll) != NewPollKey(restarted, poll) {
+		t.Errorf("Poll key not derived from the poll")
+	}
+
+	later := poll
+	later.StartTime = poll.StartTime.Add(time.Second)
+	first, second := NewPollKey(g, poll).String(), NewPollKey(restarted, later).String()
+	if first == second || first[:8] == second[:8] {
+		t.Errorf("Same question asked again has the same key")
+	}
+}
+
+func TestPollIDCheckedOnReceive(t *testing.T) {
+	origin := DummyGossiper()
+	peer := *parseAddr("127.0.0.1:5001")
+
+	received := func(id PollKey, body Poll) bool {
+		g := DummyGossiper()
+		dispatch := DispatcherPeersterMessage(g)
+		g.RunningPolls.Add(id, drainHandler)
+
+		pkg := PollPacket{ID: id, Poll: &body}
+		sig, err := ecSignature(origin, pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dispatch(peer, wireRoundTrip(t, GossipPacket{Poll: &pkg, Signature: &sig}))
+
+		stored := g.Polls.Get(id).Poll.Question != ""
+		if !stored && g.Reputations.Opinions[peer.String()] != -1 {
+			t.Errorf("Sender of a mismatching poll not suspected")
+		}
+		return stored
+	}
+
+	poll := *DummyPoll()
+	if !received(NewPollKey(origin, poll), poll) {
+		t.Fatalf("Poll with its own id rejected")
+	}
+
+	if received(PollKey{origin.KeyPair.PublicKey, uint64(1)}, poll) {
+		t.Errorf("Accepted a poll with an arbitrary id")
+	}
+
+	other := poll
+	other.Question = "Do you like cats?"
+	if received(NewPollKey(origin, poll), other) {
+		t.Errorf("Accepted a poll under the id of another body")
+	}
+}
+
+func TestDigestIgnoresTimeZone(t *testing.T) {
+	g := DummyGossiper()
+	poll := DummyPoll()
+	poll.StartTime = time.Unix(poll.StartTime.Unix(), 0).UTC()
+
+	local := *poll
+	local.StartTime = poll.StartTime.In(time.FixedZone("CEST", 2*60*60))
+
+	id := PollKey{g.KeyPair.PublicKey, uint64(1)}
+	sig, err := ecSignature(g, PollPacket{ID: id, Poll: poll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := GossipPacket{Poll: &PollPacket{ID: id, Poll: poll}, Signature: &sig}
+	zoned := GossipPacket{Poll: &PollPacket{ID: id, Poll: &local}, Signature: &sig}
+
+	if packetDigest(t, utc) != packetDigest(t, zoned) {
+		t.Error("Digest depends on the time zone of the poll")
+	}
+	if pollID(g.KeyPair.PublicKey, *poll) != pollID(g.KeyPair.PublicKey, local) {
+		t.Error("Poll id depends on the time zone")
+	}
+	if decoded := wireRoundTrip(t, zoned); decoded.Poll.Poll.StartTime.Location() != time.UTC {
+		t.Error("Times not decoded in UTC")
+	}
+	if packetDigest(t, utc) != packetDigest(t, wireRoundTrip(t, zoned)) {
+		t.Error("Digest changed over the wire")
+	}
+}
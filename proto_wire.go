@@ -2,6 +2,7 @@ package pollparty
 
 import (
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/sha256"
 	"errors"
 	"math/big"
@@ -46,38 +47,98 @@ func (msg PollKeyWire) toBase() PollKey {
 	}
 }
 
-// used only on the network because protobuf lib fail to encode fixed size array
 type CommitmentWire struct {
-	Hash []byte
+	Version  uint32
+	Sequence uint64
+	Point    []byte
+	Proof    OptionProofWire
+	Escrow   *SaltEscrowWire
+	Weight   int
 }
 
 func (msg CommitmentWire) check() error {
-	if len(msg.Hash) != sha256.Size {
-		return errors.New("invalid hash size")
+	if err := checkPoints(msg.Point); err != nil {
+		return errors.New("CommitmentWire: " + err.Error())
 	}
 
-	return nil
+	if msg.Escrow != nil {
+		if err := msg.Escrow.check(); err != nil {
+			return err
+		}
+	}
+
+	return msg.Proof.check()
 }
 
 func (msg Commitment) toWire() CommitmentWire {
+	var e *SaltEscrowWire = nil
+	if msg.Escrow != nil {
+		wired := msg.Escrow.toWire()
+		e = &wired
+	}
+
 	return CommitmentWire{
-		Hash: msg.Hash[:],
+		Version:  msg.Version,
+		Sequence: msg.Sequence,
+		Point:    pointsToWire([][2]*big.Int{msg.Point})[0],
+		Proof:    msg.Proof.toWire(),
+		Escrow:   e,
+		Weight:   msg.Weight,
 	}
 }
 
 func (msg CommitmentWire) toBase() Commitment {
-	var c Commitment
-	copy(c.Hash[:], msg.Hash)
-	return c
+	var e *SaltEscrow = nil
+	if msg.Escrow != nil {
+		base := msg.Escrow.toBase()
+		e = &base
+	}
+
+	return Commitment{
+		Version:  msg.Version,
+		Sequence: msg.Sequence,
+		Point:    pointsFromWire([][]byte{msg.Point})[0],
+		Proof:    msg.Proof.toBase(),
+		Escrow:   e,
+		Weight:   msg.Weight,
+	}
+}
+
+type OptionProofWire struct {
+	C [][]byte
+	Z [][]byte
+}
+
+func (msg OptionProofWire) check() error {
+	if len(msg.C) == 0 || len(msg.C) != len(msg.Z) {
+		return errors.New("OptionProofWire: not as much responses as challenges")
+	}
+
+	return nil
+}
+
+func (msg OptionProof) toWire() OptionProofWire {
+	return OptionProofWire{
+		C: scalarsToWire(msg.C),
+		Z: scalarsToWire(msg.Z),
+	}
+}
+
+func (msg OptionProofWire) toBase() OptionProof {
+	return OptionProof{
+		C: scalarsFromWire(msg.C),
+		Z: scalarsFromWire(msg.Z),
+	}
 }
 
 type VoteWire struct {
 	Salt   []byte
 	Option string
+	Weight int
 }
 
 func (msg VoteWire) check() error {
-	if len(msg.Salt) != SaltSize {
+	if len(msg.Salt) > len(Curve().Params().N.Bytes()) {
 		return errors.New("invalid salt size")
 	}
 
@@ -86,26 +147,35 @@ func (msg VoteWire) check() error {
 
 func (msg Vote) toWire() VoteWire {
 	return VoteWire{
-		Salt:   msg.Salt[:],
+		Salt:   msg.Salt.Bytes(),
 		Option: msg.Option,
+		Weight: msg.Weight,
 	}
 }
 
 func (msg VoteWire) toBase() Vote {
-	v := Vote{
+	return Vote{
+		Salt:   new(big.Int).SetBytes(msg.Salt),
 		Option: msg.Option,
+		Weight: msg.Weight,
 	}
-	copy(v.Salt[:], msg.Salt)
-	return v
 }
 
 type PollPacketWire struct {
-	ID         PollKeyWire
-	Poll       *Poll
-	VoteKey    *VoteKeyWire
-	VoteKeys   *VoteKeysWire
-	Commitment *CommitmentWire
-	Vote       *VoteWire
+	ID           PollKeyWire
+	Poll         *Poll
+	VoteKey      *VoteKeyWire
+	VoteKeys     *VoteKeysWire
+	Commitment   *CommitmentWire
+	Vote         *VoteWire
+	Ballot       *BallotWire
+	Decryption   *PartialDecryptionWire
+	Deal         *DKGDealWire
+	Complaint    *DKGComplaintWire
+	EscrowShare  *EscrowShareWire
+	Control      *PollControl
+	Equivocation *PollEquivocationWire
+	Metadata     *PollMetadata // last, older nodes skip it
 }
 
 func (pkg PollPacketWire) check() error {
@@ -134,6 +204,61 @@ func (pkg PollPacketWire) check() error {
 
 	if pkg.Vote != nil {
 		nilCount++
+		err = pkg.Vote.check()
+	}
+
+	if pkg.VoteKey != nil && err == nil {
+		err = pkg.VoteKey.check()
+	}
+
+	if pkg.VoteKeys != nil && err == nil {
+		for _, k := range pkg.VoteKeys.Keys {
+			if err == nil {
+				err = k.check()
+			}
+		}
+	}
+
+	if pkg.Ballot != nil {
+		nilCount++
+		err = pkg.Ballot.check()
+	}
+
+	if pkg.Decryption != nil {
+		nilCount++
+		err = pkg.Decryption.check()
+	}
+
+	if pkg.Deal != nil {
+		nilCount++
+		err = pkg.Deal.check()
+	}
+
+	if pkg.Complaint != nil {
+		nilCount++
+		err = pkg.Complaint.check()
+	}
+
+	if pkg.EscrowShare != nil {
+		nilCount++
+		err = pkg.EscrowShare.check()
+	}
+
+	if pkg.Control != nil {
+		nilCount++
+		err = pkg.Control.check()
+	}
+
+	if pkg.Equivocation != nil {
+		nilCount++
+		err = pkg.Equivocation.check()
+	}
+
+	if pkg.Metadata != nil && err == nil {
+		if pkg.Poll == nil {
+			return retErr("metadata without poll")
+		}
+		err = pkg.Metadata.check()
 	}
 
 	if err != nil {
@@ -174,13 +299,57 @@ func (msg PollPacket) toWire() PollPacketWire {
 		v = &wired
 	}
 
+	var b *BallotWire = nil
+	if msg.Ballot != nil {
+		wired := msg.Ballot.toWire()
+		b = &wired
+	}
+
+	var d *PartialDecryptionWire = nil
+	if msg.Decryption != nil {
+		wired := msg.Decryption.toWire()
+		d = &wired
+	}
+
+	var deal *DKGDealWire = nil
+	if msg.Deal != nil {
+		wired := msg.Deal.toWire()
+		deal = &wired
+	}
+
+	var complaint *DKGComplaintWire = nil
+	if msg.Complaint != nil {
+		wired := msg.Complaint.toWire()
+		complaint = &wired
+	}
+
+	var share *EscrowShareWire = nil
+	if msg.EscrowShare != nil {
+		wired := msg.EscrowShare.toWire()
+		share = &wired
+	}
+
+	var equivocation *PollEquivocationWire = nil
+	if msg.Equivocation != nil {
+		wired := msg.Equivocation.toWire()
+		equivocation = &wired
+	}
+
 	return PollPacketWire{
-		ID:         msg.ID.toWire(),
-		Poll:       msg.Poll,
-		VoteKey:    vk,
-		VoteKeys:   vks,
-		Commitment: c,
-		Vote:       v,
+		ID:           msg.ID.toWire(),
+		Poll:         msg.Poll,
+		VoteKey:      vk,
+		VoteKeys:     vks,
+		Commitment:   c,
+		Vote:         v,
+		Ballot:       b,
+		Decryption:   d,
+		Deal:         deal,
+		Complaint:    complaint,
+		EscrowShare:  share,
+		Control:      msg.Control,
+		Equivocation: equivocation,
+		Metadata:     msg.Metadata,
 	}
 }
 
@@ -188,8 +357,10 @@ func (msg PollPacketWire) toBase() PollPacket {
 	const head = "PollPacketWire: "
 
 	ret := PollPacket{
-		ID:   msg.ID.toBase(),
-		Poll: msg.Poll,
+		ID:       msg.ID.toBase(),
+		Poll:     msg.Poll,
+		Control:  msg.Control,
+		Metadata: msg.Metadata,
 	}
 
 	if msg.VoteKey != nil {
@@ -212,58 +383,143 @@ func (msg PollPacketWire) toBase() PollPacket {
 		ret.Vote = &wired
 	}
 
-	return ret
+	if msg.Ballot != nil {
+		wired := msg.Ballot.toBase()
+		ret.Ballot = &wired
+	}
+
+	if msg.Decryption != nil {
+		wired := msg.Decryption.toBase()
+		ret.Decryption = &wired
+	}
+
+	if msg.Deal != nil {
+		wired := msg.Deal.toBase()
+		ret.Deal = &wired
+	}
+
+	if msg.Complaint != nil {
+		wired := msg.Complaint.toBase()
+		ret.Complaint = &wired
+	}
+
+	if msg.EscrowShare != nil {
+		wired := msg.EscrowShare.toBase()
+		ret.EscrowShare = &wired
+	}
+
+	if msg.Equivocation != nil {
+		wired := msg.Equivocation.toBase()
+		ret.Equivocation = &wired
+	}
+
+	// signatures are over the times as the sender had them, in UTC
+	return ret.canonical()
 }
 
 type StatusPacketWire struct {
-	PollPkts       map[SignatureWire]bool
-	ReputationPkts map[SignatureWire]bool
+	PollPkts       [][]byte
+	ReputationPkts [][]byte
+	Signer         PublicKeyWire
+	Cookie         []byte
+	Nonce          []byte
 }
 
 func (pkg StatusPacketWire) check() error {
+	for _, digests := range [][][]byte{pkg.PollPkts, pkg.ReputationPkts} {
+		for _, d := range digests {
+			if len(d) != sha256.Size {
+				return errors.New("StatusPacketWire: invalid digest size")
+			}
+		}
+	}
+
+	if len(pkg.Cookie) != 0 && len(pkg.Cookie) != CookieSize {
+		return errors.New("StatusPacketWire: invalid cookie size")
+	}
+
+	if len(pkg.Nonce) != 0 && len(pkg.Nonce) != CookieSize {
+		return errors.New("StatusPacketWire: invalid nonce size")
+	}
+
 	return nil
 }
 
 func (pkg StatusPacket) toWire() StatusPacketWire {
-	polls := make(map[SignatureWire]bool)
-	reps := make(map[SignatureWire]bool)
+	polls := make([][]byte, 0, len(pkg.PollPkts))
+	reps := make([][]byte, 0, len(pkg.ReputationPkts))
 
-	for p, _ := range pkg.PollPkts {
-		polls[p.toWire()] = true
+	for p := range pkg.PollPkts {
+		d := p
+		polls = append(polls, d[:])
 	}
 
-	for r, _ := range pkg.ReputationPkts {
-		reps[r.toWire()] = true
+	for r := range pkg.ReputationPkts {
+		d := r
+		reps = append(reps, d[:])
 	}
 
 	return StatusPacketWire{
 		PollPkts:       polls,
 		ReputationPkts: reps,
+		Signer:         PublicKeyWireFromEcdsa(pkg.Signer),
+		Cookie:         pkg.Cookie,
+		Nonce:          pkg.Nonce,
 	}
 }
 
 func (pkg StatusPacketWire) toBase() StatusPacket {
 	ret := StatusPacket{
-		PollPkts:       make(map[Signature]bool),
-		ReputationPkts: make(map[Signature]bool),
+		PollPkts:       make(map[PacketDigest]bool),
+		ReputationPkts: make(map[PacketDigest]bool),
+		Signer:         pkg.Signer.toEcdsa(),
+		Cookie:         pkg.Cookie,
+		Nonce:          pkg.Nonce,
 	}
 
-	for p, _ := range pkg.PollPkts {
-		ret.PollPkts[p.toBase()] = true
+	for _, p := range pkg.PollPkts {
+		var d PacketDigest
+		copy(d[:], p)
+		ret.PollPkts[d] = true
 	}
 
-	for r, _ := range pkg.ReputationPkts {
-		ret.ReputationPkts[r.toBase()] = true
+	for _, r := range pkg.ReputationPkts {
+		var d PacketDigest
+		copy(d[:], r)
+		ret.ReputationPkts[d] = true
 	}
 
 	return ret
 }
 
+type CookiePacketWire struct {
+	Cookie []byte
+	Nonce  []byte
+}
+
+func (pkg CookiePacketWire) check() error {
+	if len(pkg.Cookie) != CookieSize || len(pkg.Nonce) != CookieSize {
+		return errors.New("CookiePacketWire: invalid cookie or nonce size")
+	}
+
+	return nil
+}
+
+func (pkg CookiePacket) toWire() CookiePacketWire {
+	return CookiePacketWire{Cookie: pkg.Cookie, Nonce: pkg.Nonce}
+}
+
+func (pkg CookiePacketWire) toBase() CookiePacket {
+	return CookiePacket{Cookie: pkg.Cookie, Nonce: pkg.Nonce}
+}
+
 type GossipPacketWire struct {
 	Poll       *PollPacketWire
 	Signature  *SignatureWire
 	Status     *StatusPacketWire
 	Reputation *ReputationPacketWire
+	Evidence   *EvidencePacketWire
+	Cookie     *CookiePacketWire
 }
 
 func (pkg GossipPacketWire) Check() error {
@@ -285,12 +541,34 @@ func (pkg GossipPacketWire) Check() error {
 	if pkg.Status != nil {
 		nilCount++
 		err = pkg.Status.check()
+
+		if pkg.Signature == nil {
+			return errRet("status without signature")
+		}
 	}
 
 	if pkg.Reputation != nil {
 		nilCount++
 	}
 
+	if pkg.Evidence != nil {
+		nilCount++
+		err = pkg.Evidence.check()
+
+		if pkg.Signature == nil {
+			return errRet("evidence without signature")
+		}
+	}
+
+	if pkg.Cookie != nil {
+		nilCount++
+		err = pkg.Cookie.check()
+	}
+
+	if err == nil && pkg.Signature != nil {
+		err = pkg.Signature.check()
+	}
+
 	if err != nil {
 		return errRet(err.Error())
 	}
@@ -331,11 +609,25 @@ func (msg GossipPacket) ToWire() GossipPacketWire {
 		r = &wired
 	}
 
+	var e *EvidencePacketWire = nil
+	if msg.Evidence != nil {
+		wired := msg.Evidence.ToWire()
+		e = &wired
+	}
+
+	var c *CookiePacketWire = nil
+	if msg.Cookie != nil {
+		wired := msg.Cookie.toWire()
+		c = &wired
+	}
+
 	return GossipPacketWire{
 		Poll:       p,
 		Signature:  sig,
 		Status:     s,
 		Reputation: r,
+		Evidence:   e,
+		Cookie:     c,
 	}
 }
 
@@ -357,6 +649,21 @@ func (msg GossipPacketWire) ToBase() GossipPacket {
 		ret.Signature = &wire
 	}
 
+	if msg.Reputation != nil {
+		wire := msg.Reputation.ToBase()
+		ret.Reputation = &wire
+	}
+
+	if msg.Evidence != nil {
+		wire := msg.Evidence.ToBase()
+		ret.Evidence = &wire
+	}
+
+	if msg.Cookie != nil {
+		wire := msg.Cookie.toBase()
+		ret.Cookie = &wire
+	}
+
 	return ret
 }
 
@@ -385,20 +692,41 @@ func (msg EllipticCurveSignatureWire) toBase() EllipticCurveSignature {
 type SignatureWire struct {
 	Linkable *LinkableRingSignatureWire
 	Elliptic *EllipticCurveSignatureWire
+	Compact  *CompactRingSignatureWire
 }
 
 func (msg SignatureWire) check() error {
+	var nilCount uint = 0
 	var err error = nil
 
-	if (msg.Linkable == nil) != (msg.Elliptic == nil) { // bool xor
-		return errors.New("SignatureWire: no/all field definied")
-	}
-
 	if msg.Linkable != nil {
+		nilCount++
 		err = msg.Linkable.check()
 	}
 
-	return err
+	if msg.Elliptic != nil {
+		nilCount++
+	}
+
+	if msg.Compact != nil {
+		nilCount++
+		err = msg.Compact.check()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// anonymous polls are signed by their origin and by a ring of valid keys
+	if nilCount == 2 && msg.Linkable != nil && msg.Elliptic != nil {
+		return nil
+	}
+
+	if nilCount != 1 {
+		return errors.New("SignatureWire: no/all field definied")
+	}
+
+	return nil
 }
 
 func (msg Signature) toWire() SignatureWire {
@@ -414,9 +742,16 @@ func (msg Signature) toWire() SignatureWire {
 		e = &wired
 	}
 
+	var c *CompactRingSignatureWire = nil
+	if msg.Compact != nil {
+		wired := msg.Compact.toWire()
+		c = &wired
+	}
+
 	return SignatureWire{
 		Linkable: l,
 		Elliptic: e,
+		Compact:  c,
 	}
 }
 
@@ -433,6 +768,11 @@ func (msg SignatureWire) toBase() Signature {
 		ret.Elliptic = &e
 	}
 
+	if msg.Compact != nil {
+		c := msg.Compact.toBase()
+		ret.Compact = &c
+	}
+
 	return ret
 }
 
@@ -488,20 +828,147 @@ func (msg LinkableRingSignatureWire) toBase() LinkableRingSignature {
 	return ret
 }
 
+// points are sent compressed, see elliptic.MarshalCompressed
+type CompactRingSignatureWire struct {
+	Message []byte
+	CL      [][]byte
+	CA      [][]byte
+	CB      [][]byte
+	CD      [][]byte
+	Q       [][]byte
+	F       [][]byte
+	ZA      [][]byte
+	ZB      [][]byte
+	ZD      []byte
+	Tag     []byte
+}
+
+func (msg CompactRingSignatureWire) check() error {
+	m := len(msg.CL)
+
+	if m == 0 || len(msg.CA) != m || len(msg.CB) != m || len(msg.CD) != m || len(msg.Q) != m ||
+		len(msg.F) != m || len(msg.ZA) != m || len(msg.ZB) != m {
+		return errors.New("CompactRingSignatureWire: inconsistent number of bits")
+	}
+
+	for _, points := range [][][]byte{msg.CL, msg.CA, msg.CB, msg.CD, msg.Q, {msg.Tag}} {
+		for _, p := range points {
+			x, _ := elliptic.UnmarshalCompressed(Curve(), p)
+			if x == nil {
+				return errors.New("CompactRingSignatureWire: invalid point")
+			}
+		}
+	}
+
+	return nil
+}
+
+func pointsToWire(points [][2]*big.Int) [][]byte {
+	ret := make([][]byte, len(points))
+	for i, p := range points {
+		ret[i] = elliptic.MarshalCompressed(Curve(), p[0], p[1])
+	}
+	return ret
+}
+
+func pointsFromWire(points [][]byte) [][2]*big.Int {
+	ret := make([][2]*big.Int, len(points))
+	for i, p := range points {
+		ret[i][0], ret[i][1] = elliptic.UnmarshalCompressed(Curve(), p)
+	}
+	return ret
+}
+
+func scalarsToWire(scalars []*big.Int) [][]byte {
+	ret := make([][]byte, len(scalars))
+	for i, s := range scalars {
+		ret[i] = s.Bytes()
+	}
+	return ret
+}
+
+func scalarsFromWire(scalars [][]byte) []*big.Int {
+	ret := make([]*big.Int, len(scalars))
+	for i, s := range scalars {
+		ret[i] = new(big.Int).SetBytes(s)
+	}
+	return ret
+}
+
+func (msg CompactRingSignature) toWire() CompactRingSignatureWire {
+	return CompactRingSignatureWire{
+		Message: msg.Message,
+		CL:      pointsToWire(msg.CL),
+		CA:      pointsToWire(msg.CA),
+		CB:      pointsToWire(msg.CB),
+		CD:      pointsToWire(msg.CD),
+		Q:       pointsToWire(msg.Q),
+		F:       scalarsToWire(msg.F),
+		ZA:      scalarsToWire(msg.ZA),
+		ZB:      scalarsToWire(msg.ZB),
+		ZD:      msg.ZD.Bytes(),
+		Tag:     elliptic.MarshalCompressed(Curve(), msg.Tag[0], msg.Tag[1]),
+	}
+}
+
+func (msg CompactRingSignatureWire) toBase() CompactRingSignature {
+	ret := CompactRingSignature{
+		Message: msg.Message,
+		CL:      pointsFromWire(msg.CL),
+		CA:      pointsFromWire(msg.CA),
+		CB:      pointsFromWire(msg.CB),
+		CD:      pointsFromWire(msg.CD),
+		Q:       pointsFromWire(msg.Q),
+		F:       scalarsFromWire(msg.F),
+		ZA:      scalarsFromWire(msg.ZA),
+		ZB:      scalarsFromWire(msg.ZB),
+		ZD:      new(big.Int).SetBytes(msg.ZD),
+	}
+	ret.Tag[0], ret.Tag[1] = elliptic.UnmarshalCompressed(Curve(), msg.Tag)
+
+	return ret
+}
+
 type VoteKeyWire struct {
 	PublicKey PublicKeyWire
 	VoteKey   PublicKeyWire
+	Proof     *DLProofWire
+	Weight    int
+}
+
+func (msg VoteKeyWire) check() error {
+	if msg.Proof != nil {
+		return msg.Proof.check()
+	}
+
+	return nil
 }
 
 func (msg VoteKey) toWire() VoteKeyWire {
+	var p *DLProofWire = nil
+	if msg.Proof != nil {
+		wired := msg.Proof.toWire()
+		p = &wired
+	}
+
 	return VoteKeyWire{
-		VoteKey:   PublicKeyWireFromEcdsa(msg.tmpKey),
+		VoteKey: PublicKeyWireFromEcdsa(msg.tmpKey),
+		Proof:   p,
+		Weight:  msg.Weight,
 	}
 }
 
 func (msg VoteKeyWire) toBase() VoteKey {
+	var p *DLProof = nil
+	if msg.Proof != nil {
+		base := msg.Proof.toBase()
+		p = &base
+	}
+
 	return VoteKey{
-		tmpKey:    msg.VoteKey.toEcdsa(),
+		tmpKey: msg.VoteKey.toEcdsa(),
+		Proof:  p,
+		Weight: msg.Weight,
 	}
 }
 
@@ -532,3 +999,379 @@ func (msg VoteKeysWire) toBase() VoteKeys {
 		Keys: keys,
 	}
 }
+
+type DLProofWire struct {
+	C []byte
+	Z []byte
+}
+
+func (msg DLProofWire) check() error {
+	if len(msg.C) == 0 || len(msg.Z) == 0 {
+		return errors.New("DLProofWire: empty field")
+	}
+
+	return nil
+}
+
+func (msg DLProof) toWire() DLProofWire {
+	return DLProofWire{
+		C: msg.C.Bytes(),
+		Z: msg.Z.Bytes(),
+	}
+}
+
+func (msg DLProofWire) toBase() DLProof {
+	return DLProof{
+		C: new(big.Int).SetBytes(msg.C),
+		Z: new(big.Int).SetBytes(msg.Z),
+	}
+}
+
+func checkPoints(points ...[]byte) error {
+	for _, p := range points {
+		x, _ := elliptic.UnmarshalCompressed(Curve(), p)
+		if x == nil {
+			return errors.New("invalid point")
+		}
+	}
+
+	return nil
+}
+
+type ElGamalCiphertextWire struct {
+	A []byte
+	B []byte
+}
+
+func (msg ElGamalCiphertext) toWire() ElGamalCiphertextWire {
+	points := pointsToWire([][2]*big.Int{msg.A, msg.B})
+	return ElGamalCiphertextWire{
+		A: points[0],
+		B: points[1],
+	}
+}
+
+func (msg ElGamalCiphertextWire) toBase() ElGamalCiphertext {
+	points := pointsFromWire([][]byte{msg.A, msg.B})
+	return ElGamalCiphertext{
+		A: points[0],
+		B: points[1],
+	}
+}
+
+type BitProofWire struct {
+	C [][]byte
+	Z [][]byte
+}
+
+func (msg BitProof) toWire() BitProofWire {
+	return BitProofWire{
+		C: scalarsToWire(msg.C[:]),
+		Z: scalarsToWire(msg.Z[:]),
+	}
+}
+
+func (msg BitProofWire) toBase() BitProof {
+	var ret BitProof
+	copy(ret.C[:], scalarsFromWire(msg.C))
+	copy(ret.Z[:], scalarsFromWire(msg.Z))
+	return ret
+}
+
+type BallotWire struct {
+	Ciphertexts []ElGamalCiphertextWire
+	BitProofs   []BitProofWire
+	SumProof    DLProofWire
+}
+
+func (msg BallotWire) check() error {
+	if len(msg.Ciphertexts) != len(msg.BitProofs) {
+		return errors.New("BallotWire: not as much proofs as ciphertexts")
+	}
+
+	for _, ct := range msg.Ciphertexts {
+		if err := checkPoints(ct.A, ct.B); err != nil {
+			return errors.New("BallotWire: " + err.Error())
+		}
+	}
+
+	for _, p := range msg.BitProofs {
+		if len(p.C) != 2 || len(p.Z) != 2 {
+			return errors.New("BallotWire: invalid bit proof")
+		}
+	}
+
+	return msg.SumProof.check()
+}
+
+func (msg Ballot) toWire() BallotWire {
+	ret := BallotWire{
+		Ciphertexts: make([]ElGamalCiphertextWire, len(msg.Ciphertexts)),
+		BitProofs:   make([]BitProofWire, len(msg.BitProofs)),
+		SumProof:    msg.SumProof.toWire(),
+	}
+
+	for i, ct := range msg.Ciphertexts {
+		ret.Ciphertexts[i] = ct.toWire()
+	}
+
+	for i, p := range msg.BitProofs {
+		ret.BitProofs[i] = p.toWire()
+	}
+
+	return ret
+}
+
+func (msg BallotWire) toBase() Ballot {
+	ret := Ballot{
+		Ciphertexts: make([]ElGamalCiphertext, len(msg.Ciphertexts)),
+		BitProofs:   make([]BitProof, len(msg.BitProofs)),
+		SumProof:    msg.SumProof.toBase(),
+	}
+
+	for i, ct := range msg.Ciphertexts {
+		ret.Ciphertexts[i] = ct.toBase()
+	}
+
+	for i, p := range msg.BitProofs {
+		ret.BitProofs[i] = p.toBase()
+	}
+
+	return ret
+}
+
+type PartialDecryptionWire struct {
+	Trustee uint64
+	Ballots [][]byte
+	Factors [][]byte
+	Proofs  []DLProofWire
+}
+
+func (msg PartialDecryptionWire) check() error {
+	if len(msg.Factors) != len(msg.Proofs) {
+		return errors.New("PartialDecryptionWire: not as much proofs as factors")
+	}
+
+	for _, b := range msg.Ballots {
+		if len(b) != sha256.Size {
+			return errors.New("PartialDecryptionWire: invalid ballot digest")
+		}
+	}
+
+	if err := checkPoints(msg.Factors...); err != nil {
+		return errors.New("PartialDecryptionWire: " + err.Error())
+	}
+
+	for _, p := range msg.Proofs {
+		if err := p.check(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (msg PartialDecryption) toWire() PartialDecryptionWire {
+	ret := PartialDecryptionWire{
+		Trustee: uint64(msg.Trustee),
+		Ballots: make([][]byte, len(msg.Ballots)),
+		Factors: pointsToWire(msg.Factors),
+		Proofs:  make([]DLProofWire, len(msg.Proofs)),
+	}
+
+	for i, b := range msg.Ballots {
+		digest := b
+		ret.Ballots[i] = digest[:]
+	}
+
+	for i, p := range msg.Proofs {
+		ret.Proofs[i] = p.toWire()
+	}
+
+	return ret
+}
+
+func (msg PartialDecryptionWire) toBase() PartialDecryption {
+	ret := PartialDecryption{
+		Trustee: int(msg.Trustee),
+		Ballots: make([]BallotDigest, len(msg.Ballots)),
+		Factors: pointsFromWire(msg.Factors),
+		Proofs:  make([]DLProof, len(msg.Proofs)),
+	}
+
+	for i, b := range msg.Ballots {
+		copy(ret.Ballots[i][:], b)
+	}
+
+	for i, p := range msg.Proofs {
+		ret.Proofs[i] = p.toBase()
+	}
+
+	return ret
+}
+
+type DKGDealWire struct {
+	Dealer      uint64
+	Commitments [][]byte
+	Shares      [][]byte
+}
+
+func (msg DKGDealWire) check() error {
+	if err := checkPoints(msg.Commitments...); err != nil {
+		return errors.New("DKGDealWire: " + err.Error())
+	}
+
+	for _, s := range msg.Shares {
+		if len(s) != dkgShareSize {
+			return errors.New("DKGDealWire: invalid share size")
+		}
+	}
+
+	return nil
+}
+
+func (msg DKGDeal) toWire() DKGDealWire {
+	return DKGDealWire{
+		Dealer:      uint64(msg.Dealer),
+		Commitments: pointsToWire(msg.Commitments),
+		Shares:      msg.Shares,
+	}
+}
+
+func (msg DKGDealWire) toBase() DKGDeal {
+	return DKGDeal{
+		Dealer:      int(msg.Dealer),
+		Commitments: pointsFromWire(msg.Commitments),
+		Shares:      msg.Shares,
+	}
+}
+
+type DKGComplaintWire struct {
+	Dealer  uint64
+	Accuser uint64
+	Key     []byte
+	Proof   DLProofWire
+}
+
+func (msg DKGComplaintWire) check() error {
+	if err := checkPoints(msg.Key); err != nil {
+		return errors.New("DKGComplaintWire: " + err.Error())
+	}
+
+	return msg.Proof.check()
+}
+
+func (msg DKGComplaint) toWire() DKGComplaintWire {
+	return DKGComplaintWire{
+		Dealer:  uint64(msg.Dealer),
+		Accuser: uint64(msg.Accuser),
+		Key:     pointsToWire([][2]*big.Int{msg.Key})[0],
+		Proof:   msg.Proof.toWire(),
+	}
+}
+
+func (msg DKGComplaintWire) toBase() DKGComplaint {
+	return DKGComplaint{
+		Dealer:  int(msg.Dealer),
+		Accuser: int(msg.Accuser),
+		Key:     pointsFromWire([][]byte{msg.Key})[0],
+		Proof:   msg.Proof.toBase(),
+	}
+}
+
+type SaltEscrowWire struct {
+	Commitments [][]byte
+	Ephemeral   []byte
+	Shares      [][]byte
+}
+
+func (msg SaltEscrowWire) check() error {
+	if err := checkPoints(append([][]byte{msg.Ephemeral}, msg.Commitments...)...); err != nil {
+		return errors.New("SaltEscrowWire: " + err.Error())
+	}
+
+	for _, s := range msg.Shares {
+		if len(s) != escrowShareSize {
+			return errors.New("SaltEscrowWire: invalid share size")
+		}
+	}
+
+	return nil
+}
+
+func (msg SaltEscrow) toWire() SaltEscrowWire {
+	return SaltEscrowWire{
+		Commitments: pointsToWire(msg.Commitments),
+		Ephemeral:   pointsToWire([][2]*big.Int{msg.Ephemeral})[0],
+		Shares:      msg.Shares,
+	}
+}
+
+func (msg SaltEscrowWire) toBase() SaltEscrow {
+	return SaltEscrow{
+		Commitments: pointsFromWire(msg.Commitments),
+		Ephemeral:   pointsFromWire([][]byte{msg.Ephemeral})[0],
+		Shares:      msg.Shares,
+	}
+}
+
+type EscrowShareWire struct {
+	Commitment []byte
+	Trustee    uint64
+	Option     []byte
+	Salt       []byte
+}
+
+func (msg EscrowShareWire) check() error {
+	if len(msg.Commitment) != sha256.Size {
+		return errors.New("EscrowShareWire: invalid commitment digest")
+	}
+
+	return nil
+}
+
+func (msg EscrowShare) toWire() EscrowShareWire {
+	return EscrowShareWire{
+		Commitment: msg.Commitment[:],
+		Trustee:    uint64(msg.Trustee),
+		Option:     msg.Option.Bytes(),
+		Salt:       msg.Salt.Bytes(),
+	}
+}
+
+func (msg EscrowShareWire) toBase() EscrowShare {
+	ret := EscrowShare{
+		Trustee: int(msg.Trustee),
+		Option:  new(big.Int).SetBytes(msg.Option),
+		Salt:    new(big.Int).SetBytes(msg.Salt),
+	}
+	copy(ret.Commitment[:], msg.Commitment)
+	return ret
+}
+
+type PollEquivocationWire struct {
+	Bodies     []Poll
+	Signatures []EllipticCurveSignatureWire
+}
+
+func (msg PollEquivocationWire) check() error {
+	if len(msg.Bodies) != 2 || len(msg.Signatures) != 2 {
+		return errors.New("PollEquivocationWire: expected two signed bodies")
+	}
+
+	return nil
+}
+
+func (msg PollEquivocation) toWire() PollEquivocationWire {
+	return PollEquivocationWire{
+		Bodies:     msg.Bodies[:],
+		Signatures: []EllipticCurveSignatureWire{msg.Signatures[0].toWire(), msg.Signatures[1].toWire()},
+	}
+}
+
+func (msg PollEquivocationWire) toBase() PollEquivocation {
+	return PollEquivocation{
+		Bodies:     [2]Poll{msg.Bodies[0], msg.Bodies[1]},
+		Signatures: [2]EllipticCurveSignature{msg.Signatures[0].toBase(), msg.Signatures[1].toBase()},
+	}
+}
@@ -5,9 +5,14 @@ import (
 	secrand "crypto/rand" // alias needed as we import two libraries with name "rand"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"log"
+	"math"
 	"math/rand"
 	"net"
+	"sort"
+	"sync"
+	"time"
 )
 
 // Reputation Opinions ---------------------------------------------------------------------------
@@ -15,7 +20,6 @@ import (
 type RepOpinions map[string]int
 
 func (opinions RepOpinions) Suspect(peer string) {
-	// also add peer to blacklist
 	opinions[peer] = -1
 }
 
@@ -42,82 +46,367 @@ func (opinions RepOpinions) completePeers(peers map[string]bool) {
 	}
 }
 
-// Blacklist -------------------------------------------------------------------------------------
+// Graded Reputation -----------------------------------------------------------------------------
 
-type Blacklist map[string]bool
+type Offence uint32
 
-func (bList Blacklist) IsBlacklisted(peer string) bool {
-	return bList[peer]
+const (
+	OffenceInvalidSignature Offence = iota
+	OffenceInvalidMessage           // ill-formed registry, vote, ballot or DKG message
+	OffenceDoubleVote
+	OffenceFalseEvidence    // invalid equivocation or misbehaviour evidence
+	OffenceEarlyVote        // opened before every commitment, might be a slow network
+	OffenceSuspectedByPeers // per peer suspecting more than trusting
+	OffenceInvalidReveal    // vote not opening its commitment
+)
+
+// how much the score drops for each offence
+var OffencePenalties = map[Offence]float64{
+	OffenceInvalidSignature: 20,
+	OffenceInvalidMessage:   15,
+	OffenceDoubleVote:       40,
+	OffenceFalseEvidence:    40,
+	OffenceEarlyVote:        5,
+	OffenceSuspectedByPeers: 30,
+	OffenceInvalidReveal:    15,
+}
+
+func (o Offence) String() string {
+	switch o {
+	case OffenceInvalidSignature:
+		return "invalid signature"
+	case OffenceInvalidMessage:
+		return "invalid message"
+	case OffenceDoubleVote:
+		return "double vote"
+	case OffenceFalseEvidence:
+		return "false evidence"
+	case OffenceEarlyVote:
+		return "early vote"
+	case OffenceSuspectedByPeers:
+		return "suspected by peers"
+	case OffenceInvalidReveal:
+		return "invalid reveal"
+	}
+	return "unknown offence"
+}
+
+// what is done with the traffic of a peer, from the mildest
+type Response int
+
+const (
+	ResponseNone       Response = iota
+	ResponseRateLimit           // a few packets per second are handled
+	ResponseQuarantine          // only its status packets are handled, rate limited
+	ResponseBan                 // everything is dropped until the ban expires
+)
+
+func (r Response) String() string {
+	return [...]string{"none", "rate limit", "quarantine", "ban"}[r]
 }
 
-func (bList Blacklist) add(peer string) {
-	bList[peer] = true
+type ReputationConfig struct {
+	HalfLife        time.Duration // for a score to go halfway back to zero, never if zero
+	BanDuration     time.Duration // bans never expire if zero
+	RateLimitBelow  float64
+	QuarantineBelow float64
+	BanBelow        float64
+	RateLimit       int           // packets per second of a rate limited or quarantined peer
+	PreTrusted      []string      // addresses whose opinions are trusted first, like ours
+	RoundTimeout    time.Duration // to wait for the opinions of every participant
 }
 
-func (bList Blacklist) Update(repTable map[string]int) {
-	for peer, rep := range repTable {
-		if rep < 0 {
-			bList.add(peer)
+func DefaultReputationConfig() ReputationConfig {
+	return ReputationConfig{
+		HalfLife:        time.Hour,
+		BanDuration:     time.Hour,
+		RateLimitBelow:  -10,
+		QuarantineBelow: -30,
+		BanBelow:        -60,
+		RateLimit:       20,
+		RoundTimeout:    30 * time.Second,
+	}
+}
+
+const MaxOffenceRecords = 8
+
+// why the score of a peer dropped, the poll is empty if the offence wasn't
+// about a poll
+type OffenceRecord struct {
+	Offence string
+	Poll    string `json:",omitempty"`
+	Time    time.Time
+}
+
+func newOffenceRecord(offence Offence, poll *PollKey, now time.Time) OffenceRecord {
+	record := OffenceRecord{Offence: offence.String(), Time: now}
+	if poll != nil && poll.Origin.X != nil {
+		record.Poll = poll.String()
+	}
+
+	return record
+}
+
+// scores are negative, zero is a peer never caught
+type PeerScore struct {
+	Score    float64
+	Updated  time.Time
+	Offences int
+	Reasons  []OffenceRecord // the last ones
+}
+
+func (s PeerScore) at(now time.Time, halfLife time.Duration) float64 {
+	elapsed := now.Sub(s.Updated)
+	if halfLife <= 0 || elapsed <= 0 {
+		return s.Score
+	}
+
+	return s.Score * math.Exp2(-float64(elapsed)/float64(halfLife))
+}
+
+// a ban and the offences which led to it, the zero time for a ban never
+// expiring
+type BanEntry struct {
+	Until   time.Time
+	Reasons []OffenceRecord
+	Polls   []string // the offences were seen in
+}
+
+func newBanEntry(until time.Time, reasons []OffenceRecord) BanEntry {
+	entry := BanEntry{Until: until, Reasons: reasons}
+
+	seen := make(map[string]bool)
+	for _, reason := range reasons {
+		if reason.Poll != "" && !seen[reason.Poll] {
+			seen[reason.Poll] = true
+			entry.Polls = append(entry.Polls, reason.Poll)
 		}
 	}
+
+	return entry
+}
+
+func (entry BanEntry) active(now time.Time) bool {
+	return entry.Until.IsZero() || now.Before(entry.Until)
+}
+
+type Blacklist map[string]BanEntry
+
+func (bList Blacklist) IsBlacklisted(peer string, now time.Time) bool {
+	entry, ok := bList[peer]
+	return ok && entry.active(now)
+}
+
+func (bList Blacklist) add(peer string, entry BanEntry) {
+	bList[peer] = entry
 }
 
 func (bList Blacklist) String() string {
-	str := "Peer\t\tBlacklisted?\n"
-	for peer, status := range bList {
+	str := "Peer\t\tBanned until\t\tReasons\n"
+	for peer, entry := range bList {
 		str += peer + "\t\t"
-		if status {
-			str += "yes\n"
+		if entry.Until.IsZero() {
+			str += "forever"
 		} else {
-			str += "no\n"
+			str += entry.Until.Format(time.RFC3339)
 		}
+
+		str += "\t\t"
+		for i, reason := range entry.Reasons {
+			if i > 0 {
+				str += ", "
+			}
+			str += reason.Offence
+		}
+		str += "\n"
 	}
 
 	return str
 }
 
+// set by the admin, kept apart from what we and the others observe
+type Override int
+
+const (
+	OverrideNone    Override = iota
+	OverrideTrust            // never penalized, its opinions trusted like the pre-trusted peers
+	OverrideSuspect          // quarantined at least and suspected in our opinions
+	OverridePin              // never penalized nor banned, but we don't vouch for it
+)
+
+func (o Override) String() string {
+	return [...]string{"none", "trust", "suspect", "pin"}[o]
+}
+
+func OverrideFromString(name string) (Override, error) {
+	switch name {
+	case "trust":
+		return OverrideTrust, nil
+	case "suspect":
+		return OverrideSuspect, nil
+	case "pin":
+		return OverridePin, nil
+	}
+
+	return OverrideNone, errors.New("unknown override \"" + name + "\"")
+}
+
+type rateWindow struct {
+	Start time.Time
+	Count int
+}
+
 // Reputation Info -------------------------------------------------------------------------------
 
+// the opinions of a poll are aggregated once, when every participant sent
+// its own or at the timeout with the ones which arrived
+type reputationRound struct {
+	expected   int
+	aggregated bool
+	done       chan bool // closed once aggregated
+}
+
+// shared by the dispatchers, the poll handlers and the API. Exported
+// methods lock, unexported ones expect the lock to be held. The config is
+// only set before the gossiper starts.
 type ReputationInfo struct {
-	Opinions      RepOpinions
+	sync.RWMutex
+	Opinions      RepOpinions // peers we caught ourselves
+	Scores        map[string]PeerScore
 	Blacklist     Blacklist
-	PeersOpinions map[PollKey]map[ecdsa.PublicKey]RepOpinions
-	AddTablesWait map[PollKey]chan bool
+	Config        ReputationConfig
+	rates         map[string]rateWindow
+	PeersOpinions map[PollKeyMap]map[string]RepOpinions // by signer
+	Addresses     map[string]string                     // key bound to each signer address
+	rounds        map[PollKeyMap]*reputationRound
+	Equivocators  map[PublicKeyMap]bool // poll origins which signed conflicting bodies
+	Evidence      map[PacketDigest]bool // already counted
+	Overrides     map[string]Override
 }
 
-func NewReputationInfo() ReputationInfo {
-	return ReputationInfo{
+func NewReputationInfo() *ReputationInfo {
+	return &ReputationInfo{
 		Opinions:      make(RepOpinions),
+		Scores:        make(map[string]PeerScore),
 		Blacklist:     make(Blacklist),
-		PeersOpinions: make(map[PollKey]map[ecdsa.PublicKey]RepOpinions),
-		AddTablesWait: make(map[PollKey]chan bool),
+		Config:        DefaultReputationConfig(),
+		rates:         make(map[string]rateWindow),
+		PeersOpinions: make(map[PollKeyMap]map[string]RepOpinions),
+		Addresses:     make(map[string]string),
+		rounds:        make(map[PollKeyMap]*reputationRound),
+		Equivocators:  make(map[PublicKeyMap]bool),
+		Evidence:      make(map[PacketDigest]bool),
+		Overrides:     make(map[string]Override),
+	}
+}
+
+// opinions are known by the address of their signer once it proved it gets
+// the packets sent there, the address in the packet could be anyone's.
+// Signers without a bound address are known by their key, they can't be
+// suspected.
+func (repInfo *ReputationInfo) signerOf(pkg *ReputationPacket) string {
+	key := signerKey(pkg.Signer)
+	if pkg.Address == "" || repInfo.Addresses[pkg.Address] != key {
+		return key
 	}
+
+	return pkg.Address
+}
+
+func signerKey(signer ecdsa.PublicKey) string {
+	return "key:" + signer.X.String() + "," + signer.Y.String()
+}
+
+// binds the address to signer, only called for a valid key whose signed
+// status came back with the cookie we sent to the address. The key getting
+// the packets sent there now replaces the previous one.
+func (repInfo *ReputationInfo) BindAddress(address string, signer ecdsa.PublicKey) {
+	repInfo.Lock()
+	defer repInfo.Unlock()
+
+	repInfo.Addresses[address] = signerKey(signer)
 }
 
-func (repInfo ReputationInfo) AddPeerOpinion(pkg *ReputationPacket, pollID PollKey) {
-	//repInfo.PeersOpinions[pollID] = append(repInfo.PeersOpinions[pollID], opinion)
-	if repInfo.PeersOpinions[pollID] == nil {
-		repInfo.PeersOpinions[pollID] = make(map[ecdsa.PublicKey]RepOpinions)
+// the round of the poll ends once every participant sent its opinions
+func (repInfo *ReputationInfo) AddPeerOpinion(pkg *ReputationPacket, pollID PollKey) {
+	repInfo.Lock()
+	defer repInfo.Unlock()
+
+	key := pollID.Pack()
+	if repInfo.PeersOpinions[key] == nil {
+		repInfo.PeersOpinions[key] = make(map[string]RepOpinions)
 	}
 
-	opinion := pkg.Opinions
-	signer := pkg.Signer
+	repInfo.PeersOpinions[key][repInfo.signerOf(pkg)] = pkg.Opinions
+	repInfo.completeRound(pollID, time.Now())
+}
+
+func (repInfo *ReputationInfo) AddReputations(pollID PollKey) {
+	repInfo.Lock()
+	defer repInfo.Unlock()
 
-	repInfo.PeersOpinions[pollID][signer] = opinion
+	repInfo.addReputations(pollID, time.Now())
 }
 
-func (repInfo ReputationInfo) AddReputations(pollID PollKey) {
+// the round of the poll, closed once its opinions are aggregated. The
+// opinions which arrived before are counted.
+func (repInfo *ReputationInfo) StartRound(pollID PollKey, expected int) <-chan bool {
+	repInfo.Lock()
+	defer repInfo.Unlock()
+
+	key := pollID.Pack()
+	round, ok := repInfo.rounds[key]
+	if !ok {
+		round = &reputationRound{expected: expected, done: make(chan bool)}
+		repInfo.rounds[key] = round
+	}
+
+	repInfo.completeRound(pollID, time.Now())
+	return round.done
+}
+
+// aggregates the opinions which arrived, if not done yet
+func (repInfo *ReputationInfo) FinalizeRound(pollID PollKey) {
+	repInfo.Lock()
+	defer repInfo.Unlock()
+
+	repInfo.finalizeRound(pollID, time.Now())
+}
+
+func (repInfo *ReputationInfo) completeRound(pollID PollKey, now time.Time) {
+	round, ok := repInfo.rounds[pollID.Pack()]
+	if ok && len(repInfo.PeersOpinions[pollID.Pack()]) >= round.expected {
+		repInfo.finalizeRound(pollID, now)
+	}
+}
+
+func (repInfo *ReputationInfo) finalizeRound(pollID PollKey, now time.Time) {
+	round, ok := repInfo.rounds[pollID.Pack()]
+	if !ok || round.aggregated {
+		return
+	}
+
+	repInfo.addReputations(pollID, now)
+	round.aggregated = true
+	close(round.done)
+}
+
+// opinions are weighted by the trust of their signer, so colluding peers
+// without the trust of the pre-trusted ones can't outvote the others. The
+// pre-trusted peers themselves are never penalized. Opinions can't be
+// verified, they can't lead to a ban, only evidence can.
+func (repInfo *ReputationInfo) addReputations(pollID PollKey, now time.Time) {
 
-	repTable := make(map[string]int)
 	peers := make(map[string]bool)
+	opinions := make(map[string]RepOpinions)
 
-	for _, peerOpinions := range repInfo.PeersOpinions[pollID] {
+	for _, peerOpinions := range repInfo.PeersOpinions[pollID.Pack()] {
 		for peer := range peerOpinions {
 			peers[peer] = true
 		}
 	}
 
-	for _, peerOpinions := range repInfo.PeersOpinions[pollID] {
+	for signer, peerOpinions := range repInfo.PeersOpinions[pollID.Pack()] {
 
 		// If a peer has an invalid opinion of another peer
 		// none of its opinions will be taken into account
@@ -126,13 +415,31 @@ func (repInfo ReputationInfo) AddReputations(pollID PollKey) {
 		}
 
 		peerOpinions.completePeers(peers)
+		opinions[signer] = peerOpinions
+	}
 
-		for peer, rep := range peerOpinions {
-			tempUpdateRep(peer, rep, repTable)
+	trust := EigenTrust(opinions, repInfo.preTrusted())
+
+	// the penalty grows with the number of peers having an opinion
+	counts := make(map[string]int)
+	for signer, peerOpinions := range opinions {
+		for peer := range peerOpinions {
+			if peer != signer {
+				tempUpdateRep(peer, 1, counts)
+			}
 		}
 	}
 
-	repInfo.Blacklist.Update(repTable)
+	for _, peer := range repInfo.preTrusted() {
+		delete(counts, peer)
+	}
+
+	for peer, count := range counts {
+		if opinion := weightedOpinion(opinions, trust, peer); opinion < 0 {
+			repInfo.suspect(peer, -opinion*float64(count)*OffencePenalties[OffenceSuspectedByPeers],
+				newOffenceRecord(OffenceSuspectedByPeers, &pollID, now))
+		}
+	}
 }
 
 func tempUpdateRep(peer string, rep int, repTable map[string]int) {
@@ -145,13 +452,361 @@ func tempUpdateRep(peer string, rep int, repTable map[string]int) {
 	repTable[peer] += rep
 }
 
-func (repInfo ReputationInfo) IsBlacklisted(peer string) bool {
-	return repInfo.Blacklist.IsBlacklisted(peer)
+// the pre-trusted peers, and the ones the admin trusts
+func (repInfo *ReputationInfo) preTrusted() []string {
+	ret := append([]string{}, repInfo.Config.PreTrusted...)
+	for peer, override := range repInfo.Overrides {
+		if override == OverrideTrust {
+			ret = append(ret, peer)
+		}
+	}
+
+	return ret
+}
+
+func (repInfo *ReputationInfo) penalize(peer string, penalty float64, reason OffenceRecord) {
+	if o := repInfo.Overrides[peer]; o == OverrideTrust || o == OverridePin {
+		log.Printf("%s by %s, not penalized as %s", reason.Offence, peer, o)
+		return
+	}
+
+	now := reason.Time
+	score := repInfo.Scores[peer]
+	score.Score = score.at(now, repInfo.Config.HalfLife) - penalty
+	score.Updated = now
+	score.Offences++
+	score.Reasons = append(score.Reasons, reason)
+	if len(score.Reasons) > MaxOffenceRecords {
+		score.Reasons = score.Reasons[len(score.Reasons)-MaxOffenceRecords:]
+	}
+	repInfo.Scores[peer] = score
+
+	if score.Score <= repInfo.Config.BanBelow && !repInfo.Blacklist.IsBlacklisted(peer, now) {
+		until := time.Time{}
+		if repInfo.Config.BanDuration > 0 {
+			until = now.Add(repInfo.Config.BanDuration)
+		}
+		repInfo.Blacklist.add(peer, newBanEntry(until, score.Reasons))
+		log.Printf("ban %s, score %.1f", peer, score.Score)
+	}
+}
+
+// down to half way into a quarantine at worst, never to a ban
+func (repInfo *ReputationInfo) suspect(peer string, penalty float64, reason OffenceRecord) {
+	score := repInfo.score(peer, reason.Time)
+	if floor := (repInfo.Config.QuarantineBelow + repInfo.Config.BanBelow) / 2; score-penalty < floor {
+		penalty = math.Max(score-floor, 0)
+	}
+
+	repInfo.penalize(peer, penalty, reason)
+}
+
+// the offence is proven by evidence, it isn't ours to tell
+func (repInfo *ReputationInfo) Penalize(peer string, offence Offence, poll *PollKey) {
+	repInfo.Lock()
+	defer repInfo.Unlock()
+
+	repInfo.penalize(peer, OffencePenalties[offence], newOffenceRecord(offence, poll, time.Now()))
 }
 
-func (repInfo ReputationInfo) Suspect(peer string) {
+// false if it was already counted
+func (repInfo *ReputationInfo) AddEvidence(digest PacketDigest) bool {
+	repInfo.Lock()
+	defer repInfo.Unlock()
+
+	if repInfo.Evidence[digest] {
+		return false
+	}
+
+	repInfo.Evidence[digest] = true
+	return true
+}
+
+func (repInfo *ReputationInfo) HasEvidence(digest PacketDigest) bool {
+	repInfo.RLock()
+	defer repInfo.RUnlock()
+
+	return repInfo.Evidence[digest]
+}
+
+// the score of the peer, back towards zero since its last offence
+func (repInfo *ReputationInfo) Score(peer string, now time.Time) float64 {
+	repInfo.RLock()
+	defer repInfo.RUnlock()
+
+	return repInfo.score(peer, now)
+}
+
+func (repInfo *ReputationInfo) score(peer string, now time.Time) float64 {
+	return repInfo.Scores[peer].at(now, repInfo.Config.HalfLife)
+}
+
+func (repInfo *ReputationInfo) Response(peer string, now time.Time) Response {
+	repInfo.RLock()
+	defer repInfo.RUnlock()
+
+	return repInfo.response(peer, now)
+}
+
+// once a ban expires, the peer stays in quarantine until its score recovers
+func (repInfo *ReputationInfo) response(peer string, now time.Time) Response {
+	score := repInfo.score(peer, now)
+
+	switch repInfo.Overrides[peer] {
+	case OverrideTrust, OverridePin:
+		return ResponseNone
+	case OverrideSuspect:
+		if !repInfo.Blacklist.IsBlacklisted(peer, now) {
+			return ResponseQuarantine
+		}
+	}
+
+	switch {
+	case repInfo.Blacklist.IsBlacklisted(peer, now):
+		return ResponseBan
+	case score <= repInfo.Config.QuarantineBelow:
+		return ResponseQuarantine
+	case score <= repInfo.Config.RateLimitBelow:
+		return ResponseRateLimit
+	}
+
+	return ResponseNone
+}
+
+// whether a packet of the peer is handled, statusOnly if it only carries a
+// status
+func (repInfo *ReputationInfo) Allow(peer string, statusOnly bool, now time.Time) bool {
+	repInfo.Lock()
+	defer repInfo.Unlock()
+
+	switch repInfo.response(peer, now) {
+	case ResponseBan:
+		return false
+	case ResponseQuarantine:
+		if !statusOnly {
+			return false
+		}
+	case ResponseNone:
+		return true
+	}
+
+	window := repInfo.rates[peer]
+	if now.Sub(window.Start) >= time.Second {
+		window = rateWindow{Start: now}
+	}
+	window.Count++
+	repInfo.rates[peer] = window
+
+	return window.Count <= repInfo.Config.RateLimit
+}
+
+func (repInfo *ReputationInfo) IsBlacklisted(peer string) bool {
+	repInfo.RLock()
+	defer repInfo.RUnlock()
+
+	return repInfo.Blacklist.IsBlacklisted(peer, time.Now())
+}
+
+// ours, 0 if we have none
+func (repInfo *ReputationInfo) Opinion(peer string) int {
+	repInfo.RLock()
+	defer repInfo.RUnlock()
+
+	return repInfo.Opinions[peer]
+}
+
+// the offence is ours to tell the other peers, poll is nil if it wasn't
+// about a poll
+func (repInfo *ReputationInfo) Offend(peer string, offence Offence, poll *PollKey) {
+	repInfo.Lock()
+	defer repInfo.Unlock()
+
+	repInfo.offend(peer, offence, poll, time.Now())
+}
+
+func (repInfo *ReputationInfo) offend(peer string, offence Offence, poll *PollKey, now time.Time) {
+	log.Printf("%s by %s", offence, peer)
 	repInfo.Opinions.Suspect(peer)
-	repInfo.Blacklist.add(peer)
+	repInfo.penalize(peer, OffencePenalties[offence], newOffenceRecord(offence, poll, now))
+}
+
+func (repInfo *ReputationInfo) CurrentOpinions() RepOpinions {
+	repInfo.RLock()
+	defer repInfo.RUnlock()
+
+	return repInfo.currentOpinions(time.Now())
+}
+
+// we still suspect the peers we caught until their score recovers, so a
+// false accusation doesn't last forever. The admin has the last word.
+func (repInfo *ReputationInfo) currentOpinions(now time.Time) RepOpinions {
+	ret := make(RepOpinions)
+	for peer := range repInfo.Opinions {
+		if repInfo.response(peer, now) == ResponseNone {
+			ret.Trust(peer)
+		} else {
+			ret.Suspect(peer)
+		}
+	}
+
+	for peer, override := range repInfo.Overrides {
+		switch override {
+		case OverrideTrust:
+			ret[peer] = 1
+		case OverrideSuspect:
+			ret[peer] = -1
+		}
+	}
+
+	return ret
+}
+
+// Admin -----------------------------------------------------------------------------------------
+
+// trusting or pinning a peer lifts its ban and forgets its offences
+func (repInfo *ReputationInfo) SetOverride(peer string, override Override) {
+	repInfo.Lock()
+	defer repInfo.Unlock()
+
+	if override == OverrideNone {
+		delete(repInfo.Overrides, peer)
+		return
+	}
+
+	repInfo.Overrides[peer] = override
+	if override != OverrideSuspect {
+		repInfo.unban(peer)
+	}
+}
+
+// false if the peer was neither banned nor penalized
+func (repInfo *ReputationInfo) Unban(peer string) bool {
+	repInfo.Lock()
+	defer repInfo.Unlock()
+
+	return repInfo.unban(peer)
+}
+
+func (repInfo *ReputationInfo) unban(peer string) bool {
+	_, banned := repInfo.Blacklist[peer]
+	_, scored := repInfo.Scores[peer]
+
+	delete(repInfo.Blacklist, peer)
+	delete(repInfo.Scores, peer)
+	if repInfo.Overrides[peer] == OverrideSuspect {
+		delete(repInfo.Overrides, peer)
+	}
+
+	return banned || scored
+}
+
+// what we know of a peer
+type PeerReputation struct {
+	Peer     string
+	Score    float64
+	Response string
+	Offences int
+	Reasons  []OffenceRecord `json:",omitempty"`
+	Opinion  int             `json:",omitempty"` // ours, as we gossip it
+	Override string          `json:",omitempty"`
+}
+
+// every peer we have a score, an opinion or an override for, the worst first
+func (repInfo *ReputationInfo) Peers(now time.Time) []PeerReputation {
+	repInfo.RLock()
+	defer repInfo.RUnlock()
+
+	opinions := repInfo.currentOpinions(now)
+
+	peers := make(map[string]bool)
+	for peer := range repInfo.Scores {
+		peers[peer] = true
+	}
+	for peer := range repInfo.Blacklist {
+		peers[peer] = true
+	}
+	for peer := range opinions {
+		peers[peer] = true
+	}
+	for peer := range repInfo.Overrides {
+		peers[peer] = true
+	}
+
+	ret := make([]PeerReputation, 0, len(peers))
+	for peer := range peers {
+		score := repInfo.Scores[peer]
+		rep := PeerReputation{
+			Peer:     peer,
+			Score:    score.at(now, repInfo.Config.HalfLife),
+			Response: repInfo.response(peer, now).String(),
+			Offences: score.Offences,
+			Reasons:  append([]OffenceRecord{}, score.Reasons...),
+			Opinion:  opinions[peer],
+		}
+		if o := repInfo.Overrides[peer]; o != OverrideNone {
+			rep.Override = o.String()
+		}
+		ret = append(ret, rep)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Score != ret[j].Score {
+			return ret[i].Score < ret[j].Score
+		}
+		return ret[i].Peer < ret[j].Peer
+	})
+
+	return ret
+}
+
+// the opinions gossiped by the signers, by poll
+func (repInfo *ReputationInfo) PollOpinions() map[string]map[string]RepOpinions {
+	repInfo.RLock()
+	defer repInfo.RUnlock()
+
+	ret := make(map[string]map[string]RepOpinions)
+	for id, signers := range repInfo.PeersOpinions {
+		copied := make(map[string]RepOpinions)
+		for signer, opinions := range signers {
+			copied[signer] = make(RepOpinions)
+			for peer, opinion := range opinions {
+				copied[signer][peer] = opinion
+			}
+		}
+		ret[id.Unpack().String()] = copied
+	}
+
+	return ret
+}
+
+// the bans still running, or all of them
+func (repInfo *ReputationInfo) Bans(all bool, now time.Time) Blacklist {
+	repInfo.RLock()
+	defer repInfo.RUnlock()
+
+	ret := make(Blacklist)
+	for peer, entry := range repInfo.Blacklist {
+		if all || entry.active(now) {
+			ret[peer] = entry
+		}
+	}
+
+	return ret
+}
+
+// origins are known by their key, their polls are refused from now on
+func (repInfo *ReputationInfo) SuspectOrigin(origin ecdsa.PublicKey) {
+	repInfo.Lock()
+	defer repInfo.Unlock()
+
+	repInfo.Equivocators[PublicKeyMapFromEcdsa(origin)] = true
+}
+
+func (repInfo *ReputationInfo) IsEquivocator(origin ecdsa.PublicKey) bool {
+	repInfo.RLock()
+	defer repInfo.RUnlock()
+
+	return repInfo.Equivocators[PublicKeyMapFromEcdsa(origin)]
 }
 
 // Reputation Packet -----------------------------------------------------------------------------
@@ -160,13 +815,22 @@ type ReputationPacket struct {
 	Signer   ecdsa.PublicKey
 	Opinions RepOpinions
 	PollID   PollKey
+	Address  string `json:",omitempty"` // where the signer is reached, as in the opinions
 }
 
+// our opinions go out, the ones of the others are aggregated once they all
+// arrived or at the timeout, without the ones which never did
 func UpdateReputations(g *Gossiper, pollID PollKey) {
+	done := g.Reputations.StartRound(pollID, len(g.Polls.Get(pollID).Participants))
 
 	g.SendReputation(pollID, nil)
 
-	<-g.Reputations.AddTablesWait[pollID]
+	select {
+	case <-done:
+	case <-time.After(g.Reputations.Config.RoundTimeout):
+		log.Println("missing reputation opinions, aggregate the ones received")
+		g.Reputations.FinalizeRound(pollID)
+	}
 }
 
 func (g *Gossiper) SendReputationPacket(msg *ReputationPacket, sig *Signature, fromPeer *net.UDPAddr) {
@@ -188,9 +852,13 @@ func (g *Gossiper) SendReputationPacket(msg *ReputationPacket, sig *Signature, f
 func (g *Gossiper) SendReputation(key PollKey, fromPeer *net.UDPAddr) {
 	pkg := ReputationPacket{
 		PollID:   key,
-		Opinions: g.Reputations.Opinions,
+		Opinions: g.Reputations.CurrentOpinions(),
 		Signer:   g.KeyPair.PublicKey,
 	}
+	if g.Server.Addr != nil {
+		pkg.Address = g.Server.Addr.String()
+	}
+	g.Reputations.AddPeerOpinion(&pkg, key)
 
 	sig, err := repSignature(g, pkg)
 	if err != nil {
@@ -214,7 +882,7 @@ func repSignature(g *Gossiper, rep ReputationPacket) (Signature, error) {
 		log.Printf("error generating elliptic curve signature")
 		return Signature{}, err
 	}
-	return Signature{nil, &EllipticCurveSignature{*r, *s}}, nil
+	return Signature{Elliptic: &EllipticCurveSignature{*r, *s}}, nil
 }
 
 func repSignatureValid(g *Gossiper, pkg GossipPacket) bool {
@@ -245,6 +913,7 @@ type ReputationPacketWire struct {
 	Opinions RepOpinions
 	PollID   PollKeyWire
 	Signer   PublicKeyWire
+	Address  string
 }
 
 func (msg ReputationPacket) ToWire() ReputationPacketWire {
@@ -252,6 +921,7 @@ func (msg ReputationPacket) ToWire() ReputationPacketWire {
 		PollID:   msg.PollID.toWire(),
 		Opinions: msg.Opinions,
 		Signer:   PublicKeyWireFromEcdsa(msg.Signer),
+		Address:  msg.Address,
 	}
 }
 
@@ -260,5 +930,6 @@ func (msg ReputationPacketWire) ToBase() ReputationPacket {
 		PollID:   msg.PollID.toBase(),
 		Opinions: msg.Opinions,
 		Signer:   msg.Signer.toEcdsa(),
+		Address:  msg.Address,
 	}
 }
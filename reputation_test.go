@@ -4,7 +4,10 @@ import (
 	"crypto/ecdsa"
 	"fmt"
 	"math/big"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
 /*func TestMain(m *testing.M) {
@@ -18,17 +21,23 @@ func TestBlacklist(t *testing.T) {
 	bl := make(Blacklist)
 	peerA := "peerA"
 	peerB := "peerB"
+	peerC := "peerC"
+	now := time.Now()
 
-	bl.add(peerA)
+	bl.add(peerA, BanEntry{})
+	bl.add(peerC, BanEntry{Until: now.Add(time.Hour)})
 
-	if !bl.IsBlacklisted(peerA) {
+	if !bl.IsBlacklisted(peerA, now) || !bl.IsBlacklisted(peerA, now.Add(24*365*time.Hour)) {
 		t.Error("Didn't blacklist peer but should have")
 	}
 
-	if bl.IsBlacklisted(peerB) {
+	if bl.IsBlacklisted(peerB, now) {
 		t.Error("Blacklisted peer but shouldn't have")
 	}
 
+	if !bl.IsBlacklisted(peerC, now) || bl.IsBlacklisted(peerC, now.Add(time.Hour)) {
+		t.Error("Ban didn't expire")
+	}
 }
 
 func TestTempUpdate(t *testing.T) {
@@ -92,16 +101,274 @@ func TestReputationInfo_AddReputations(t *testing.T) {
 	repInfo.AddPeerOpinion(pkgA, pollKey)
 	repInfo.AddPeerOpinion(pkgB, pollKey)
 
-	if len(repInfo.PeersOpinions[pollKey]) != 2 {
+	if len(repInfo.PeersOpinions[pollKey.Pack()]) != 2 {
 		t.Error()
 	}
 
 	repInfo.AddReputations(pollKey)
 
-	if repInfo.IsBlacklisted(peerA) || !repInfo.IsBlacklisted(peerB) || repInfo.IsBlacklisted(peerC) {
+	// opinions alone can't ban
+	now := time.Now()
+	if repInfo.Response(peerA, now) != ResponseNone || repInfo.Response(peerB, now) != ResponseQuarantine ||
+		repInfo.Response(peerC, now) != ResponseNone || repInfo.IsBlacklisted(peerB) {
 		t.Error()
 	}
 
 	fmt.Println(repInfo.Blacklist)
 
 }
+
+func TestGradedResponses(t *testing.T) {
+	repInfo := NewReputationInfo()
+	peer := "peerA"
+	now := time.Now()
+
+	repInfo.offend(peer, OffenceEarlyVote, nil, now)
+	if repInfo.Response(peer, now) != ResponseNone {
+		t.Errorf("Slow peer punished")
+	}
+
+	repInfo.offend(peer, OffenceInvalidSignature, nil, now)
+	if repInfo.Response(peer, now) != ResponseRateLimit {
+		t.Errorf("Expected a rate limit, got %s", repInfo.Response(peer, now))
+	}
+
+	allowed := 0
+	for i := 0; i < 2*repInfo.Config.RateLimit; i++ {
+		if repInfo.Allow(peer, false, now) {
+			allowed++
+		}
+	}
+	if allowed != repInfo.Config.RateLimit || !repInfo.Allow(peer, false, now.Add(time.Second)) {
+		t.Errorf("Rate limit not applied, %d packets allowed", allowed)
+	}
+
+	repInfo.offend(peer, OffenceInvalidMessage, nil, now)
+	if repInfo.Response(peer, now) != ResponseQuarantine || repInfo.Allow(peer, false, now) ||
+		!repInfo.Allow(peer, true, now.Add(2*time.Second)) {
+		t.Errorf("Expected a quarantine letting status through, got %s", repInfo.Response(peer, now))
+	}
+
+	repInfo.offend(peer, OffenceDoubleVote, nil, now)
+	if repInfo.Response(peer, now) != ResponseBan || repInfo.Allow(peer, true, now) {
+		t.Errorf("Expected a ban, got %s", repInfo.Response(peer, now))
+	}
+	if repInfo.Opinions[peer] != -1 {
+		t.Errorf("Offence not in our opinions")
+	}
+}
+
+// colluding peers accuse an honest one, it gets quarantined but recovers
+func TestRecoveryFromFalseAccusation(t *testing.T) {
+	repInfo := NewReputationInfo()
+	honest := "honest"
+	now := time.Now()
+	pollKey := PollKey{Origin: ecdsa.PublicKey{}, ID: 1}
+
+	for i := 0; i < 3; i++ {
+		liar := make(RepOpinions)
+		liar.Suspect(honest)
+		repInfo.AddPeerOpinion(&ReputationPacket{
+			Signer:   ecdsa.PublicKey{Curve: Curve(), X: big.NewInt(int64(i)), Y: big.NewInt(0)},
+			PollID:   pollKey,
+			Opinions: liar,
+		}, pollKey)
+	}
+	repInfo.addReputations(pollKey, now)
+
+	if repInfo.Response(honest, now) != ResponseQuarantine {
+		t.Fatalf("Accused peer not quarantined")
+	}
+
+	// every minute, see how the peer is treated
+	var responses []Response
+	for minute := 1; minute <= 240; minute++ {
+		r := repInfo.Response(honest, now.Add(time.Duration(minute)*time.Minute))
+		if len(responses) == 0 || responses[len(responses)-1] != r {
+			responses = append(responses, r)
+		}
+	}
+
+	expected := []Response{ResponseQuarantine, ResponseRateLimit, ResponseNone}
+	if fmt.Sprint(responses) != fmt.Sprint(expected) {
+		t.Errorf("Expected the peer to recover through %v, got %v", expected, responses)
+	}
+
+	later := now.Add(4 * time.Hour)
+	if repInfo.Score(honest, later) < repInfo.Config.RateLimitBelow || !repInfo.Allow(honest, false, later) {
+		t.Errorf("Peer didn't recover, score %.1f", repInfo.Score(honest, later))
+	}
+}
+
+func TestPermanentBan(t *testing.T) {
+	repInfo := NewReputationInfo()
+	repInfo.Config.BanDuration = 0
+	repInfo.Config.HalfLife = 0
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		repInfo.offend("peerA", OffenceDoubleVote, nil, now)
+	}
+
+	if repInfo.Response("peerA", now.Add(24*365*time.Hour)) != ResponseBan {
+		t.Errorf("Permanent ban expired")
+	}
+}
+
+func TestBanReasons(t *testing.T) {
+	repInfo := NewReputationInfo()
+	g := DummyGossiper()
+	poll := PollKey{g.KeyPair.PublicKey, 1}
+	now := time.Now()
+
+	repInfo.offend("peerA", OffenceInvalidSignature, nil, now)
+	repInfo.offend("peerA", OffenceDoubleVote, &poll, now)
+
+	entry, banned := repInfo.Blacklist["peerA"]
+	if !banned || len(entry.Reasons) != 2 || entry.Reasons[1].Offence != OffenceDoubleVote.String() {
+		t.Fatalf("Ban without its reasons: %v", entry)
+	}
+	if len(entry.Polls) != 1 || entry.Polls[0] != poll.String() {
+		t.Errorf("Expected the ban to come from %s, got %v", poll, entry.Polls)
+	}
+
+	peers := repInfo.Peers(now)
+	if len(peers) != 1 || peers[0].Response != ResponseBan.String() || peers[0].Opinion != -1 {
+		t.Errorf("Wrong listing %v", peers)
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	repInfo := NewReputationInfo()
+	now := time.Now()
+
+	repInfo.offend("peerA", OffenceDoubleVote, nil, now)
+	repInfo.offend("peerA", OffenceDoubleVote, nil, now)
+	if !repInfo.IsBlacklisted("peerA") || !repInfo.Unban("peerA") || repInfo.IsBlacklisted("peerA") {
+		t.Errorf("Peer not unbanned")
+	}
+	if repInfo.Unban("peerA") {
+		t.Errorf("Peer unbanned twice")
+	}
+
+	repInfo.SetOverride("peerB", OverridePin)
+	repInfo.offend("peerB", OffenceDoubleVote, nil, now)
+	repInfo.offend("peerB", OffenceDoubleVote, nil, now)
+	if repInfo.Response("peerB", now) != ResponseNone || repInfo.Score("peerB", now) != 0 {
+		t.Errorf("Pinned peer penalized")
+	}
+
+	repInfo.SetOverride("peerC", OverrideSuspect)
+	if repInfo.Response("peerC", now) != ResponseQuarantine || repInfo.currentOpinions(now)["peerC"] != -1 {
+		t.Errorf("Suspected peer not quarantined")
+	}
+	if _, ok := repInfo.Opinions["peerC"]; ok {
+		t.Errorf("Override mixed with our observations")
+	}
+
+	repInfo.SetOverride("peerC", OverrideNone)
+	if repInfo.Response("peerC", now) != ResponseNone {
+		t.Errorf("Override not cleared")
+	}
+
+	// trusted by the admin, its opinions count like a pre-trusted peer
+	repInfo.SetOverride("peerD", OverrideTrust)
+	if trusted := repInfo.preTrusted(); len(trusted) != 1 || trusted[0] != "peerD" {
+		t.Errorf("Trusted peer not pre-trusted: %v", trusted)
+	}
+}
+
+func TestRoundTimeout(t *testing.T) {
+	g := DummyGossiper()
+	g.Reputations.Config.RoundTimeout = 50 * time.Millisecond
+	id := PollKey{g.KeyPair.PublicKey, 1}
+
+	voter := DummyGossiper()
+	participants := [][2]big.Int{{*g.KeyPair.X, *g.KeyPair.Y}, {*voter.KeyPair.X, *voter.KeyPair.Y}, {}}
+	g.storeParticipants(id, participants, nil)
+
+	g.Reputations.AddPeerOpinion(&ReputationPacket{Signer: voter.KeyPair.PublicKey, Address: "peerA",
+		Opinions: RepOpinions{"peerB": 1}}, id)
+
+	// one participant never sends its opinions
+	finished := make(chan bool)
+	go func() {
+		UpdateReputations(g, id)
+		finished <- true
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatalf("Round never finalized")
+	}
+
+	g.Reputations.FinalizeRound(id)
+	if len(g.Reputations.PollOpinions()[id.String()]) != 2 {
+		t.Errorf("Expected our opinions and the ones received, got %v", g.Reputations.PollOpinions())
+	}
+}
+
+func TestRoundComplete(t *testing.T) {
+	repInfo := NewReputationInfo()
+	id := PollKey{DummyGossiper().KeyPair.PublicKey, 1}
+
+	done := repInfo.StartRound(id, 2)
+	for i, signer := range []string{"peerA", "peerB"} {
+		select {
+		case <-done:
+			t.Fatalf("Round finalized after %d opinions", i)
+		default:
+		}
+
+		repInfo.AddPeerOpinion(&ReputationPacket{Signer: DummyGossiper().KeyPair.PublicKey, Address: signer,
+			Opinions: RepOpinions{"peerC": -1}}, id)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Round not finalized with every opinion")
+	}
+
+	if repInfo.Score("peerC", time.Now()) >= 0 {
+		t.Errorf("Opinions not aggregated")
+	}
+}
+
+// run with -race
+func TestConcurrentReputation(t *testing.T) {
+	repInfo := NewReputationInfo()
+	repInfo.Config.RoundTimeout = time.Millisecond
+	origin := DummyGossiper().KeyPair.PublicKey
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			peer := "peer" + strconv.Itoa(i%3)
+			id := PollKey{origin, uint64(i % 2)}
+			for j := 0; j < 50; j++ {
+				now := time.Now()
+				repInfo.Offend(peer, OffenceEarlyVote, &id)
+				repInfo.Allow(peer, j%2 == 0, now)
+				repInfo.AddPeerOpinion(&ReputationPacket{Signer: origin, Address: peer,
+					Opinions: RepOpinions{"peer3": -1}}, id)
+				repInfo.StartRound(id, 3)
+				repInfo.SetOverride("peer4", Override(j%4))
+				repInfo.Peers(now)
+				repInfo.PollOpinions()
+				repInfo.CurrentOpinions()
+				repInfo.Bans(true, now)
+				repInfo.FinalizeRound(id)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if repInfo.Opinion("peer0") != -1 || repInfo.Scores["peer0"].Offences == 0 {
+		t.Errorf("Offences lost")
+	}
+}
@@ -0,0 +1,102 @@
+package pollparty
+
+import (
+	"errors"
+	"time"
+)
+
+// how the winning option is chosen among the counted ballots
+type DecisionRule uint32
+
+const (
+	RulePlurality     DecisionRule = iota // most votes
+	RuleMajority                          // more than half of the ballots
+	RuleSupermajority                     // at least two thirds of the ballots
+)
+
+func DecisionRuleFromString(name string) (DecisionRule, error) {
+	switch name {
+	case "", "plurality":
+		return RulePlurality, nil
+	case "majority":
+		return RuleMajority, nil
+	case "supermajority":
+		return RuleSupermajority, nil
+	}
+
+	return RulePlurality, errors.New("unknown decision rule \"" + name + "\"")
+}
+
+const TieBreakOptionOrder = "first in the options of the poll"
+
+type PollResult struct {
+	Counts       map[string]int
+	Participants int  // voters whose key was accepted
+	Committed    int  // voters who sent a ballot
+	Counted      int  // ballots in the counts, by weight if the poll is weighted
+	QuorumMet    bool // enough participants and turnout
+	Winner       string
+	Tied         []string // options sharing the most votes, if more than one
+	TieBreak     string   // how the winner was chosen among them
+	Final        bool     // the poll is over, the counts won't change
+}
+
+func (info ShareablePollInfo) quorumMet(committed int) bool {
+	participants := len(info.Participants)
+	return participants > 0 && participants >= info.Poll.MinParticipants &&
+		committed*100 >= info.Poll.MinTurnout*participants
+}
+
+func (info ShareablePollInfo) Result() PollResult {
+	ret := PollResult{
+		Counts:       info.Results(),
+		Participants: len(info.Participants),
+		Committed:    len(info.Tags), // a ring tag per voter
+	}
+
+	// until the reveal is over, the winner is only the one leading
+	phase := info.Phase(time.Now())
+	ret.Final = phase == PhaseClosed || phase == PhaseCancelled || phase == PhaseEquivocated
+
+	for _, count := range ret.Counts {
+		ret.Counted += count
+	}
+
+	ret.QuorumMet = !info.Cancelled() && !info.Equivocated() && info.quorumMet(ret.Committed)
+	if !ret.QuorumMet || ret.Counted == 0 {
+		return ret
+	}
+
+	best := 0
+	for _, o := range info.Poll.Options {
+		if ret.Counts[o] > best {
+			best = ret.Counts[o]
+		}
+	}
+
+	for _, o := range info.Poll.Options {
+		if ret.Counts[o] == best {
+			ret.Tied = append(ret.Tied, o)
+		}
+	}
+
+	switch info.Poll.Rule {
+	case RuleMajority:
+		if best*2 <= ret.Counted {
+			return ret
+		}
+	case RuleSupermajority:
+		if best*3 < ret.Counted*2 {
+			return ret
+		}
+	}
+
+	ret.Winner = ret.Tied[0]
+	if len(ret.Tied) > 1 {
+		ret.TieBreak = TieBreakOptionOrder
+	} else {
+		ret.Tied = nil
+	}
+
+	return ret
+}
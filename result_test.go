@@ -0,0 +1,85 @@
+package pollparty
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+func resultInfo(rule DecisionRule, votes ...string) ShareablePollInfo {
+	poll := DummyPoll()
+	poll.Rule = rule
+	info := ShareablePollInfo{Poll: *poll, Tags: make(map[LinkTagMap][][32]byte)}
+
+	for i, o := range votes {
+		info.Participants = append(info.Participants, [2]big.Int{})
+		info.Tags[LinkTagMapFrom([2]*big.Int{big.NewInt(int64(i)), big.NewInt(0)})] = nil
+		info.Votes = append(info.Votes, Vote{Option: o})
+	}
+
+	return info
+}
+
+func TestResultRules(t *testing.T) {
+	result := resultInfo(RulePlurality, "Yes", "No", "No").Result()
+	if !result.QuorumMet || result.Winner != "No" || result.Counted != 3 || result.TieBreak != "" {
+		t.Errorf("Plurality winner not found: %+v", result)
+	}
+
+	result = resultInfo(RulePlurality, "No", "Yes").Result()
+	if result.Winner != DummyPoll().Options[0] || len(result.Tied) != 2 || result.TieBreak == "" {
+		t.Errorf("Tie not broken by option order: %+v", result)
+	}
+
+	result = resultInfo(RuleMajority, "No", "Yes").Result()
+	if result.Winner != "" {
+		t.Errorf("Majority won with half of the ballots: %+v", result)
+	}
+
+	result = resultInfo(RuleSupermajority, "Yes", "Yes", "No").Result()
+	if result.Winner != "Yes" {
+		t.Errorf("Supermajority not reached with two thirds: %+v", result)
+	}
+
+	result = resultInfo(RuleSupermajority, "Yes", "Yes", "No", "No").Result()
+	if result.Winner != "" {
+		t.Errorf("Supermajority reached with half: %+v", result)
+	}
+}
+
+func TestResultQuorum(t *testing.T) {
+	info := resultInfo(RulePlurality, "Yes", "No", "No")
+	info.Poll.MinParticipants = 4
+	if info.Result().QuorumMet {
+		t.Errorf("Quorum met without enough participants")
+	}
+
+	info.Poll.MinParticipants = 3
+	info.Participants = append(info.Participants, [2]big.Int{})
+	info.Poll.MinTurnout = 80
+	if result := info.Result(); result.QuorumMet || result.Winner != "" {
+		t.Errorf("Quorum met with a turnout of 75%%: %+v", result)
+	}
+
+	info.Poll.MinTurnout = 75
+	if !info.Result().QuorumMet {
+		t.Errorf("Quorum not met with a turnout of 75%%")
+	}
+
+	info.Controls = append(info.Controls, NewPollControl(ControlCancel, 0))
+	if info.Result().QuorumMet {
+		t.Errorf("Cancelled poll met its quorum")
+	}
+}
+
+func TestResultFinal(t *testing.T) {
+	info := resultInfo(RulePlurality, "Yes", "No", "No")
+	if result := info.Result(); result.Final || result.Winner != "No" {
+		t.Errorf("Running poll has a final result: %+v", result)
+	}
+
+	info.Poll.StartTime = time.Now().Add(-2 * time.Hour)
+	if result := info.Result(); !result.Final || result.Winner != "No" {
+		t.Errorf("Closed poll has no final result: %+v", result)
+	}
+}
@@ -0,0 +1,219 @@
+package pollparty
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const ScheduleFileName = "schedules.json"
+
+// a poll to start later, maybe again and again
+type Schedule struct {
+	ID       uint64
+	Poll     Poll          // its start time is the one of each run
+	Metadata *PollMetadata // signed once the poll has its ID
+	Next     time.Time
+	Every    time.Duration // zero if the poll runs once
+}
+
+type Scheduler struct {
+	sync.Mutex
+	m      map[uint64]Schedule
+	lastID uint64
+	file   string    // where the schedules are saved, if any
+	wake   chan bool // the next run might have changed
+}
+
+type scheduleFile struct {
+	LastID    uint64
+	Schedules []Schedule
+}
+
+// reads the schedules and saves them there from now on, a missing file
+// means no schedule
+func (s *Scheduler) Load(file string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.file = file
+
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var saved scheduleFile
+	err = json.Unmarshal(content, &saved)
+	if err != nil {
+		return err
+	}
+
+	s.lastID = saved.LastID
+	for _, schedule := range saved.Schedules {
+		s.m[schedule.ID] = schedule
+	}
+	s.notify()
+
+	return nil
+}
+
+// called with the lock held
+func (s *Scheduler) save() {
+	if s.file == "" {
+		return
+	}
+
+	content, err := json.Marshal(scheduleFile{s.lastID, s.list()})
+	if err != nil {
+		log.Println("unable to encode the schedules:", err)
+		return
+	}
+
+	err = ioutil.WriteFile(s.file, content, 0600)
+	if err != nil {
+		log.Println("unable to save the schedules:", err)
+	}
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- true:
+	default:
+	}
+}
+
+func (s *Scheduler) Add(poll Poll, metadata *PollMetadata, next time.Time, every time.Duration) Schedule {
+	s.Lock()
+	defer s.Unlock()
+
+	s.lastID++
+	schedule := Schedule{
+		ID:       s.lastID,
+		Poll:     poll,
+		Metadata: metadata,
+		Next:     next,
+		Every:    every,
+	}
+	s.m[schedule.ID] = schedule
+
+	s.save()
+	s.notify()
+
+	return schedule
+}
+
+func (s *Scheduler) Cancel(id uint64) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.m[id]; !ok {
+		return false
+	}
+	delete(s.m, id)
+
+	s.save()
+	s.notify()
+
+	return true
+}
+
+// upcoming schedules, the next first
+func (s *Scheduler) List() []Schedule {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.list()
+}
+
+func (s *Scheduler) list() []Schedule {
+	ret := make([]Schedule, 0, len(s.m))
+	for _, schedule := range s.m {
+		ret = append(ret, schedule)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Next.Equal(ret[j].Next) {
+			return ret[i].ID < ret[j].ID
+		}
+		return ret[i].Next.Before(ret[j].Next)
+	})
+
+	return ret
+}
+
+func (s *Scheduler) next() (time.Time, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	list := s.list()
+	if len(list) == 0 {
+		return time.Time{}, false
+	}
+
+	return list[0].Next, true
+}
+
+// the schedules to run now, recurring ones are moved to their next run and
+// the others removed. Runs missed while we were down are only done once.
+func (s *Scheduler) due(now time.Time) []Schedule {
+	s.Lock()
+	defer s.Unlock()
+
+	var ret []Schedule
+	for _, schedule := range s.list() {
+		if schedule.Next.After(now) {
+			break
+		}
+		ret = append(ret, schedule)
+
+		if schedule.Every <= 0 {
+			delete(s.m, schedule.ID)
+			continue
+		}
+
+		for !schedule.Next.After(now) {
+			schedule.Next = schedule.Next.Add(schedule.Every)
+		}
+		s.m[schedule.ID] = schedule
+	}
+
+	if len(ret) > 0 {
+		s.save()
+	}
+
+	return ret
+}
+
+// starts the scheduled polls as their origin, when their time comes
+func RunScheduler(g *Gossiper) {
+	for {
+		var timer <-chan time.Time = nil
+		if next, ok := g.Schedules.next(); ok {
+			timer = time.After(time.Until(next))
+		}
+
+		select {
+		case <-timer:
+		case <-g.Schedules.wake:
+		}
+
+		for _, schedule := range g.Schedules.due(time.Now()) {
+			poll := schedule.Poll
+			poll.StartTime = canonicalTime(time.Now())
+
+			id, err := startPoll(g, poll, schedule.Metadata)
+			if err != nil {
+				log.Printf("Scheduler: unable to start schedule %d: %s", schedule.ID, err)
+				continue
+			}
+			log.Printf("Scheduler: schedule %d started poll %s", schedule.ID, id.String())
+		}
+	}
+}
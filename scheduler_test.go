@@ -0,0 +1,103 @@
+package pollparty
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSchedulerDue(t *testing.T) {
+	g := DummyGossiper()
+	now := time.Now()
+
+	once := g.Schedules.Add(*DummyPoll(), nil, now.Add(-time.Minute), 0)
+	weekly := g.Schedules.Add(*DummyPoll(), nil, now.Add(-15*24*time.Hour), 7*24*time.Hour)
+	later := g.Schedules.Add(*DummyPoll(), nil, now.Add(time.Hour), 0)
+
+	due := g.Schedules.due(now)
+	if len(due) != 2 || due[0].ID != weekly.ID || due[1].ID != once.ID {
+		t.Fatalf("Expected the weekly then the single schedule to be due, got %v", due)
+	}
+
+	list := g.Schedules.List()
+	if len(list) != 2 || list[0].ID != later.ID || list[1].ID != weekly.ID {
+		t.Fatalf("Single schedule not removed once run")
+	}
+
+	// missed runs are done once
+	if next := list[1].Next; !next.After(now) || next.After(now.Add(7*24*time.Hour)) {
+		t.Errorf("Weekly schedule not moved to its next run: %v", next)
+	}
+
+	if len(g.Schedules.due(now)) != 0 {
+		t.Errorf("Schedules run twice")
+	}
+
+	if !g.Schedules.Cancel(later.ID) || g.Schedules.Cancel(later.ID) || len(g.Schedules.List()) != 1 {
+		t.Errorf("Schedule not cancelled once")
+	}
+}
+
+func TestSchedulerPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schedules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, ScheduleFileName)
+
+	g := DummyGossiper()
+	if err := g.Schedules.Load(file); err != nil {
+		t.Fatalf("Missing schedule file not accepted: %s", err)
+	}
+
+	poll := DummyPoll()
+	poll.Question = "How was the sprint?"
+	saved := g.Schedules.Add(*poll, nil, time.Now().Add(time.Hour), 7*24*time.Hour)
+
+	restarted := DummyGossiper()
+	if err := restarted.Schedules.Load(file); err != nil {
+		t.Fatal(err)
+	}
+
+	list := restarted.Schedules.List()
+	if len(list) != 1 || list[0].Poll.Question != poll.Question || list[0].Every != saved.Every ||
+		!list[0].Next.Equal(saved.Next) {
+		t.Fatalf("Schedule changed after a restart: %v", list)
+	}
+
+	if restarted.Schedules.Add(*poll, nil, time.Now(), 0).ID == saved.ID {
+		t.Errorf("Schedule ID reused after a restart")
+	}
+}
+
+func TestRunScheduler(t *testing.T) {
+	g := DummyGossiper()
+	go RunScheduler(g)
+
+	poll := DummyPoll()
+	g.Schedules.Add(*poll, nil, time.Now().Add(50*time.Millisecond), 0)
+
+	deadline := time.After(NetworkConvergeDuration)
+	for {
+		g.Polls.RLock()
+		started := len(g.Polls.m)
+		g.Polls.RUnlock()
+
+		if started == 1 {
+			break
+		}
+
+		select {
+		case <-deadline:
+			t.Fatalf("Scheduled poll not started")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if len(g.Schedules.List()) != 0 {
+		t.Errorf("Started schedule still listed")
+	}
+}
@@ -13,6 +13,12 @@ func main() {
 	gossipAddr := flag.String("gossipAddr", "127.0.0.1:5000", "port to connect the gossiper server")
 	name := flag.String("name", "nodeA", "server identifier")
 	peersStr := flag.String("peers", "127.0.0.1:5001_10.1.1.7:5002", "underscore separated list of peers")
+	banDuration := flag.Duration("banDuration", pkg.DefaultReputationConfig().BanDuration, "how long misbehaving peers are banned, forever if zero")
+	preTrusted := flag.String("preTrusted", "", "underscore separated list of peers whose reputation opinions are trusted")
+	halfLife := flag.Duration("reputationHalfLife", pkg.DefaultReputationConfig().HalfLife, "time for a bad reputation to be halved, never if zero")
+	roundTimeout := flag.Duration("reputationTimeout", pkg.DefaultReputationConfig().RoundTimeout, "time to wait for the reputation opinions of every participant after a poll")
+	workers := flag.Int("workers", pkg.DefaultReceiveConfig().Workers, "packets dispatched at once")
+	peerRate := flag.Float64("peerRate", pkg.DefaultReceiveConfig().PeerRate, "packets per second handled for each peer")
 	flag.Parse()
 
 	gossiper, err := pkg.NewGossiper(*name, pkg.NewServer(*gossipAddr))
@@ -21,6 +27,18 @@ func main() {
 	}
 	defer gossiper.Server.Conn.Close()
 
+	gossiper.Reputations.Config.BanDuration = *banDuration
+	gossiper.Reputations.Config.HalfLife = *halfLife
+	gossiper.Reputations.Config.RoundTimeout = *roundTimeout
+	gossiper.Receiver.Config.Workers = *workers
+	gossiper.Receiver.Config.PeerRate = *peerRate
+	gossiper.Receiver.Config.PeerBurst = 2 * *peerRate
+	for _, peer := range strings.Split(*preTrusted, "_") {
+		if peer != "" {
+			gossiper.Reputations.Config.PreTrusted = append(gossiper.Reputations.Config.PreTrusted, peer)
+		}
+	}
+
 	for _, peer := range strings.Split(*peersStr, "_") {
 		if peer == "" {
 			continue
@@ -32,5 +50,6 @@ func main() {
 	// one should stay main thread'ed to avoid exiting
 	go pkg.RunServer(gossiper, gossiper.Server, pkg.DispatcherPeersterMessage(gossiper))
 	go pkg.AntiEntropyGossip(gossiper)
+	go pkg.RunScheduler(gossiper)
 	pkg.ApiStart(gossiper, *uiPort)
 }
@@ -0,0 +1,319 @@
+package pollparty
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"sort"
+)
+
+// how the votes are counted
+type TallyMode uint32
+
+const (
+	TallyReveal      TallyMode = iota // commit then reveal the plaintext votes
+	TallyHomomorphic                  // sum encrypted ballots, only decrypt the result
+)
+
+func TallyModeFromString(name string) (TallyMode, error) {
+	switch name {
+	case "", "reveal":
+		return TallyReveal, nil
+	case "homomorphic":
+		return TallyHomomorphic, nil
+	}
+
+	return TallyReveal, errors.New("unknown tally mode \"" + name + "\"")
+}
+
+// every proof of a poll is bound to it, to avoid replaying them elsewhere
+func tallyContext(id PollKey, kind string) []byte {
+	return []byte(kind + PollKeySep + id.String())
+}
+
+// proves that the voter knows the secret of its vote key, the master only
+// accepts proven keys in the ring of a homomorphic poll
+func voteKeyProof(id PollKey, key ecdsa.PrivateKey) *DLProof {
+	pub := [2]*big.Int{key.X, key.Y}
+	proof := proveDL(key.D, [][2]*big.Int{pointBase()}, [][2]*big.Int{pub}, tallyContext(id, "votekey"))
+	return &proof
+}
+
+func (k VoteKey) proofValid(id PollKey) bool {
+	pub := [2]*big.Int{k.tmpKey.X, k.tmpKey.Y}
+	return k.Proof != nil && k.Proof.verify([][2]*big.Int{pointBase()}, [][2]*big.Int{pub}, tallyContext(id, "votekey"))
+}
+
+// an encrypted vote, with one ciphertext per option, each one encrypting 0
+// or 1 and summing to 1
+type Ballot struct {
+	Ciphertexts []ElGamalCiphertext
+	BitProofs   []BitProof
+	SumProof    DLProof
+}
+
+type BallotDigest [sha256.Size]byte
+
+func NewBallot(id PollKey, Y [2]*big.Int, options []string, answer string) (Ballot, error) {
+	n := Curve().Params().N
+	context := tallyContext(id, "ballot")
+
+	chosen := -1
+	for i, o := range options {
+		if o == answer {
+			chosen = i
+		}
+	}
+
+	if chosen == -1 {
+		return Ballot{}, errors.New("\"" + answer + "\" isn't an option")
+	}
+
+	ret := Ballot{}
+	sum := elGamalZero()
+	r := new(big.Int)
+
+	for i := range options {
+		bit := 0
+		if i == chosen {
+			bit = 1
+		}
+
+		ri, err := randomScalar()
+		if err != nil {
+			return Ballot{}, err
+		}
+		ct := elGamalEncrypt(Y, int64(bit), ri)
+
+		ret.Ciphertexts = append(ret.Ciphertexts, ct)
+		ret.BitProofs = append(ret.BitProofs, proveBit(Y, ct, bit, ri, context))
+
+		sum = sum.add(ct)
+		r.Add(r, ri).Mod(r, n)
+	}
+
+	// (sum A, sum B - G) = r*(G, Y)
+	ret.SumProof = proveDL(r, [][2]*big.Int{pointBase(), Y},
+		[][2]*big.Int{sum.A, pointAdd(sum.B, pointNeg(pointBase()))}, context)
+
+	return ret, nil
+}
+
+func (b Ballot) Valid(id PollKey, Y [2]*big.Int, numOptions int) bool {
+	context := tallyContext(id, "ballot")
+
+	if len(b.Ciphertexts) != numOptions || len(b.BitProofs) != numOptions {
+		return false
+	}
+
+	sum := elGamalZero()
+	for i, ct := range b.Ciphertexts {
+		if !b.BitProofs[i].verify(Y, ct, context) {
+			return false
+		}
+		sum = sum.add(ct)
+	}
+
+	return b.SumProof.verify([][2]*big.Int{pointBase(), Y},
+		[][2]*big.Int{sum.A, pointAdd(sum.B, pointNeg(pointBase()))}, context)
+}
+
+func (b Ballot) Digest() BallotDigest {
+	hash := sha256.New()
+
+	for _, ct := range b.Ciphertexts {
+		for _, p := range [][2]*big.Int{ct.A, ct.B} {
+			hash.Write(p[0].Bytes())
+			hash.Write(p[1].Bytes())
+		}
+	}
+
+	var ret BallotDigest
+	copy(ret[:], hash.Sum(nil))
+	return ret
+}
+
+func sortedBallotDigests(ballots []Ballot) []BallotDigest {
+	ret := make([]BallotDigest, len(ballots))
+	for i, b := range ballots {
+		ret[i] = b.Digest()
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return bytes.Compare(ret[i][:], ret[j][:]) < 0
+	})
+
+	return ret
+}
+
+func sumBallots(ballots []Ballot, numOptions int) []ElGamalCiphertext {
+	ret := make([]ElGamalCiphertext, numOptions)
+	for i := range ret {
+		ret[i] = elGamalZero()
+	}
+
+	for _, b := range ballots {
+		for i, ct := range b.Ciphertexts {
+			ret[i] = ret[i].add(ct)
+		}
+	}
+
+	return ret
+}
+
+// a trustee's share of the decryption of the summed ballots, Threshold of
+// them are enough to decrypt the tally
+type PartialDecryption struct {
+	Trustee int            // index in the trustees of the poll
+	Ballots []BallotDigest // the ballots summed, sorted
+	Factors [][2]*big.Int  // x*A for each option, x being the DKG share
+	Proofs  []DLProof
+}
+
+func NewPartialDecryption(id PollKey, trustee int, share *big.Int, ballots []Ballot, numOptions int) PartialDecryption {
+	context := tallyContext(id, "decryption")
+	pub := pointBaseMul(share)
+
+	ret := PartialDecryption{
+		Trustee: trustee,
+		Ballots: sortedBallotDigests(ballots),
+	}
+
+	for _, sum := range sumBallots(ballots, numOptions) {
+		factor := pointMul(sum.A, share)
+		ret.Factors = append(ret.Factors, factor)
+		ret.Proofs = append(ret.Proofs, proveDL(share, [][2]*big.Int{pointBase(), sum.A},
+			[][2]*big.Int{pub, factor}, context))
+	}
+
+	return ret
+}
+
+func (d PartialDecryption) ballotsKey() string {
+	ret := ""
+	for _, b := range d.Ballots {
+		ret += string(b[:])
+	}
+	return ret
+}
+
+func (o DKGOutcome) qualified(trustee int) bool {
+	for _, q := range o.Qualified {
+		if q == trustee {
+			return true
+		}
+	}
+	return false
+}
+
+// checks the decryption against the given ballots, which should be the one
+// referenced by the decryption, and the DKG share of its trustee
+func (d PartialDecryption) Valid(id PollKey, outcome DKGOutcome, ballots []Ballot, numOptions int) bool {
+	context := tallyContext(id, "decryption")
+
+	if len(d.Factors) != numOptions || len(d.Proofs) != numOptions || len(ballots) != len(d.Ballots) ||
+		!outcome.qualified(d.Trustee) {
+		return false
+	}
+
+	for i, digest := range sortedBallotDigests(ballots) {
+		if digest != d.Ballots[i] {
+			return false
+		}
+	}
+
+	pub := outcome.PublicShare(d.Trustee)
+	for i, sum := range sumBallots(ballots, numOptions) {
+		if !d.Proofs[i].verify([][2]*big.Int{pointBase(), sum.A}, [][2]*big.Int{pub, d.Factors[i]}, context) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ballots referenced by the decryption, if we know all of them
+func (info ShareablePollInfo) ballotsOf(d PartialDecryption) ([]Ballot, bool) {
+	known := make(map[BallotDigest]Ballot)
+	for _, b := range info.Ballots {
+		known[b.Digest()] = b
+	}
+
+	ret := make([]Ballot, 0)
+	for _, digest := range d.Ballots {
+		b, ok := known[digest]
+		if !ok {
+			return nil, false
+		}
+		ret = append(ret, b)
+	}
+
+	return ret, true
+}
+
+// decrypts the tally as soon as Threshold trustees decrypted the same
+// ballots, their factors are interpolated at zero
+func (info ShareablePollInfo) homomorphicResults() (map[string]int, bool) {
+	numOptions := len(info.Poll.Options)
+	if info.DKG == nil {
+		return nil, false
+	}
+
+	bySet := make(map[string]map[int]PartialDecryption)
+	for _, d := range info.Decryptions {
+		if bySet[d.ballotsKey()] == nil {
+			bySet[d.ballotsKey()] = make(map[int]PartialDecryption)
+		}
+		bySet[d.ballotsKey()][d.Trustee] = d
+	}
+
+	for _, decryptions := range bySet {
+		var trustees []int
+		var first PartialDecryption
+		for j, d := range decryptions {
+			if len(trustees) < info.Poll.Threshold && info.DKG.qualified(j) {
+				trustees = append(trustees, j)
+				first = d
+			}
+		}
+
+		if len(trustees) < info.Poll.Threshold {
+			continue
+		}
+
+		ballots, known := info.ballotsOf(first)
+		if !known {
+			continue
+		}
+
+		factors := make([][2]*big.Int, numOptions)
+		for i := range factors {
+			factors[i] = pointInfinity()
+		}
+
+		for _, j := range trustees {
+			lambda := lagrangeCoefficient(j, trustees)
+			for i := range factors {
+				factors[i] = pointAdd(factors[i], pointMul(decryptions[j].Factors[i], lambda))
+			}
+		}
+
+		ret := make(map[string]int)
+		for i, sum := range sumBallots(ballots, numOptions) {
+			count, ok := discreteLog(pointAdd(sum.B, pointNeg(factors[i])), len(ballots))
+			if !ok {
+				return nil, false
+			}
+
+			if count > 0 {
+				ret[info.Poll.Options[i]] = count
+			}
+		}
+
+		return ret, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,179 @@
+package pollparty
+
+import (
+	"crypto/ecdsa"
+	crypto "crypto/rand"
+	"math/big"
+	"testing"
+)
+
+// a homomorphic poll whose trustees are done with the DKG, with their shares
+func dummyTallyPoll(t *testing.T, numTrustees, threshold int) (PollKey, []*big.Int, ShareablePollInfo) {
+	id, poll, keys := dummyDKGPoll(t, numTrustees, threshold)
+	poll.Options = []string{"Yes", "No", "Maybe"}
+	poll.Tally = TallyHomomorphic
+
+	deals := honestDeals(t, id, poll, keys)
+	outcome, ok := computeDKGOutcome(id, poll, deals, nil)
+	if !ok {
+		t.Fatal("DKG failed with honest trustees")
+	}
+
+	shares := make([]*big.Int, len(keys))
+	for j, key := range keys {
+		shares[j], ok = outcome.SecretShare(id, poll, deals, *key)
+		if !ok {
+			t.Fatalf("Trustee %d unable to compute its share", j)
+		}
+	}
+
+	return id, shares, ShareablePollInfo{Poll: poll, DKG: &outcome}
+}
+
+func TestVoteKeyProof(t *testing.T) {
+	id := PollKey{DummyGossiper().KeyPair.PublicKey, uint64(1)}
+
+	keys := make([]*ecdsa.PrivateKey, 2)
+	for i := range keys {
+		var err error
+		keys[i], err = ecdsa.GenerateKey(Curve(), crypto.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	k := VoteKey{tmpKey: keys[0].PublicKey, Proof: voteKeyProof(id, *keys[0])}
+	if !k.proofValid(id) {
+		t.Errorf("Unable to verify a vote key proof")
+	}
+
+	k.Proof = voteKeyProof(id, *keys[1])
+	if k.proofValid(id) {
+		t.Errorf("Accepted a vote key with the proof of another")
+	}
+}
+
+func TestBallotValid(t *testing.T) {
+	id, _, info := dummyTallyPoll(t, 3, 2)
+	Y := info.DKG.PublicKey()
+	options := info.Poll.Options
+
+	ballot, err := NewBallot(id, Y, options, "No")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ballot.Valid(id, Y, len(options)) {
+		t.Errorf("Unable to verify a generated ballot")
+	}
+
+	if ballot.Valid(PollKey{id.Origin, id.ID + 1}, Y, len(options)) {
+		t.Errorf("Verified a ballot for another poll")
+	}
+
+	// voting twice for "No"
+	double := ballot
+	double.Ciphertexts = append([]ElGamalCiphertext{}, ballot.Ciphertexts...)
+	double.Ciphertexts[0] = ballot.Ciphertexts[1]
+	if double.Valid(id, Y, len(options)) {
+		t.Errorf("Verified a ballot with two votes")
+	}
+
+	if _, err := NewBallot(id, Y, options, "Never"); err == nil {
+		t.Errorf("Created a ballot for an unknown option")
+	}
+}
+
+func TestHomomorphicResults(t *testing.T) {
+	id, shares, info := dummyTallyPoll(t, 4, 3)
+	Y := info.DKG.PublicKey()
+	options := info.Poll.Options
+
+	for _, answer := range []string{"Yes", "No", "Yes", "Yes"} {
+		ballot, err := NewBallot(id, Y, options, answer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info.Ballots = append(info.Ballots, ballot)
+	}
+
+	// trustee 1 withholds its decryption, the threshold is still reached
+	for _, j := range []int{3, 0, 2} {
+		if len(info.Results()) != 0 {
+			t.Errorf("Got results before the threshold, with %d decryptions", len(info.Decryptions))
+		}
+
+		d := NewPartialDecryption(id, j, shares[j], info.Ballots, len(options))
+		if !d.Valid(id, *info.DKG, info.Ballots, len(options)) {
+			t.Errorf("Unable to verify a generated partial decryption")
+		}
+
+		info.Decryptions = append(info.Decryptions, d)
+	}
+
+	results := info.Results()
+	if results["Yes"] != 3 || results["No"] != 1 || results["Maybe"] != 0 {
+		t.Errorf("Wrong results: %v", results)
+	}
+
+	forged := info.Decryptions[0]
+	forged.Factors = append([][2]*big.Int{}, forged.Factors...)
+	forged.Factors[0] = forged.Factors[1]
+	if forged.Valid(id, *info.DKG, info.Ballots, len(options)) {
+		t.Errorf("Verified an invalid partial decryption")
+	}
+
+	// the share of another trustee
+	stolen := NewPartialDecryption(id, 1, shares[0], info.Ballots, len(options))
+	if stolen.Valid(id, *info.DKG, info.Ballots, len(options)) {
+		t.Errorf("Verified a partial decryption with the share of another trustee")
+	}
+}
+
+func TestHomomorphicResultsDuplicateTrustee(t *testing.T) {
+	id, shares, info := dummyTallyPoll(t, 3, 2)
+	options := info.Poll.Options
+
+	ballot, err := NewBallot(id, info.DKG.PublicKey(), options, "No")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info.Ballots = []Ballot{ballot}
+
+	d := NewPartialDecryption(id, 2, shares[2], info.Ballots, len(options))
+	info.Decryptions = []PartialDecryption{d, d}
+	if len(info.Results()) != 0 {
+		t.Errorf("One trustee decrypting twice reached the threshold")
+	}
+}
+
+func TestTallyPacketsWireRoundTrip(t *testing.T) {
+	id, shares, info := dummyTallyPoll(t, 2, 1)
+	Y := info.DKG.PublicKey()
+	options := info.Poll.Options
+
+	ballot, err := NewBallot(id, Y, options, "Maybe")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the encoding is tested here
+	sig := Signature{Elliptic: &EllipticCurveSignature{*big.NewInt(1), *big.NewInt(1)}}
+
+	poll := PollPacket{ID: id, Poll: &info.Poll}
+	if got := wireRoundTrip(t, GossipPacket{Poll: &poll, Signature: &sig}).Poll.Poll; got.Tally != TallyHomomorphic {
+		t.Errorf("Tally mode changed on the wire")
+	}
+
+	fromWire := *wireRoundTrip(t, GossipPacket{Poll: &PollPacket{ID: id, Ballot: &ballot}, Signature: &sig}).Poll.Ballot
+	if !fromWire.Valid(id, Y, len(options)) || fromWire.Digest() != ballot.Digest() {
+		t.Errorf("Ballot changed on the wire")
+	}
+
+	d := NewPartialDecryption(id, 1, shares[1], []Ballot{ballot}, len(options))
+	decoded := wireRoundTrip(t, GossipPacket{Poll: &PollPacket{ID: id, Decryption: &d}, Signature: &sig}).Poll.Decryption
+
+	if decoded.Trustee != 1 || !decoded.Valid(id, *info.DKG, []Ballot{fromWire}, len(options)) {
+		t.Errorf("Partial decryption changed on the wire")
+	}
+}
@@ -0,0 +1,235 @@
+package pollparty
+
+import (
+	"crypto/ecdsa"
+	secrand "crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+)
+
+const RegistryFileName = "registry.json"
+
+type IdentityWeight struct {
+	Key    PublicKeyWire // long-term key, from the keys file
+	Weight int
+	Name   string `json:",omitempty"` // shown as the creator of its polls
+}
+
+// weights of the identities, signed by an issuer which is itself a valid key.
+// A weighted poll embeds it, identities not listed can't vote
+type WeightRegistry struct {
+	Weights   []IdentityWeight
+	Issuer    PublicKeyWire
+	Signature EllipticCurveSignatureWire
+}
+
+func (r WeightRegistry) hash() []byte {
+	input, err := json.Marshal(r.Weights)
+	if err != nil {
+		panic(err)
+	}
+
+	hash := sha256.Sum256(input)
+	return hash[:]
+}
+
+func NewWeightRegistry(weights []IdentityWeight, issuer ecdsa.PrivateKey) (WeightRegistry, error) {
+	ret := WeightRegistry{
+		Weights: weights,
+		Issuer:  PublicKeyWireFromEcdsa(issuer.PublicKey),
+	}
+
+	r, s, err := ecdsa.Sign(secrand.Reader, &issuer, ret.hash())
+	if err != nil {
+		return ret, err
+	}
+	ret.Signature = EllipticCurveSignature{*r, *s}.toWire()
+
+	return ret, nil
+}
+
+func (r WeightRegistry) Valid(validKeys [][2]big.Int) bool {
+	issuer := r.Issuer.toEcdsa()
+	if _, ok := containsKey(validKeys, issuer); !ok {
+		return false
+	}
+
+	seen := make(map[string]bool)
+	for _, w := range r.Weights {
+		key := string(w.Key.X) + string(w.Key.Y)
+		if w.Weight <= 0 || seen[key] {
+			return false
+		}
+		seen[key] = true
+	}
+
+	sig := r.Signature.toBase()
+	return ecdsa.Verify(&issuer, r.hash(), &sig.R, &sig.S)
+}
+
+// zero if the key isn't in the registry
+func (r WeightRegistry) WeightOf(key ecdsa.PublicKey) int {
+	for _, w := range r.Weights {
+		k := w.Key.toEcdsa()
+		if k.X.Cmp(key.X) == 0 && k.Y.Cmp(key.Y) == 0 {
+			return w.Weight
+		}
+	}
+
+	return 0
+}
+
+func (r WeightRegistry) NameOf(key ecdsa.PublicKey) string {
+	for _, w := range r.Weights {
+		k := w.Key.toEcdsa()
+		if k.X.Cmp(key.X) == 0 && k.Y.Cmp(key.Y) == 0 {
+			return w.Name
+		}
+	}
+
+	return ""
+}
+
+func RegistryLoad() (WeightRegistry, error) {
+	var ret WeightRegistry
+
+	content, err := ioutil.ReadFile(RegistryFileName)
+	if err != nil {
+		return ret, err
+	}
+
+	err = json.Unmarshal(content, &ret)
+	return ret, err
+}
+
+func RegistrySave(r WeightRegistry) error {
+	content, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(RegistryFileName, content, 0600)
+}
+
+func (p Poll) Weighted() bool {
+	return p.Registry != nil
+}
+
+// weighted votes have to be opened, the encrypted ballots count one each
+func (p Poll) weightsValid(validKeys [][2]big.Int) bool {
+	return !p.Weighted() || (p.Tally != TallyHomomorphic && p.Registry.Valid(validKeys))
+}
+
+// voters of a weighted poll sign in the ring of their weight class, so that
+// the signature proves the weight but nothing more
+func weightRing(participants [][2]big.Int, weights []int, weight int) [][2]big.Int {
+	ret := make([][2]big.Int, 0)
+
+	for i, p := range participants {
+		if i < len(weights) && weights[i] == weight {
+			ret = append(ret, p)
+		}
+	}
+
+	return ret
+}
+
+func (msg VoteKeys) Weights() []int {
+	ret := make([]int, len(msg.Keys))
+
+	for i, k := range msg.Keys {
+		ret[i] = k.Weight
+	}
+
+	return ret
+}
+
+// the ring to sign in, with our weight class
+func (msg VoteKeys) ring(poll Poll, key ecdsa.PublicKey) ([][2]big.Int, int) {
+	participants := msg.ToParticipants()
+	if !poll.Weighted() {
+		return participants, 0
+	}
+
+	position, ok := containsKey(participants, key)
+	if !ok {
+		return participants, 0
+	}
+
+	weight := msg.Keys[position].Weight
+	return weightRing(participants, msg.Weights(), weight), weight
+}
+
+func (info ShareablePollInfo) ring(weight int) [][2]big.Int {
+	if !info.Poll.Weighted() {
+		return info.Participants
+	}
+
+	return weightRing(info.Participants, info.Weights, weight)
+}
+
+// weight class claimed by a ring signed packet
+func (pkg PollPacket) weight() int {
+	if pkg.Commitment != nil {
+		return pkg.Commitment.Weight
+	}
+
+	if pkg.Vote != nil {
+		return pkg.Vote.Weight
+	}
+
+	return 0
+}
+
+// our weight in the poll, false if we can't vote in it
+func (g *Gossiper) voteWeight(poll Poll) (int, bool) {
+	if !poll.Weighted() {
+		return 0, true
+	}
+
+	weight := poll.Registry.WeightOf(g.KeyPair.PublicKey)
+	return weight, weight > 0
+}
+
+// the weight of a vote key has to be the one of its signer in the registry,
+// it can't be checked before the poll
+func (g *Gossiper) voteKeyWeightValid(pkg GossipPacket) bool {
+	info := g.Polls.Get(pkg.Poll.ID)
+	if info.Tags == nil {
+		return true
+	}
+
+	poll := info.Poll
+	if !poll.Weighted() {
+		return pkg.Poll.VoteKey.Weight == 0
+	}
+
+	signer, err := g.validKeySigner(pkg)
+	if err != nil {
+		return false
+	}
+
+	weight := poll.Registry.WeightOf(signer)
+	return weight > 0 && weight == pkg.Poll.VoteKey.Weight
+}
+
+func (g *Gossiper) validKeySigner(pkg GossipPacket) (ecdsa.PublicKey, error) {
+	input, err := json.Marshal(pkg.Poll)
+	if err != nil {
+		return ecdsa.PublicKey{}, err
+	}
+	hash := sha256.Sum256(input)
+
+	for _, pubkey := range g.ValidKeys {
+		ecKey := ecdsa.PublicKey{Curve: Curve(), X: &pubkey[0], Y: &pubkey[1]}
+		if pkg.Signature.Elliptic != nil && ecdsa.Verify(&ecKey, hash[:],
+			&pkg.Signature.Elliptic.R, &pkg.Signature.Elliptic.S) {
+			return ecKey, nil
+		}
+	}
+
+	return ecdsa.PublicKey{}, errors.New("not signed by a valid key")
+}
@@ -0,0 +1,155 @@
+package pollparty
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+// a weighted poll where the voters have the given weights in the registry
+func DummyWeightedPoll(t *testing.T, g *Gossiper, voters []*Gossiper, weights []int) *Poll {
+	var entries []IdentityWeight
+	for i, v := range voters {
+		g.ValidKeys = append(g.ValidKeys, [2]big.Int{*v.KeyPair.X, *v.KeyPair.Y})
+		entries = append(entries, IdentityWeight{Key: PublicKeyWireFromEcdsa(v.KeyPair.PublicKey), Weight: weights[i]})
+	}
+	g.ValidKeys = append(g.ValidKeys, [2]big.Int{*g.KeyPair.X, *g.KeyPair.Y})
+
+	registry, err := NewWeightRegistry(entries, g.KeyPair)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	poll := DummyPoll()
+	poll.Registry = &registry
+	return poll
+}
+
+func TestWeightRegistry(t *testing.T) {
+	g := DummyGossiper()
+	a, b := DummyGossiper(), DummyGossiper()
+	poll := DummyWeightedPoll(t, g, []*Gossiper{a, b}, []int{1, 3})
+
+	if !poll.weightsValid(g.ValidKeys) {
+		t.Fatalf("Valid registry rejected")
+	}
+
+	id := PollKey{g.KeyPair.PublicKey, uint64(1)}
+	pkg := PollPacket{ID: id, Poll: poll}
+	sig, err := ecSignature(g, pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := wireRoundTrip(t, GossipPacket{Poll: &pkg, Signature: &sig})
+	if !g.SignatureValid(received) || !received.Poll.Poll.weightsValid(g.ValidKeys) {
+		t.Errorf("Weight registry changed on the wire")
+	}
+
+	if poll.Registry.WeightOf(b.KeyPair.PublicKey) != 3 || poll.Registry.WeightOf(g.KeyPair.PublicKey) != 0 {
+		t.Errorf("Wrong weights in the registry")
+	}
+
+	if poll.weightsValid(g.ValidKeys[:2]) {
+		t.Errorf("Accepted a registry from an issuer which isn't a valid key")
+	}
+
+	poll.Tally = TallyHomomorphic
+	if poll.weightsValid(g.ValidKeys) {
+		t.Errorf("Accepted a weighted homomorphic tally")
+	}
+	poll.Tally = TallyReveal
+
+	poll.Registry.Weights[0].Weight = 5
+	if poll.weightsValid(g.ValidKeys) {
+		t.Errorf("Accepted a tampered registry")
+	}
+}
+
+func TestWeightedRingSignature(t *testing.T) {
+	g := DummyGossiper()
+	voters := []*Gossiper{DummyGossiper(), DummyGossiper(), DummyGossiper()}
+	weights := []int{1, 2, 2}
+	poll := DummyWeightedPoll(t, g, voters, weights)
+
+	id := PollKey{g.KeyPair.PublicKey, uint64(1)}
+	g.Polls.Store(PollPacket{ID: id, Poll: poll})
+
+	var participants [][2]big.Int
+	for _, v := range voters {
+		participants = append(participants, [2]big.Int{*v.KeyPair.X, *v.KeyPair.Y})
+	}
+	g.storeParticipants(id, participants, weights)
+
+	ring := weightRing(participants, weights, 2)
+	if len(ring) != 2 {
+		t.Fatalf("Expected a ring of 2 keys, got %d", len(ring))
+	}
+
+	sign := func(weight int) GossipPacket {
+		pkg := PollPacket{ID: id, Commitment: &Commitment{Weight: weight}}
+		input, err := json.Marshal(pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sig := ringSignature(poll.Scheme, input, ring, &voters[2].KeyPair, 1)
+		return GossipPacket{Poll: &pkg, Signature: &sig}
+	}
+
+	if !g.SignatureValid(sign(2)) {
+		t.Errorf("Signature in the ring of the weight class rejected")
+	}
+
+	if g.SignatureValid(sign(1)) {
+		t.Errorf("Accepted a signature claiming another weight class")
+	}
+}
+
+func TestVoteKeyWeight(t *testing.T) {
+	g := DummyGossiper()
+	voter := DummyGossiper()
+	poll := DummyWeightedPoll(t, g, []*Gossiper{voter}, []int{2})
+
+	id := PollKey{g.KeyPair.PublicKey, uint64(1)}
+	g.Polls.Store(PollPacket{ID: id, Poll: poll})
+
+	send := func(weight int) GossipPacket {
+		pkg := PollPacket{ID: id, VoteKey: &VoteKey{tmpKey: voter.KeyPair.PublicKey, Weight: weight}}
+		sig, err := ecSignature(voter, pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return GossipPacket{Poll: &pkg, Signature: &sig}
+	}
+
+	if !g.voteKeyWeightValid(send(2)) {
+		t.Errorf("Vote key with the weight of the registry rejected")
+	}
+
+	if g.voteKeyWeightValid(send(3)) {
+		t.Errorf("Accepted a vote key claiming more weight")
+	}
+
+	weight, eligible := g.voteWeight(*poll)
+	if eligible || weight != 0 {
+		t.Errorf("Identity outside of the registry allowed to vote")
+	}
+}
+
+func TestWeightedResults(t *testing.T) {
+	g := DummyGossiper()
+	poll := DummyWeightedPoll(t, g, []*Gossiper{DummyGossiper()}, []int{1})
+
+	info := ShareablePollInfo{Poll: *poll}
+	info.Votes = append(info.Votes, Vote{Option: "Yes", Weight: 3}, Vote{Option: "No", Weight: 1}, Vote{Option: "No", Weight: 1})
+
+	results := info.Results()
+	if results["Yes"] != 3 || results["No"] != 2 {
+		t.Errorf("Wrong weighted tally: %v", results)
+	}
+
+	info.Poll.Registry = nil
+	if results = info.Results(); results["Yes"] != 1 || results["No"] != 2 {
+		t.Errorf("Weights counted in an unweighted poll: %v", results)
+	}
+}